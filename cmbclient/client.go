@@ -0,0 +1,167 @@
+// Package cmbclient 招行直联 FBSdk 的HTTP客户端，负责请求的GBK编码、XML序列化以及
+// 返回码检查，可以被其它服务直接使用
+package cmbclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gogap/cmb_robot/monitor/models"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/transform"
+)
+
+var (
+	ErrURLIsEmpty       = errors.New("cmb client url is empty")
+	ErrLoginNameIsEmpty = errors.New("cmb client login name is empty")
+)
+
+// Caller 对 FBSdk 的一次调用，方便在测试中替换
+type Caller interface {
+	Call(ctx context.Context, req models.Request, resp models.Response) (err error)
+}
+
+// CallerFunc 将函数适配为 Caller
+type CallerFunc func(ctx context.Context, req models.Request, resp models.Response) (err error)
+
+func (f CallerFunc) Call(ctx context.Context, req models.Request, resp models.Response) error {
+	return f(ctx, req, resp)
+}
+
+type Options struct {
+	HTTPClient *http.Client  // 为空时使用 http.DefaultClient
+	Timeout    time.Duration // 单次调用超时，0 表示只受 ctx 限制
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Timeout: 29 * time.Second,
+	}
+}
+
+type Client struct {
+	url       string
+	loginName string
+	opts      Options
+}
+
+func New(baseURL, loginName string, opts Options) (cli *Client, err error) {
+	if len(baseURL) == 0 {
+		err = ErrURLIsEmpty
+		return
+	}
+
+	if _, err = url.Parse(baseURL); err != nil {
+		return
+	}
+
+	if len(loginName) == 0 {
+		err = ErrLoginNameIsEmpty
+		return
+	}
+
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+
+	cli = &Client{
+		url:       baseURL,
+		loginName: loginName,
+		opts:      opts,
+	}
+
+	return
+}
+
+func (p *Client) URL() string {
+	return p.url
+}
+
+func (p *Client) LoginName() string {
+	return p.loginName
+}
+
+// Call 填写 FUNNAM/DATTYP/LGNNAM 后发送请求, 并将返回解析到 resp 中,
+// 返回码不为0时返回 models.ErrActionFailed
+func (p *Client) Call(ctx context.Context, req models.Request, resp models.Response) (err error) {
+	req.SetBasicInfo(models.ReqBasicInfo{
+		FUNNAM: req.FunctionName(),
+		DATTYP: models.DATTYPXML,
+		LGNNAM: p.loginName,
+	})
+
+	body, err := encode(req)
+	if err != nil {
+		return
+	}
+
+	if p.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.opts.Timeout)
+		defer cancel()
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := p.opts.HTTPClient.Do(httpReq)
+	if err != nil {
+		return
+	}
+	defer httpResp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		err = &StatusError{StatusCode: httpResp.StatusCode, Body: string(respBody)}
+		return
+	}
+
+	if err = decode(respBody, resp); err != nil {
+		err = fmt.Errorf("%w: %s: %v", ErrBadResponse, req.FunctionName(), err)
+		return
+	}
+
+	return resp.Validate()
+}
+
+func encode(req models.Request) (body []byte, err error) {
+	data, err := xml.Marshal(req)
+	if err != nil {
+		return
+	}
+
+	data = append([]byte(`<?xml version="1.0" encoding = "GBK"?>`), data...)
+
+	// transform.Transformer 不能并发使用，每次都新建
+	body, _, err = transform.Bytes(simplifiedchinese.GBK.NewEncoder(), data)
+
+	return
+}
+
+func decode(body []byte, resp models.Response) (err error) {
+	data, _, err := transform.Bytes(simplifiedchinese.GBK.NewDecoder(), body)
+	if err != nil {
+		return
+	}
+
+	// 已经转为UTF-8, 需要同时修改XML声明
+	respStr := strings.Replace(string(data), "GBK", "UTF-8", 1)
+
+	return xml.Unmarshal([]byte(respStr), resp)
+}
@@ -0,0 +1,40 @@
+package cmbclient
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gogap/cmb_robot/monitor/models"
+)
+
+var (
+	ErrBadResponse = errors.New("bad cmb response")
+)
+
+// 常见的操作错误, 使用 errors.Is 判断, 例如 errors.Is(err, cmbclient.ErrNotLoggedIn)
+var (
+	ErrFailure        = models.ErrActionFailed{RETCOD: models.RETCODFailure}
+	ErrExecuteFailure = models.ErrActionFailed{RETCOD: models.RETCODExecuteFailure}
+	ErrBadFormat      = models.ErrActionFailed{RETCOD: models.RETCODBadFormat}
+	ErrNotLoggedIn    = models.ErrActionFailed{RETCOD: models.RETCODNotLoggedIn}
+	ErrTooFrequent    = models.ErrActionFailed{RETCOD: models.RETCODTooFrequent}
+	ErrNotCertUser    = models.ErrActionFailed{RETCOD: models.RETCODNotCertUser}
+	ErrCancelled      = models.ErrActionFailed{RETCOD: models.RETCODCancelled}
+	ErrSignature      = models.ErrActionFailed{ERRMSG: models.ERRMSGSignatureError}
+)
+
+// StatusError FBSdk 返回了非200的HTTP状态
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (p *StatusError) Error() string {
+	return "cmb http status: " + strconv.Itoa(p.StatusCode)
+}
+
+// ActionFailed 取出操作错误，不是操作错误时返回false
+func ActionFailed(err error) (e models.ErrActionFailed, ok bool) {
+	ok = errors.As(err, &e)
+	return
+}
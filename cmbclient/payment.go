@@ -0,0 +1,318 @@
+package cmbclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gogap/cmb_robot/monitor/models"
+)
+
+var (
+	ErrInvalidPayment  = errors.New("invalid payment")
+	ErrYURREFConflict  = errors.New("yurref already used by a different payment")
+	ErrPaymentUnknown  = errors.New("payment state unknown, do not resubmit with a new yurref")
+	ErrPaymentRejected = errors.New("payment rejected")
+)
+
+const (
+	// BUSCODPayment 支付业务类型
+	BUSCODPayment = "N02031"
+
+	maxYURREFLength = 30
+
+	// 提交后状态不确定时，最多重新提交的次数
+	maxResubmits = 2
+)
+
+// Payment 一笔直联支付, YURREF 作为幂等键: 同一笔业务无论提交多少次都必须使用同一个 YURREF
+type Payment struct {
+	YURREF string        // 业务参考号
+	DBTACC string        // 付方账号
+	DBTBBK string        // 付方开户地区代码
+	Amount models.Amount // 金额，币种为 Amount 的币种
+	STLCHN string        // 结算方式: N 普通, F 快速，默认 N
+	NUSAGE string        // 用途
+	BNKFLG string        // 收方是否招行: Y/N
+	CRTACC string        // 收方账号
+	CRTNAM string        // 收方户名
+	CRTBNK string        // 收方开户行，跨行必填
+	CRTADR string        // 收方开户行地址，跨行必填
+}
+
+func (p *Payment) Validate() (err error) {
+	invalid := func(field, reason string) error {
+		return fmt.Errorf("%w: %s %s", ErrInvalidPayment, field, reason)
+	}
+
+	switch {
+	case len(p.YURREF) == 0:
+		return invalid("YURREF", "is required")
+	case len(p.YURREF) > maxYURREFLength:
+		return invalid("YURREF", fmt.Sprintf("is longer than %d", maxYURREFLength))
+	case len(p.DBTACC) == 0:
+		return invalid("DBTACC", "is required")
+	case len(p.DBTBBK) == 0:
+		return invalid("DBTBBK", "is required")
+	case p.Amount.Sign() <= 0:
+		return invalid("Amount", "must be greater than zero")
+	case len(p.NUSAGE) == 0:
+		return invalid("NUSAGE", "is required")
+	case len(p.CRTACC) == 0:
+		return invalid("CRTACC", "is required")
+	case len(p.CRTNAM) == 0:
+		return invalid("CRTNAM", "is required")
+	case p.BNKFLG != "Y" && p.BNKFLG != "N":
+		return invalid("BNKFLG", "must be Y or N")
+	case p.BNKFLG == "N" && len(p.CRTBNK) == 0:
+		return invalid("CRTBNK", "is required for inter-bank payment")
+	case p.BNKFLG == "N" && len(p.CRTADR) == 0:
+		return invalid("CRTADR", "is required for inter-bank payment")
+	case len(p.STLCHN) > 0 && p.STLCHN != "N" && p.STLCHN != "F":
+		return invalid("STLCHN", "must be N or F")
+	}
+
+	return
+}
+
+func (p *Payment) request() *models.ReqDirectPayment {
+	req := &models.ReqDirectPayment{
+		BUSCOD: BUSCODPayment,
+		YURREF: p.YURREF,
+		DBTACC: p.DBTACC,
+		DBTBBK: p.DBTBBK,
+		TRSAMT: p.Amount,
+		CCYNBR: string(p.Amount.Currency()),
+		STLCHN: p.STLCHN,
+		NUSAGE: p.NUSAGE,
+		BNKFLG: p.BNKFLG,
+		CRTACC: p.CRTACC,
+		CRTNAM: p.CRTNAM,
+		CRTBNK: p.CRTBNK,
+		CRTADR: p.CRTADR,
+	}
+
+	if len(req.STLCHN) == 0 {
+		req.STLCHN = "N"
+	}
+
+	return req
+}
+
+// PaymentResult 支付的当前状态
+type PaymentResult struct {
+	YURREF     string
+	REQNBR     string        // 流水号
+	REQSTS     string        // 业务请求状态
+	RTNFLG     string        // 业务处理结果
+	RTNNAR     string        // 失败原因
+	CRTACC     string        // 收方账号
+	Amount     models.Amount // 金额
+	StatusText string        // REQSTS 的中文说明
+	ResultText string        // RTNFLG 的中文说明
+
+	// Existing 为 true 表示这笔支付之前已经提交过，本次结果来自查询
+	Existing bool
+}
+
+func newPaymentResult(item *models.RespGetPaymentInfoListItem) *PaymentResult {
+	return &PaymentResult{
+		YURREF:     item.YURREF,
+		REQNBR:     item.REQNBR,
+		REQSTS:     item.REQSTS,
+		RTNFLG:     item.RTNFLG,
+		RTNNAR:     item.RTNNAR,
+		CRTACC:     item.CRTACC,
+		Amount:     item.TRSAMT,
+		StatusText: models.REQSTSs[item.REQSTS],
+		ResultText: models.RTNFLGs[item.RTNFLG],
+	}
+}
+
+// Finished 银行已处理完毕
+func (p *PaymentResult) Finished() bool {
+	return p.REQSTS == "FIN"
+}
+
+// Succeeded 银行已处理完毕且成功
+func (p *PaymentResult) Succeeded() bool {
+	return p.Finished() && p.RTNFLG == "S"
+}
+
+// SubmitPayment 提交支付。提交结果不确定（超时、断开连接等）时，先按 YURREF 查询，
+// 只有确认银行没有收到时才用同一个 YURREF 重新提交，不会产生重复转账。
+// 返回 ErrPaymentUnknown 时，调用方只能稍后用 QueryPayment 查询，不能换 YURREF 重新提交
+func SubmitPayment(ctx context.Context, caller Caller, payment *Payment) (result *PaymentResult, err error) {
+	if err = payment.Validate(); err != nil {
+		return
+	}
+
+	since := time.Now().AddDate(0, 0, -1)
+
+	for attempt := 0; ; attempt++ {
+		var uncertain bool
+		result, uncertain, err = submitPayment(ctx, caller, payment)
+		if !uncertain {
+			break
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		// 状态不确定，先查询，银行没有收到时才重新提交
+		found, e := lookupPayment(ctx, caller, payment, since)
+		if e != nil {
+			err = e
+			return
+		}
+
+		if found != nil {
+			return found, nil
+		}
+
+		if attempt == maxResubmits {
+			return
+		}
+	}
+
+	if err == nil && result == nil {
+		// 业务参考号重复，返回已有的支付
+		result, err = lookupPayment(ctx, caller, payment, since)
+		if err == nil && result == nil {
+			err = fmt.Errorf("%w: duplicate yurref but not found", ErrPaymentUnknown)
+		}
+	}
+
+	return
+}
+
+// submitPayment uncertain 为 true 表示无法确定银行是否收到了请求
+func submitPayment(ctx context.Context, caller Caller, payment *Payment) (result *PaymentResult, uncertain bool, err error) {
+	resp := models.RespDirectPayment{}
+
+	err = caller.Call(ctx, payment.request(), &resp)
+	if err != nil {
+		// 只有确定请求没有发到银行的操作错误才是最终结果，
+		// 系统忙、通讯失败等错误以及超时、断开连接都无法确定
+		if !notSubmitted(err) {
+			uncertain = true
+			err = fmt.Errorf("%w: %v", ErrPaymentUnknown, err)
+		}
+		return
+	}
+
+	switch resp.ERRCOD {
+	case models.ERRCODSuccess, "":
+	case models.ERRCODDuplicateYURREF:
+		return
+	default:
+		// 银行已处理完毕时才是拒绝，仍在处理中时无法确定
+		if len(resp.REQSTS) > 0 && resp.REQSTS != "FIN" {
+			uncertain = true
+			err = fmt.Errorf("%w: %s %s, status %s", ErrPaymentUnknown, resp.ERRCOD, resp.ERRTXT, resp.REQSTS)
+			return
+		}
+
+		err = &PaymentError{YURREF: payment.YURREF, ERRCOD: resp.ERRCOD, ERRTXT: resp.ERRTXT}
+		return
+	}
+
+	result = newPaymentResult(&models.RespGetPaymentInfoListItem{
+		YURREF: payment.YURREF,
+		REQNBR: resp.REQNBR,
+		REQSTS: resp.REQSTS,
+		RTNFLG: resp.RTNFLG,
+		CRTACC: payment.CRTACC,
+		TRSAMT: payment.Amount,
+	})
+
+	return
+}
+
+// notSubmitted 操作错误是否表示 DCPAYMNT 一定没有被银行执行：
+// 数据格式错误、尚未登录、请求太频繁、不是证书卡用户、用户取消操作和签名错误都在发给银行之前返回。
+// 失败(-1)、执行失败(-2)和其他错误(-9)时银行可能已经收到了请求
+func notSubmitted(err error) bool {
+	e, ok := ActionFailed(err)
+	if !ok {
+		return false
+	}
+
+	switch e.RETCOD {
+	case models.RETCODBadFormat, models.RETCODNotLoggedIn, models.RETCODTooFrequent, models.RETCODNotCertUser, models.RETCODCancelled:
+		return true
+	}
+
+	return errors.Is(err, ErrSignature)
+}
+
+// lookupPayment 按 YURREF 查询已提交的支付，没有找到时返回 nil
+func lookupPayment(ctx context.Context, caller Caller, payment *Payment, since time.Time) (result *PaymentResult, err error) {
+	result, err = QueryPayment(ctx, caller, payment.YURREF, since, time.Now())
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrPaymentUnknown, err)
+		return
+	}
+
+	if result == nil {
+		return
+	}
+
+	if result.CRTACC != payment.CRTACC || result.Amount.Fen() != payment.Amount.Fen() {
+		result, err = nil, ErrYURREFConflict
+		return
+	}
+
+	result.Existing = true
+
+	return
+}
+
+// QueryPayment 按 YURREF 查询支付状态，没有找到时返回 nil
+func QueryPayment(ctx context.Context, caller Caller, yurref string, begin, end time.Time) (result *PaymentResult, err error) {
+	req := &models.ReqGetPaymentInfo{
+		BUSCOD: BUSCODPayment,
+		BGNDAT: begin.Format("20060102"),
+		ENDDAT: end.Format("20060102"),
+		YURREF: yurref,
+	}
+
+	resp := models.RespGetPaymentInfo{}
+	if err = caller.Call(ctx, req, &resp); err != nil {
+		return
+	}
+
+	for i := range resp.NTQPAYQYZ {
+		if resp.NTQPAYQYZ[i].YURREF == yurref {
+			result = newPaymentResult(&resp.NTQPAYQYZ[i])
+			return
+		}
+	}
+
+	return
+}
+
+func (p *Client) SubmitPayment(ctx context.Context, payment *Payment) (*PaymentResult, error) {
+	return SubmitPayment(ctx, p, payment)
+}
+
+func (p *Client) QueryPayment(ctx context.Context, yurref string, begin, end time.Time) (*PaymentResult, error) {
+	return QueryPayment(ctx, p, yurref, begin, end)
+}
+
+// PaymentError 银行拒绝了这笔支付
+type PaymentError struct {
+	YURREF string
+	ERRCOD string
+	ERRTXT string
+}
+
+func (p *PaymentError) Error() string {
+	return "payment " + p.YURREF + " rejected: " + p.ERRCOD + " " + p.ERRTXT
+}
+
+func (p *PaymentError) Unwrap() error {
+	return ErrPaymentRejected
+}
@@ -0,0 +1,222 @@
+package cmbclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gogap/cmb_robot/monitor/models"
+)
+
+func testPayment() *Payment {
+	return &Payment{
+		YURREF: "R20240102001",
+		DBTACC: "755000001",
+		DBTBBK: "75",
+		Amount: models.Fen(10000),
+		NUSAGE: "货款",
+		BNKFLG: "Y",
+		CRTACC: "755000002",
+		CRTNAM: "张三",
+	}
+}
+
+// bank 按顺序返回 DCPAYMNT 的结果，GetPaymentInfo 在 accepted 后能查到这笔支付
+type bank struct {
+	submits  []func(resp *models.RespDirectPayment) error
+	accepted bool
+
+	submitCalls int
+	lookupCalls int
+}
+
+func (p *bank) Call(ctx context.Context, req models.Request, resp models.Response) error {
+	switch r := resp.(type) {
+	case *models.RespDirectPayment:
+		fn := p.submits[p.submitCalls]
+		p.submitCalls++
+		return fn(r)
+	case *models.RespGetPaymentInfo:
+		p.lookupCalls++
+		if p.accepted {
+			pay := testPayment()
+			r.NTQPAYQYZ = append(r.NTQPAYQYZ, models.RespGetPaymentInfoListItem{
+				YURREF: pay.YURREF,
+				CRTACC: pay.CRTACC,
+				TRSAMT: pay.Amount,
+				REQNBR: "0000000001",
+				REQSTS: "BNK",
+			})
+		}
+		return nil
+	}
+	return errors.New("unexpected request " + req.FunctionName())
+}
+
+func actionFailed(retcod int64, errmsg string) func(*models.RespDirectPayment) error {
+	return func(*models.RespDirectPayment) error {
+		return models.ErrActionFailed{FUNNAM: "DCPAYMNT", RETCOD: retcod, ERRMSG: errmsg}
+	}
+}
+
+func accept(p *bank) func(*models.RespDirectPayment) error {
+	return func(resp *models.RespDirectPayment) error {
+		p.accepted = true
+		resp.ERRCOD = models.ERRCODSuccess
+		resp.REQNBR = "0000000001"
+		resp.REQSTS = "BNK"
+		return nil
+	}
+}
+
+func TestSubmitPaymentDefinitiveFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		retcod int64
+		errmsg string
+	}{
+		{"bad format", models.RETCODBadFormat, "数据格式错误"},
+		{"not logged in", models.RETCODNotLoggedIn, "尚未登录系统"},
+		{"too frequent", models.RETCODTooFrequent, "请求太频繁"},
+		{"not cert user", models.RETCODNotCertUser, "不是证书卡用户"},
+		{"cancelled", models.RETCODCancelled, "用户取消操作"},
+		{"signature error", models.RETCODFailure, models.ERRMSGSignatureError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &bank{}
+			b.submits = append(b.submits, actionFailed(tt.retcod, tt.errmsg))
+
+			result, err := SubmitPayment(context.Background(), b, testPayment())
+
+			if _, ok := ActionFailed(err); !ok || errors.Is(err, ErrPaymentUnknown) || result != nil {
+				t.Errorf("SubmitPayment = %+v, %v, want the action error", result, err)
+			}
+
+			if b.lookupCalls != 0 {
+				t.Errorf("looked up %d times, want 0", b.lookupCalls)
+			}
+		})
+	}
+}
+
+func TestSubmitPaymentUncertainFailure(t *testing.T) {
+	for _, retcod := range []int64{models.RETCODFailure, models.RETCODExecuteFailure, models.RETCODOther} {
+		b := &bank{}
+		b.submits = append(b.submits, func(resp *models.RespDirectPayment) error {
+			// 银行已经收到了请求，但返回了系统忙
+			b.accepted = true
+			return models.ErrActionFailed{FUNNAM: "DCPAYMNT", RETCOD: retcod, ERRMSG: "系统忙"}
+		})
+
+		result, err := SubmitPayment(context.Background(), b, testPayment())
+		if err != nil || result == nil || !result.Existing || result.REQNBR != "0000000001" {
+			t.Errorf("RETCOD %d: SubmitPayment = %+v, %v, want the existing payment", retcod, result, err)
+		}
+
+		if b.submitCalls != 1 || b.lookupCalls != 1 {
+			t.Errorf("RETCOD %d: %d submits, %d lookups, want 1 and 1", retcod, b.submitCalls, b.lookupCalls)
+		}
+	}
+}
+
+func TestSubmitPaymentResubmitsWhenNotFound(t *testing.T) {
+	b := &bank{}
+	b.submits = append(b.submits, actionFailed(models.RETCODOther, "其他错误"), accept(b))
+
+	result, err := SubmitPayment(context.Background(), b, testPayment())
+	if err != nil || result == nil || result.Existing || result.REQSTS != "BNK" {
+		t.Errorf("SubmitPayment = %+v, %v", result, err)
+	}
+
+	if b.submitCalls != 2 || b.lookupCalls != 1 {
+		t.Errorf("%d submits, %d lookups, want 2 and 1", b.submitCalls, b.lookupCalls)
+	}
+}
+
+func TestSubmitPaymentUnknown(t *testing.T) {
+	timeout := func(*models.RespDirectPayment) error { return context.DeadlineExceeded }
+
+	b := &bank{}
+	for i := 0; i <= maxResubmits; i++ {
+		b.submits = append(b.submits, timeout)
+	}
+
+	_, err := SubmitPayment(context.Background(), b, testPayment())
+	if !errors.Is(err, ErrPaymentUnknown) {
+		t.Fatalf("SubmitPayment = %v, want %v", err, ErrPaymentUnknown)
+	}
+
+	// 每次不确定后都先查询，包括最后一次
+	if b.submitCalls != maxResubmits+1 || b.lookupCalls != maxResubmits+1 {
+		t.Errorf("%d submits, %d lookups, want %d each", b.submitCalls, b.lookupCalls, maxResubmits+1)
+	}
+}
+
+func TestSubmitPaymentRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		reqsts string
+		want   error
+		lookup int
+	}{
+		{"finished", "FIN", ErrPaymentRejected, 0},
+		{"no status", "", ErrPaymentRejected, 0},
+		{"still processing", "BNK", ErrPaymentUnknown, maxResubmits + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &bank{}
+			for i := 0; i <= maxResubmits; i++ {
+				b.submits = append(b.submits, func(resp *models.RespDirectPayment) error {
+					resp.ERRCOD, resp.ERRTXT, resp.REQSTS = "CSAC001", "付方账号不存在", tt.reqsts
+					return nil
+				})
+			}
+
+			_, err := SubmitPayment(context.Background(), b, testPayment())
+			if !errors.Is(err, tt.want) {
+				t.Errorf("SubmitPayment = %v, want %v", err, tt.want)
+			}
+
+			if b.lookupCalls != tt.lookup {
+				t.Errorf("looked up %d times, want %d", b.lookupCalls, tt.lookup)
+			}
+		})
+	}
+}
+
+func TestSubmitPaymentConflict(t *testing.T) {
+	b := &bank{accepted: true}
+	b.submits = append(b.submits, func(resp *models.RespDirectPayment) error {
+		resp.ERRCOD = models.ERRCODDuplicateYURREF
+		return nil
+	})
+
+	pay := testPayment()
+	pay.Amount = models.Fen(1)
+
+	if _, err := SubmitPayment(context.Background(), b, pay); err != ErrYURREFConflict {
+		t.Errorf("SubmitPayment = %v, want %v", err, ErrYURREFConflict)
+	}
+}
+
+func TestSubmitPaymentCanceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+
+	b := &bank{}
+	b.submits = append(b.submits, func(*models.RespDirectPayment) error { return ctx.Err() })
+
+	if _, err := SubmitPayment(ctx, b, testPayment()); !errors.Is(err, ErrPaymentUnknown) {
+		t.Errorf("SubmitPayment = %v, want %v", err, ErrPaymentUnknown)
+	}
+
+	if b.lookupCalls != 0 {
+		t.Errorf("looked up %d times after cancel, want 0", b.lookupCalls)
+	}
+}
@@ -0,0 +1,204 @@
+package cmbclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gogap/cmb_robot/monitor/models"
+)
+
+var (
+	ErrInvalidTransactionQuery = errors.New("invalid transaction query")
+	ErrContinuationLoop        = errors.New("cmb returned the same continuation key twice")
+)
+
+// TransactionQuery 账务明细查询条件，日期范围超过单次查询限制时自动拆分
+type TransactionQuery struct {
+	BBKNBR int       // 分行号
+	ACCNBR string    // 账号
+	Begin  time.Time // 开始日期（含）
+	End    time.Time // 结束日期（含）
+	AMTCDR string    // 借贷码 C:贷 D:借，为空时全部返回
+
+	// MaxDays 单次查询的最大日期跨度，默认 models.GetTransInfoMaxDays
+	MaxDays int
+}
+
+func (p *TransactionQuery) Validate() (err error) {
+	switch {
+	case len(p.ACCNBR) == 0:
+		err = fmt.Errorf("%w: ACCNBR is required", ErrInvalidTransactionQuery)
+	case p.Begin.IsZero() || p.End.IsZero():
+		err = fmt.Errorf("%w: Begin and End are required", ErrInvalidTransactionQuery)
+	case p.End.Before(p.Begin):
+		err = fmt.Errorf("%w: End is before Begin", ErrInvalidTransactionQuery)
+	case len(p.AMTCDR) > 0 && p.AMTCDR != "C" && p.AMTCDR != "D":
+		err = fmt.Errorf("%w: AMTCDR must be C or D", ErrInvalidTransactionQuery)
+	}
+
+	return
+}
+
+// Transaction 一条账务明细
+type Transaction struct {
+	ETYDAT  string        // 交易日
+	ETYTIM  string        // 交易时间
+	VLTDAT  string        // 起息日
+	TRSCOD  string        // 交易类型
+	NARTXT  string        // 摘要
+	AMTCDR  string        // 借贷标记 C:贷 D:借
+	Amount  models.Amount // 交易金额，借方为负
+	Balance models.Amount // 交易后余额
+	REFNBR  string        // 流水号
+	REQNBR  string        // 流程实例号
+	BUSNAM  string        // 业务名称
+	NUSAGE  string        // 用途
+	YURREF  string        // 业务参考号
+	RPYACC  string        // 收/付方账号
+	RPYNAM  string        // 收/付方名称
+	RPYBNK  string        // 收/付方开户行
+}
+
+func newTransaction(item *models.RespGetTransInfoItem) Transaction {
+	return Transaction{
+		ETYDAT:  item.ETYDAT,
+		ETYTIM:  item.ETYTIM,
+		VLTDAT:  item.VLTDAT,
+		TRSCOD:  item.TRSCOD,
+		NARTXT:  item.NARTXT,
+		AMTCDR:  item.AMTCDR,
+		Amount:  item.TRSAMT,
+		Balance: item.TRSBLV,
+		REFNBR:  item.REFNBR,
+		REQNBR:  item.REQNBR,
+		BUSNAM:  item.BUSNAM,
+		NUSAGE:  item.NUSAGE,
+		YURREF:  item.YURREF,
+		RPYACC:  item.RPYACC,
+		RPYNAM:  item.RPYNAM,
+		RPYBNK:  item.RPYBNK,
+	}
+}
+
+// TransactionIterator 按日期顺序返回账务明细，需要时才向银行查询下一段日期或下一页
+//
+//	it := cli.Transactions(ctx, query)
+//	for it.Next() {
+//		tx := it.Transaction()
+//	}
+//	err := it.Err()
+type TransactionIterator struct {
+	ctx    context.Context
+	caller Caller
+	query  TransactionQuery
+
+	begin  time.Time       // 当前分段的开始日期
+	ctnkey string          // 当前分段的续传键值
+	seen   map[string]bool // 当前分段已返回过的续传键值
+
+	items []models.RespGetTransInfoItem
+	tx    Transaction
+	done  bool
+	err   error
+}
+
+// Transactions 查询账务明细 (GetTransInfo)
+func Transactions(ctx context.Context, caller Caller, query TransactionQuery) *TransactionIterator {
+	if query.MaxDays <= 0 {
+		query.MaxDays = models.GetTransInfoMaxDays
+	}
+
+	it := &TransactionIterator{
+		ctx:    ctx,
+		caller: caller,
+		query:  query,
+		begin:  truncateDay(query.Begin),
+	}
+
+	it.err = query.Validate()
+
+	return it
+}
+
+func (p *Client) Transactions(ctx context.Context, query TransactionQuery) *TransactionIterator {
+	return Transactions(ctx, p, query)
+}
+
+func (p *TransactionIterator) Next() bool {
+	for len(p.items) == 0 {
+		if p.err != nil || p.done {
+			return false
+		}
+
+		p.err = p.fetch()
+	}
+
+	p.tx = newTransaction(&p.items[0])
+	p.items = p.items[1:]
+
+	return true
+}
+
+func (p *TransactionIterator) Transaction() Transaction {
+	return p.tx
+}
+
+func (p *TransactionIterator) Err() error {
+	return p.err
+}
+
+// fetch 查询当前分段的下一页，分段查完后移动到下一段
+func (p *TransactionIterator) fetch() (err error) {
+	last := truncateDay(p.query.End)
+
+	end := p.begin.AddDate(0, 0, p.query.MaxDays-1)
+	if end.After(last) {
+		end = last
+	}
+
+	req := &models.ReqGetTransInfo{
+		BBKNBR: p.query.BBKNBR,
+		ACCNBR: p.query.ACCNBR,
+		BGNDAT: p.begin.Format("20060102"),
+		ENDDAT: end.Format("20060102"),
+		AMTCDR: p.query.AMTCDR,
+		CTNKEY: p.ctnkey,
+	}
+
+	resp := models.RespGetTransInfo{}
+	if err = p.caller.Call(p.ctx, req, &resp); err != nil {
+		return
+	}
+
+	// 续传键值重复时这一页已经返回过，丢弃本页并结束
+	if len(resp.CTNKEY) > 0 && p.seen[resp.CTNKEY] {
+		err = ErrContinuationLoop
+		return
+	}
+
+	p.items = resp.NTQTSINFZ
+
+	if len(resp.CTNKEY) > 0 {
+		if p.seen == nil {
+			p.seen = make(map[string]bool)
+		}
+
+		p.seen[resp.CTNKEY] = true
+		p.ctnkey = resp.CTNKEY
+		return
+	}
+
+	p.ctnkey = ""
+	p.seen = nil
+	p.begin = end.AddDate(0, 0, 1)
+	p.done = p.begin.After(last)
+
+	return
+}
+
+func truncateDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,226 @@
+package cmbclient
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gogap/cmb_robot/fbsdkmock"
+	"github.com/gogap/cmb_robot/monitor/models"
+)
+
+// recorder 记录每次 GetTransInfo 请求的日期范围和续传键值
+type recorder struct {
+	caller Caller
+	reqs   []models.ReqGetTransInfo
+}
+
+func (p *recorder) Call(ctx context.Context, req models.Request, resp models.Response) error {
+	if r, ok := req.(*models.ReqGetTransInfo); ok {
+		p.reqs = append(p.reqs, *r)
+	}
+	return p.caller.Call(ctx, req, resp)
+}
+
+func (p *recorder) ranges() (ranges []string) {
+	for _, r := range p.reqs {
+		ranges = append(ranges, r.BGNDAT+"-"+r.ENDDAT+"/"+r.CTNKEY)
+	}
+	return
+}
+
+func newTestBank(t *testing.T) (srv *fbsdkmock.Server, rec *recorder) {
+	srv = fbsdkmock.New()
+
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+
+	cli, err := New(ts.URL, "u1", DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return srv, &recorder{caller: cli}
+}
+
+func addTransactions(srv *fbsdkmock.Server, dates ...string) {
+	for i, date := range dates {
+		srv.AddTransaction(75, "755000001", models.RespGetTransInfoItem{
+			ETYDAT: date,
+			AMTCDR: "C",
+			TRSAMT: models.Fen(int64(i + 1)),
+			REFNBR: date + "-" + string(rune('a'+i)),
+		})
+	}
+}
+
+func day(date string) time.Time {
+	t, _ := time.Parse("20060102", date)
+	return t
+}
+
+func collect(it *TransactionIterator) (refs []string, err error) {
+	for it.Next() {
+		refs = append(refs, it.Transaction().REFNBR)
+	}
+	return refs, it.Err()
+}
+
+func TestTransactionsChunks(t *testing.T) {
+	srv, rec := newTestBank(t)
+
+	// 分段的首尾两天都有交易
+	addTransactions(srv, "20240101", "20240103", "20240104", "20240106", "20240107")
+
+	refs, err := collect(Transactions(context.Background(), rec, TransactionQuery{
+		BBKNBR:  75,
+		ACCNBR:  "755000001",
+		Begin:   day("20240101").Add(15 * time.Hour),
+		End:     day("20240107").Add(time.Hour),
+		MaxDays: 3,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"20240101-a", "20240103-b", "20240104-c", "20240106-d", "20240107-e"}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("transactions = %v, want %v", refs, want)
+	}
+
+	wantRanges := []string{"20240101-20240103/", "20240104-20240106/", "20240107-20240107/"}
+	if !reflect.DeepEqual(rec.ranges(), wantRanges) {
+		t.Errorf("requests = %v, want %v", rec.ranges(), wantRanges)
+	}
+}
+
+func TestTransactionsSingleDay(t *testing.T) {
+	srv, rec := newTestBank(t)
+	addTransactions(srv, "20240101", "20240102")
+
+	refs, err := collect(Transactions(context.Background(), rec, TransactionQuery{
+		BBKNBR: 75,
+		ACCNBR: "755000001",
+		Begin:  day("20240102"),
+		End:    day("20240102"),
+	}))
+	if err != nil || !reflect.DeepEqual(refs, []string{"20240102-b"}) {
+		t.Errorf("transactions = %v, %v", refs, err)
+	}
+
+	if len(rec.reqs) != 1 {
+		t.Errorf("requests = %v", rec.ranges())
+	}
+}
+
+func TestTransactionsContinuation(t *testing.T) {
+	srv, rec := newTestBank(t)
+	srv.SetPageSize(2)
+
+	addTransactions(srv, "20240101", "20240101", "20240102", "20240102", "20240102", "20240105")
+
+	refs, err := collect(Transactions(context.Background(), rec, TransactionQuery{
+		BBKNBR:  75,
+		ACCNBR:  "755000001",
+		Begin:   day("20240101"),
+		End:     day("20240105"),
+		MaxDays: 3,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"20240101-a", "20240101-b", "20240102-c", "20240102-d", "20240102-e", "20240105-f"}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("transactions = %v, want %v", refs, want)
+	}
+
+	// 续传键值只在当前分段内使用，下一段重新开始
+	wantRanges := []string{
+		"20240101-20240103/",
+		"20240101-20240103/2",
+		"20240101-20240103/4",
+		"20240104-20240105/",
+	}
+	if !reflect.DeepEqual(rec.ranges(), wantRanges) {
+		t.Errorf("requests = %v, want %v", rec.ranges(), wantRanges)
+	}
+}
+
+// pages 按顺序返回续传键值，每页一条记录
+func pages(ctnkeys ...string) (caller CallerFunc, calls *int) {
+	calls = new(int)
+
+	caller = func(ctx context.Context, req models.Request, resp models.Response) error {
+		r := resp.(*models.RespGetTransInfo)
+		r.NTQTSINFZ = []models.RespGetTransInfoItem{{ETYDAT: "20240101", REFNBR: string(rune('a' + *calls))}}
+		r.CTNKEY = ctnkeys[*calls]
+		*calls++
+		return nil
+	}
+
+	return
+}
+
+func TestTransactionsContinuationLoop(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctnkeys []string
+		want    []string
+	}{
+		{"same key", []string{"k1", "k1"}, []string{"a"}},
+		{"cycle", []string{"k1", "k2", "k1"}, []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller, calls := pages(tt.ctnkeys...)
+
+			refs, err := collect(Transactions(context.Background(), caller, TransactionQuery{
+				ACCNBR: "755000001",
+				Begin:  day("20240101"),
+				End:    day("20240101"),
+			}))
+
+			// 重复的一页不返回给调用方
+			if err != ErrContinuationLoop || !reflect.DeepEqual(refs, tt.want) {
+				t.Errorf("transactions = %v, %v, want %v, %v", refs, err, tt.want, ErrContinuationLoop)
+			}
+
+			if *calls != len(tt.ctnkeys) {
+				t.Errorf("calls = %d, want %d", *calls, len(tt.ctnkeys))
+			}
+		})
+	}
+}
+
+func TestTransactionsCallError(t *testing.T) {
+	failure := errors.New("network error")
+
+	it := Transactions(context.Background(), CallerFunc(func(context.Context, models.Request, models.Response) error {
+		return failure
+	}), TransactionQuery{ACCNBR: "755000001", Begin: day("20240101"), End: day("20240101")})
+
+	if it.Next() || it.Err() != failure {
+		t.Errorf("Next = true or Err = %v, want %v", it.Err(), failure)
+	}
+}
+
+func TestTransactionQueryValidate(t *testing.T) {
+	tests := []TransactionQuery{
+		{Begin: day("20240101"), End: day("20240101")},
+		{ACCNBR: "755000001", End: day("20240101")},
+		{ACCNBR: "755000001", Begin: day("20240102"), End: day("20240101")},
+		{ACCNBR: "755000001", Begin: day("20240101"), End: day("20240101"), AMTCDR: "X"},
+	}
+
+	for _, query := range tests {
+		it := Transactions(context.Background(), nil, query)
+		if it.Next() || !errors.Is(it.Err(), ErrInvalidTransactionQuery) {
+			t.Errorf("Transactions(%+v) Err = %v, want %v", query, it.Err(), ErrInvalidTransactionQuery)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/go-akka/configuration"
+)
+
+var (
+	ErrConfigParseFailure = errors.New("parse config failure")
+)
+
+// Load 读取并解密配置文件
+func Load(password []byte, filename string) (conf *configuration.Config, format Format, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+
+	plaintext, format, err := Decrypt(password, data)
+	if err != nil {
+		return
+	}
+
+	conf, err = Parse(plaintext)
+	if err != nil && format == FormatLegacyRC4 {
+		// 旧格式无法区分密码错误与内容损坏
+		err = ErrWrongPassword
+	}
+
+	return
+}
+
+// Parse 解析HOCON内容，将解析时的panic转换为错误
+func Parse(plaintext []byte) (conf *configuration.Config, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			conf = nil
+			err = fmt.Errorf("%w: %v", ErrConfigParseFailure, r)
+		}
+	}()
+
+	conf = configuration.ParseString(string(plaintext))
+
+	if conf == nil || conf.IsEmpty() {
+		err = ErrConfigParseFailure
+		return
+	}
+
+	return
+}
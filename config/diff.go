@@ -0,0 +1,138 @@
+package config
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gogap/cmb_robot/robot"
+)
+
+type Change struct {
+	Key    string
+	Old    string
+	New    string
+	Secret bool // 密码类配置只记录发生了变化，不输出内容
+}
+
+// Diff 比较全局配置项的差异，账号的差异见 Account.Diff
+func (p *Config) Diff(newConf *Config) (global []Change) {
+	if p.Path != newConf.Path {
+		global = append(global, Change{Key: "path", Old: p.Path, New: newConf.Path})
+	}
+
+	if p.CMBVersion != newConf.CMBVersion {
+		global = append(global, Change{Key: "cmb-version", Old: p.CMBVersion, New: newConf.CMBVersion})
+	}
+
+	if p.UIProfile != newConf.UIProfile {
+		global = append(global, Change{Key: "ui-profile", Old: p.UIProfile, New: newConf.UIProfile})
+	}
+
+	if p.UIProfilesDir != newConf.UIProfilesDir {
+		global = append(global, Change{Key: "ui-profiles-dir", Old: p.UIProfilesDir, New: newConf.UIProfilesDir})
+	}
+
+	if oldArgs, newArgs := strings.Join(p.ProcessArgs, " "), strings.Join(newConf.ProcessArgs, " "); oldArgs != newArgs {
+		global = append(global, Change{Key: "process-args", Old: oldArgs, New: newArgs})
+	}
+
+	if p.ProcessDir != newConf.ProcessDir {
+		global = append(global, Change{Key: "process-dir", Old: p.ProcessDir, New: newConf.ProcessDir})
+	}
+
+	if p.ReadyTimeout != newConf.ReadyTimeout {
+		global = append(global, Change{Key: "ready-timeout", Old: p.ReadyTimeout.String(), New: newConf.ReadyTimeout.String()})
+	}
+
+	if p.CrashLimit != newConf.CrashLimit {
+		global = append(global, Change{Key: "crash-limit", Old: strconv.Itoa(p.CrashLimit), New: strconv.Itoa(newConf.CrashLimit)})
+	}
+
+	if p.CrashWindow != newConf.CrashWindow {
+		global = append(global, Change{Key: "crash-window", Old: p.CrashWindow.String(), New: newConf.CrashWindow.String()})
+	}
+
+	if p.CrashBackoff != newConf.CrashBackoff {
+		global = append(global, Change{Key: "crash-backoff", Old: p.CrashBackoff.String(), New: newConf.CrashBackoff.String()})
+	}
+
+	if p.FBSdkLogInterval != newConf.FBSdkLogInterval {
+		global = append(global, Change{Key: "fbsdk-log-interval", Old: p.FBSdkLogInterval.String(), New: newConf.FBSdkLogInterval.String()})
+	}
+
+	// profile 文件的内容变化时也需要重建机器人
+	if !reflect.DeepEqual(p.Profiles, newConf.Profiles) {
+		global = append(global, Change{Key: "ui-profiles", Old: profileNames(p.Profiles), New: profileNames(newConf.Profiles)})
+	}
+
+	return
+}
+
+func (p *Account) Diff(newAcc *Account) (changes []Change) {
+	add := func(key, oldVal, newVal string, secret bool) {
+		if oldVal == newVal {
+			return
+		}
+
+		c := Change{Key: key, Secret: secret}
+		if !secret {
+			c.Old, c.New = oldVal, newVal
+		}
+
+		changes = append(changes, c)
+	}
+
+	add("username", p.UserName, newAcc.UserName, false)
+	add("login-password", p.LoginPassword, newAcc.LoginPassword, true)
+	add("usbkey-password", p.USBKeyPassword, newAcc.USBKeyPassword, true)
+	add("url", p.URL, newAcc.URL, false)
+	add("listen-addr", p.ListenAddr, newAcc.ListenAddr, false)
+	add("system-sn", p.SystemSN, newAcc.SystemSN, false)
+	add("channel-sn", p.ChannelSN, newAcc.ChannelSN, false)
+	add("amount", strconv.FormatInt(p.Amount, 10), strconv.FormatInt(newAcc.Amount, 10), false)
+	add("status", p.Status, newAcc.Status, false)
+	add("date", p.Date, newAcc.Date, false)
+	add("canary-lookback-days", strconv.Itoa(p.CanaryLookbackDays), strconv.Itoa(newAcc.CanaryLookbackDays), false)
+	add("canary-max-age-days", strconv.Itoa(p.CanaryMaxAgeDays), strconv.Itoa(newAcc.CanaryMaxAgeDays), false)
+	add("canary-payee", p.CanaryPayee, newAcc.CanaryPayee, false)
+	add("probe", p.Probe, newAcc.Probe, false)
+	add("probe-bbknbr", strconv.Itoa(p.ProbeBBKNBR), strconv.Itoa(newAcc.ProbeBBKNBR), false)
+	add("probe-account", p.ProbeAccount, newAcc.ProbeAccount, false)
+	add("run-timeout", p.RunTimeout.String(), newAcc.RunTimeout.String(), false)
+	add("snapshot-dir", p.SnapshotDir, newAcc.SnapshotDir, false)
+	add("snapshot-keep", strconv.Itoa(p.SnapshotKeep), strconv.Itoa(newAcc.SnapshotKeep), false)
+
+	// 规则内容较长，只输出规则名
+	if !reflect.DeepEqual(p.DialogRules, newAcc.DialogRules) {
+		changes = append(changes, Change{Key: "dialog-rules", Old: dialogRuleNames(p.DialogRules), New: dialogRuleNames(newAcc.DialogRules)})
+	}
+
+	return
+}
+
+func dialogRuleNames(rules []robot.DialogRule) string {
+	names := make([]string, 0, len(rules))
+	for _, r := range rules {
+		names = append(names, r.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func profileNames(profiles []robot.Profile) string {
+	names := make([]string, 0, len(profiles))
+	for _, pf := range profiles {
+		names = append(names, pf.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+// Account 返回指定登录名的账号
+func (p *Config) Account(userName string) *Account {
+	for _, acc := range p.Accounts {
+		if acc.UserName == userName {
+			return acc
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestConfigDiff(t *testing.T) {
+	old := newTestConfig(t, validConf)
+
+	if changes := old.Diff(newTestConfig(t, validConf)); len(changes) != 0 {
+		t.Errorf("Diff of the same config = %+v", changes)
+	}
+
+	tests := []struct {
+		override string
+		want     []Change
+	}{
+		// process-dir 默认为 path 所在目录，一起变化
+		{`path: "D:\\FBSdk\\FBSdk.exe"`, []Change{
+			{Key: "path", Old: old.Path, New: `D:\FBSdk\FBSdk.exe`},
+			{Key: "process-dir", Old: old.ProcessDir, New: `D:\FBSdk\`},
+		}},
+		// 内置 profile 的主窗口标题包含 cmb-version
+		{`cmb-version: "7.0"`, []Change{
+			{Key: "cmb-version", Old: "", New: "7.0"},
+			{Key: "ui-profiles", Old: "default", New: "default"},
+		}},
+		{`ui-profile: "default"`, []Change{{Key: "ui-profile", Old: "auto", New: "default"}}},
+		{`process-args: ["-a", "-b"]`, []Change{{Key: "process-args", Old: "", New: "-a -b"}}},
+		{`process-dir: "D:\\FBSdk"`, []Change{{Key: "process-dir", Old: old.ProcessDir, New: `D:\FBSdk`}}},
+		{`ready-timeout: 5m`, []Change{{Key: "ready-timeout", Old: DefaultReadyTimeout.String(), New: "5m0s"}}},
+		{`crash-limit: 9`, []Change{{Key: "crash-limit", Old: strconv.Itoa(DefaultCrashLimit), New: "9"}}},
+		{`crash-window: 3h`, []Change{{Key: "crash-window", Old: DefaultCrashWindow.String(), New: "3h0m0s"}}},
+		{`crash-backoff: 3h`, []Change{{Key: "crash-backoff", Old: DefaultCrashBackoff.String(), New: "3h0m0s"}}},
+		{`fbsdk-log-interval: 3m`, []Change{{Key: "fbsdk-log-interval", Old: DefaultFBSdkLogInterval.String(), New: "3m0s"}}},
+	}
+
+	for _, tt := range tests {
+		changes := old.Diff(newTestConfig(t, validConf+tt.override))
+		if !reflect.DeepEqual(changes, tt.want) {
+			t.Errorf("Diff(%s) = %+v, want %+v", tt.override, changes, tt.want)
+		}
+	}
+}
+
+func TestAccountDiff(t *testing.T) {
+	old := newTestConfig(t, manualConf).Accounts[0]
+
+	if changes := old.Diff(newTestConfig(t, manualConf).Accounts[0]); len(changes) != 0 {
+		t.Errorf("Diff of the same account = %+v", changes)
+	}
+
+	tests := []struct {
+		override string
+		want     Change
+	}{
+		{`username: "u2"`, Change{Key: "username", Old: "u1", New: "u2"}},
+		{`url: "http://localhost:8080"`, Change{Key: "url", Old: "http://127.0.0.1:8080", New: "http://localhost:8080"}},
+		{`listen-addr: "0.0.0.0:8080"`, Change{Key: "listen-addr", Old: "127.0.0.1:8080", New: "0.0.0.0:8080"}},
+		{`system-sn: "S0002"`, Change{Key: "system-sn", Old: "S0001", New: "S0002"}},
+		{`channel-sn: "C0002"`, Change{Key: "channel-sn", Old: "C0001", New: "C0002"}},
+		{`amount: 2`, Change{Key: "amount", Old: "1", New: "2"}},
+		{`status: "F"`, Change{Key: "status", Old: "S", New: "F"}},
+		{`date: "20200103"`, Change{Key: "date", Old: "20200102", New: "20200103"}},
+		{`canary-lookback-days: 7`, Change{Key: "canary-lookback-days", Old: strconv.Itoa(DefaultCanaryLookbackDays), New: "7"}},
+		{`canary-max-age-days: 3`, Change{Key: "canary-max-age-days", Old: strconv.Itoa(DefaultCanaryMaxAgeDays), New: "3"}},
+		{`canary-payee: "755000002"`, Change{Key: "canary-payee", Old: "", New: "755000002"}},
+		{`probe: "none"`, Change{Key: "probe", Old: "balance", New: "none"}},
+		{`probe-bbknbr: 75`, Change{Key: "probe-bbknbr", Old: "0", New: "75"}},
+		{`probe-account: "755000002"`, Change{Key: "probe-account", Old: "755000001", New: "755000002"}},
+		{`run-timeout: 1m`, Change{Key: "run-timeout", Old: DefaultRunTimeout.String(), New: "1m0s"}},
+		{`snapshot-dir: "shots"`, Change{Key: "snapshot-dir", Old: DefaultSnapshotDir, New: "shots"}},
+		{`snapshot-keep: 1`, Change{Key: "snapshot-keep", Old: strconv.Itoa(DefaultSnapshotKeep), New: "1"}},
+		// 密码只记录发生了变化
+		{`login-password: "11111111"`, Change{Key: "login-password", Secret: true}},
+		{`usbkey-password: "22222222"`, Change{Key: "usbkey-password", Secret: true}},
+	}
+
+	for _, tt := range tests {
+		changes := old.Diff(newTestConfig(t, manualConf+tt.override).Accounts[0])
+		if len(changes) != 1 || changes[0] != tt.want {
+			t.Errorf("Diff(%s) = %+v, want %+v", tt.override, changes, tt.want)
+		}
+	}
+}
+
+func TestAccountDiffDialogRules(t *testing.T) {
+	old := newTestConfig(t, validConf).Accounts[0]
+
+	acc := newTestConfig(t, validConf+`dialog-rules: [{name: "custom", content: "请稍候", action: "dismiss", phases: ["logging-in"]}]`).Accounts[0]
+
+	changes := old.Diff(acc)
+	if len(changes) != 1 || changes[0].Key != "dialog-rules" {
+		t.Fatalf("Diff = %+v", changes)
+	}
+
+	if changes[0].Old != dialogRuleNames(old.DialogRules) || changes[0].New != dialogRuleNames(acc.DialogRules) {
+		t.Errorf("Diff = %+v, want rule names", changes[0])
+	}
+}
+
+func TestConfigAccount(t *testing.T) {
+	c := newTestConfig(t, validConf+`accounts: [{}, {username: "u2"}]`)
+
+	if acc := c.Account("u2"); acc == nil || !reflect.DeepEqual(acc, c.Accounts[1]) {
+		t.Errorf("Account(u2) = %+v", acc)
+	}
+
+	if acc := c.Account("u3"); acc != nil {
+		t.Errorf("Account(u3) = %+v", acc)
+	}
+}
@@ -0,0 +1,236 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	ErrEmptyPassword      = errors.New("config password is empty")
+	ErrWrongPassword      = errors.New("wrong config password")
+	ErrCorruptFile        = errors.New("config file is corrupt")
+	ErrUnsupportedVersion = errors.New("unsupported config file version")
+)
+
+// 加密文件格式（整体以base64保存）:
+//
+//	magic(8) | version(1) | kdf(1) | logN(1) | r(1) | p(1) | salt(16) | check(16) | nonce(12) | ciphertext
+//
+// check 为口令校验值，用于区分"密码错误"与"文件损坏"，
+// magic 到 nonce 的全部头部作为 AES-GCM 的附加认证数据。
+var envelopeMagic = []byte("CMBCONF\x00")
+
+const (
+	EnvelopeVersion byte = 1
+
+	kdfScrypt byte = 1
+
+	defaultScryptLogN = 15
+	defaultScryptR    = 8
+	defaultScryptP    = 1
+
+	// 头部未经认证，限制参数避免损坏或恶意的文件让 scrypt 耗尽内存
+	maxScryptLogN   = 22
+	maxScryptR      = 32
+	maxScryptP      = 16
+	maxScryptMemory = 1 << 30 // scrypt 需要 128*r*N 字节
+
+	saltSize  = 16
+	checkSize = 16
+	nonceSize = 12
+
+	headerSize = 8 + 1 + 1 + 3 + saltSize + checkSize + nonceSize
+)
+
+type Format int
+
+const (
+	FormatLegacyRC4 Format = 0
+	FormatEnvelope  Format = 1
+)
+
+func (p Format) String() string {
+	switch p {
+	case FormatLegacyRC4:
+		return "legacy-rc4"
+	case FormatEnvelope:
+		return "envelope-v1"
+	}
+	return "unknown"
+}
+
+// Encrypt 使用 scrypt + AES-256-GCM 加密配置内容
+func Encrypt(password, plaintext []byte) (data []byte, err error) {
+	if len(password) == 0 {
+		err = ErrEmptyPassword
+		return
+	}
+
+	header := make([]byte, headerSize)
+	copy(header, envelopeMagic)
+	header[8] = EnvelopeVersion
+	header[9] = kdfScrypt
+	header[10] = defaultScryptLogN
+	header[11] = defaultScryptR
+	header[12] = defaultScryptP
+
+	salt := header[13 : 13+saltSize]
+	nonce := header[headerSize-nonceSize:]
+
+	if _, err = io.ReadFull(rand.Reader, salt); err != nil {
+		return
+	}
+
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return
+	}
+
+	encKey, checkKey, err := deriveKeys(password, salt, defaultScryptLogN, defaultScryptR, defaultScryptP)
+	if err != nil {
+		return
+	}
+
+	copy(header[13+saltSize:], keyCheck(checkKey, header))
+
+	aead, err := newAEAD(encKey)
+	if err != nil {
+		return
+	}
+
+	sealed := aead.Seal(header, nonce, plaintext, header)
+
+	data = []byte(base64.StdEncoding.EncodeToString(sealed))
+
+	return
+}
+
+// Decrypt 解密配置文件内容，同时兼容旧的 RC4 格式
+func Decrypt(password, data []byte) (plaintext []byte, format Format, err error) {
+	if len(password) == 0 {
+		err = ErrEmptyPassword
+		return
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil {
+		err = ErrCorruptFile
+		return
+	}
+
+	if !bytes.HasPrefix(raw, envelopeMagic) {
+		format = FormatLegacyRC4
+		plaintext, err = decryptLegacy(password, raw)
+		return
+	}
+
+	format = FormatEnvelope
+	plaintext, err = openEnvelope(password, raw)
+
+	return
+}
+
+// DetectFormat 判断文件格式，不需要密码
+func DetectFormat(data []byte) (format Format, err error) {
+	raw, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil {
+		err = ErrCorruptFile
+		return
+	}
+
+	if bytes.HasPrefix(raw, envelopeMagic) {
+		return FormatEnvelope, nil
+	}
+
+	return FormatLegacyRC4, nil
+}
+
+func openEnvelope(password, raw []byte) (plaintext []byte, err error) {
+	if len(raw) < headerSize {
+		err = ErrCorruptFile
+		return
+	}
+
+	header := raw[:headerSize]
+
+	if header[8] != EnvelopeVersion {
+		err = ErrUnsupportedVersion
+		return
+	}
+
+	if header[9] != kdfScrypt {
+		err = ErrUnsupportedVersion
+		return
+	}
+
+	logN, r, p := header[10], header[11], header[12]
+	if logN == 0 || logN > maxScryptLogN || r == 0 || r > maxScryptR || p == 0 || p > maxScryptP {
+		err = ErrCorruptFile
+		return
+	}
+
+	if 128*int64(r)<<logN > maxScryptMemory {
+		err = ErrCorruptFile
+		return
+	}
+
+	salt := header[13 : 13+saltSize]
+	check := header[13+saltSize : 13+saltSize+checkSize]
+	nonce := header[headerSize-nonceSize:]
+
+	encKey, checkKey, err := deriveKeys(password, salt, logN, r, p)
+	if err != nil {
+		return
+	}
+
+	if !hmac.Equal(check, keyCheck(checkKey, header)) {
+		err = ErrWrongPassword
+		return
+	}
+
+	aead, err := newAEAD(encKey)
+	if err != nil {
+		return
+	}
+
+	plaintext, err = aead.Open(nil, nonce, raw[headerSize:], header)
+	if err != nil {
+		err = ErrCorruptFile
+		return
+	}
+
+	return
+}
+
+func deriveKeys(password, salt []byte, logN, r, p byte) (encKey, checkKey []byte, err error) {
+	key, err := scrypt.Key(password, salt, 1<<logN, int(r), int(p), 64)
+	if err != nil {
+		return
+	}
+
+	return key[:32], key[32:], nil
+}
+
+// 校验值只覆盖 check 字段之前的头部，避免自引用
+func keyCheck(checkKey, header []byte) []byte {
+	mac := hmac.New(sha256.New, checkKey)
+	mac.Write(header[:13+saltSize])
+	return mac.Sum(nil)[:checkSize]
+}
+
+func newAEAD(key []byte) (aead cipher.AEAD, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return
+	}
+
+	return cipher.NewGCMWithNonceSize(block, nonceSize)
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"crypto/rc4"
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+const testConf = `{
+	username: "u1"
+	login-password: "12345678"
+}`
+
+var testPassword = []byte("correct horse")
+
+func encrypted(t *testing.T) []byte {
+	data, err := Encrypt(testPassword, []byte(testConf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// modify 解码后修改原始内容，再重新编码
+func modify(t *testing.T, data []byte, fn func(raw []byte) []byte) []byte {
+	raw, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []byte(base64.StdEncoding.EncodeToString(fn(raw)))
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	data := encrypted(t)
+
+	plaintext, format, err := Decrypt(testPassword, data)
+	if err != nil || format != FormatEnvelope || string(plaintext) != testConf {
+		t.Fatalf("Decrypt = %q, %v, %v", plaintext, format, err)
+	}
+
+	if format, err = DetectFormat(data); err != nil || format != FormatEnvelope {
+		t.Errorf("DetectFormat = %v, %v", format, err)
+	}
+
+	// 每次加密使用新的盐和 nonce
+	if string(encrypted(t)) == string(data) {
+		t.Error("two encryptions produced the same output")
+	}
+
+	if _, err = Encrypt(nil, []byte(testConf)); err != ErrEmptyPassword {
+		t.Errorf("Encrypt with empty password = %v, want %v", err, ErrEmptyPassword)
+	}
+}
+
+func TestEnvelopeErrors(t *testing.T) {
+	data := encrypted(t)
+
+	tests := []struct {
+		name     string
+		password []byte
+		data     []byte
+		want     error
+	}{
+		{"wrong password", []byte("wrong"), data, ErrWrongPassword},
+		{"empty password", nil, data, ErrEmptyPassword},
+		{"not base64", testPassword, []byte("!!!"), ErrCorruptFile},
+		{"truncated header", testPassword, modify(t, data, func(raw []byte) []byte { return raw[:headerSize-1] }), ErrCorruptFile},
+		{"unknown version", testPassword, modify(t, data, func(raw []byte) []byte { raw[8] = 2; return raw }), ErrUnsupportedVersion},
+		{"unknown kdf", testPassword, modify(t, data, func(raw []byte) []byte { raw[9] = 2; return raw }), ErrUnsupportedVersion},
+		{"zero logN", testPassword, modify(t, data, func(raw []byte) []byte { raw[10] = 0; return raw }), ErrCorruptFile},
+		{"huge logN", testPassword, modify(t, data, func(raw []byte) []byte { raw[10] = 40; return raw }), ErrCorruptFile},
+		{"huge r", testPassword, modify(t, data, func(raw []byte) []byte { raw[11] = 255; return raw }), ErrCorruptFile},
+		{"huge p", testPassword, modify(t, data, func(raw []byte) []byte { raw[12] = 255; return raw }), ErrCorruptFile},
+		// logN 和 r 分别在范围内，但 128*r*N 为16GB
+		{"huge memory", testPassword, modify(t, data, func(raw []byte) []byte { raw[10], raw[11] = maxScryptLogN, maxScryptR; return raw }), ErrCorruptFile},
+		{"tampered nonce", testPassword, modify(t, data, func(raw []byte) []byte { raw[headerSize-1] ^= 1; return raw }), ErrCorruptFile},
+		{"tampered ciphertext", testPassword, modify(t, data, func(raw []byte) []byte { raw[len(raw)-1] ^= 1; return raw }), ErrCorruptFile},
+		{"truncated ciphertext", testPassword, modify(t, data, func(raw []byte) []byte { return raw[:len(raw)-4] }), ErrCorruptFile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plaintext, _, err := Decrypt(tt.password, tt.data)
+			if err != tt.want || plaintext != nil {
+				t.Errorf("Decrypt = %q, %v, want %v", plaintext, err, tt.want)
+			}
+		})
+	}
+}
+
+func legacyEncrypt(t *testing.T, password, plaintext []byte) []byte {
+	c, err := rc4.NewCipher(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := make([]byte, len(plaintext))
+	c.XORKeyStream(dst, plaintext)
+
+	return []byte(base64.StdEncoding.EncodeToString(dst))
+}
+
+func TestLegacyFallback(t *testing.T) {
+	dir := t.TempDir()
+
+	filename := filepath.Join(dir, "legacy.conf")
+	if err := ioutil.WriteFile(filename, legacyEncrypt(t, testPassword, []byte(testConf)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	conf, format, err := Load(testPassword, filename)
+	if err != nil || format != FormatLegacyRC4 || conf.GetString("username") != "u1" {
+		t.Fatalf("Load = %v, %v", format, err)
+	}
+
+	data, _ := ioutil.ReadFile(filename)
+	if format, err = DetectFormat(data); err != nil || format != FormatLegacyRC4 {
+		t.Errorf("DetectFormat = %v, %v", format, err)
+	}
+
+	// 旧格式无法校验密码，解出的内容无法解析时报告密码错误
+	if _, _, err = Load([]byte("wrong"), filename); err != ErrWrongPassword {
+		t.Errorf("Load with wrong password = %v, want %v", err, ErrWrongPassword)
+	}
+}
+
+func TestLoadEnvelope(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "cmb-robot.conf")
+	if err := ioutil.WriteFile(filename, encrypted(t), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	conf, format, err := Load(testPassword, filename)
+	if err != nil || format != FormatEnvelope || conf.GetString("login-password") != "12345678" {
+		t.Fatalf("Load = %v, %v", format, err)
+	}
+
+	if _, _, err = Load([]byte("wrong"), filename); err != ErrWrongPassword {
+		t.Errorf("Load with wrong password = %v, want %v", err, ErrWrongPassword)
+	}
+}
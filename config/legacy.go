@@ -0,0 +1,28 @@
+package config
+
+import (
+	"crypto/rc4"
+	"unicode/utf8"
+)
+
+// 旧格式: base64(RC4(password, plaintext))，没有盐和完整性校验，
+// 只保留读取能力，用于原地迁移。
+func decryptLegacy(password, src []byte) (plaintext []byte, err error) {
+	c, err := rc4.NewCipher(password)
+	if err != nil {
+		err = ErrWrongPassword
+		return
+	}
+
+	dst := make([]byte, len(src))
+
+	c.XORKeyStream(dst, src)
+
+	// RC4 无法校验密码，错误的密码基本会解出非法的UTF-8内容
+	if !utf8.Valid(dst) {
+		err = ErrWrongPassword
+		return
+	}
+
+	return dst, nil
+}
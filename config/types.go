@@ -0,0 +1,210 @@
+package config
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/go-akka/configuration/hocon"
+	"github.com/gogap/cmb_robot/monitor"
+	"github.com/gogap/cmb_robot/robot"
+)
+
+const (
+	DefaultPath       = robot.DefaultPath
+	DefaultListenAddr = robot.DefaultListenAddr
+
+	DefaultCanaryLookbackDays = monitor.DefaultCanaryLookbackDays
+	DefaultCanaryMaxAgeDays   = monitor.DefaultCanaryMaxAgeDays
+
+	DefaultRunTimeout = robot.DefaultRunTimeout
+
+	DefaultSnapshotDir  = robot.DefaultSnapshotDir
+	DefaultSnapshotKeep = robot.DefaultSnapshotKeep
+
+	DefaultFBSdkLogInterval = robot.DefaultFBSdkLogInterval
+
+	DefaultReadyTimeout = robot.DefaultReadyTimeout
+	DefaultCrashLimit   = robot.DefaultCrashLimit
+	DefaultCrashWindow  = robot.DefaultCrashWindow
+	DefaultCrashBackoff = robot.DefaultCrashBackoff
+)
+
+var (
+	ErrAccountNotObject = errors.New("account must be an object")
+)
+
+// Config 为 cmb-robot.conf 的类型化表示
+type Config struct {
+	Path       string
+	CMBVersion string
+	Accounts   []*Account
+
+	// UIProfile FBSdk 界面 profile 的名称，auto 按主窗口标题自动识别
+	UIProfile     string
+	UIProfilesDir string
+	// Profiles 内置 profile 和 UIProfilesDir 中的 profile
+	Profiles []robot.Profile
+
+	// FBSdkLogInterval 检查 FBSdk 日志列表的间隔，新增的日志写入日志文件，为0时不检查
+	FBSdkLogInterval time.Duration
+
+	// 启动 FBSdk 的参数和工作目录（默认为 Path 所在目录），启动后等待主窗口出现的时间
+	ProcessArgs  []string
+	ProcessDir   string
+	ReadyTimeout time.Duration
+
+	// FBSdk 在 CrashWindow 内意外退出 CrashLimit 次后，暂停重启 CrashBackoff，CrashLimit 为0时不限制
+	CrashLimit   int
+	CrashWindow  time.Duration
+	CrashBackoff time.Duration
+
+	loadErr    error
+	profileErr error
+}
+
+// Account 单个企业登录名的凭据与探测交易
+type Account struct {
+	Key string // 在配置文件中的位置，如 accounts[0]
+
+	UserName       string
+	LoginPassword  string
+	USBKeyPassword string
+	URL            string
+	ListenAddr     string
+	SystemSN       string
+	ChannelSN      string
+	Amount         int64
+	Status         string
+	Date           string
+
+	// 没有手动配置探测交易时，在最近 CanaryLookbackDays 天内自动选取一笔已完成的支付，
+	// 超过 CanaryMaxAgeDays 天后重新选取
+	CanaryLookbackDays int
+	CanaryMaxAgeDays   int
+	CanaryPayee        string // 只选取付给该收方账号的支付
+
+	// 签名检查，未配置时为 balance，查询 ProbeAccount 的余额，此时 ProbeAccount 必须填写
+	Probe        string
+	ProbeBBKNBR  int
+	ProbeAccount string
+
+	// RunTimeout 机器人单次恢复（重启、监听、登录）的时间预算
+	RunTimeout time.Duration
+
+	// 机器人恢复失败时在 SnapshotDir 中保存窗口快照，只保留最新的 SnapshotKeep 个，为0时不保存
+	SnapshotDir  string
+	SnapshotKeep int
+
+	// DialogRules 弹窗处理规则，包含内置规则
+	DialogRules []robot.DialogRule
+
+	dialogErr error
+}
+
+// ManualCanary 是否手动配置了探测交易
+func (p *Account) ManualCanary() bool {
+	return len(p.SystemSN) > 0 || len(p.ChannelSN) > 0 || len(p.Date) > 0
+}
+
+func New(conf *configuration.Config) *Config {
+	c := &Config{
+		Path:       conf.GetString("path", DefaultPath),
+		CMBVersion: conf.GetString("cmb-version", ""),
+
+		UIProfile:     conf.GetString("ui-profile", robot.ProfileAuto),
+		UIProfilesDir: conf.GetString("ui-profiles-dir"),
+
+		FBSdkLogInterval: conf.GetTimeDuration("fbsdk-log-interval", DefaultFBSdkLogInterval),
+
+		ProcessArgs:  conf.GetStringList("process-args"),
+		ReadyTimeout: conf.GetTimeDuration("ready-timeout", DefaultReadyTimeout),
+		CrashLimit:   int(conf.GetInt32("crash-limit", DefaultCrashLimit)),
+		CrashWindow:  conf.GetTimeDuration("crash-window", DefaultCrashWindow),
+		CrashBackoff: conf.GetTimeDuration("crash-backoff", DefaultCrashBackoff),
+	}
+
+	c.ProcessDir = conf.GetString("process-dir", robot.DefaultProcessDir(c.Path))
+
+	c.Profiles, c.profileErr = robot.LoadProfiles(c.UIProfilesDir, c.CMBVersion)
+	if c.profileErr == nil {
+		_, c.profileErr = robot.FindProfile(c.Profiles, c.UIProfile)
+	}
+
+	accConfs, err := AccountConfigs(conf)
+	if err != nil {
+		c.loadErr = err
+		return c
+	}
+
+	for i, accConf := range accConfs {
+		acc := NewAccount(accConf)
+		if conf.IsArray("accounts") {
+			acc.Key = "accounts[" + strconv.Itoa(i) + "]"
+		}
+		c.Accounts = append(c.Accounts, acc)
+	}
+
+	return c
+}
+
+func NewAccount(conf *configuration.Config) *Account {
+	acc := &Account{
+		UserName:       conf.GetString("username"),
+		LoginPassword:  conf.GetString("login-password"),
+		USBKeyPassword: conf.GetString("usbkey-password"),
+		URL:            conf.GetString("url"),
+		ListenAddr:     conf.GetString("listen-addr", DefaultListenAddr),
+		SystemSN:       conf.GetString("system-sn"),
+		ChannelSN:      conf.GetString("channel-sn"),
+		Amount:         conf.GetInt64("amount"),
+		Status:         conf.GetString("status"),
+		Date:           conf.GetString("date"),
+
+		CanaryLookbackDays: int(conf.GetInt32("canary-lookback-days", DefaultCanaryLookbackDays)),
+		CanaryMaxAgeDays:   int(conf.GetInt32("canary-max-age-days", DefaultCanaryMaxAgeDays)),
+		CanaryPayee:        conf.GetString("canary-payee"),
+
+		Probe:        conf.GetString("probe", monitor.DefaultProbe),
+		ProbeBBKNBR:  int(conf.GetInt32("probe-bbknbr")),
+		ProbeAccount: conf.GetString("probe-account"),
+
+		RunTimeout: conf.GetTimeDuration("run-timeout", DefaultRunTimeout),
+
+		SnapshotDir:  conf.GetString("snapshot-dir", DefaultSnapshotDir),
+		SnapshotKeep: int(conf.GetInt32("snapshot-keep", DefaultSnapshotKeep)),
+	}
+
+	acc.DialogRules, acc.dialogErr = robot.LoadDialogRules(conf)
+
+	return acc
+}
+
+// AccountConfigs 返回每个账号的配置，顶层配置项作为各账号的默认值。
+// 没有 accounts 数组时，整个配置文件即为唯一的账号。
+func AccountConfigs(conf *configuration.Config) (accConfs []*configuration.Config, err error) {
+	if !conf.HasPath("accounts") {
+		return []*configuration.Config{conf}, nil
+	}
+
+	// 空数组不是数组，不能当作没有配置 accounts
+	if !conf.IsArray("accounts") {
+		err = &FieldError{Key: "accounts", Err: ErrNoAccounts}
+		return
+	}
+
+	for i, v := range conf.GetValue("accounts").GetArray() {
+		if !v.IsObject() {
+			err = &FieldError{Key: "accounts[" + strconv.Itoa(i) + "]", Err: ErrAccountNotObject}
+			return
+		}
+
+		// WithFallback 合并时会丢掉账号自己的配置项，Copy 只设置 fallback，
+		// 账号中没有的配置项才从顶层读取
+		accConf := configuration.NewConfigFromRoot(hocon.NewHoconRoot(v)).Copy(conf)
+		accConfs = append(accConfs, accConf)
+	}
+
+	return
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestAccountConfigs(t *testing.T) {
+	c := newTestConfig(t, validConf+`
+accounts: [
+	{}
+	{
+		username: "u2"
+		listen-addr: "127.0.0.1:8081"
+		url: "http://127.0.0.1:8081"
+		dialog-rules: [{name: "custom", content: "请稍候", action: "dismiss", phases: ["logging-in"]}]
+	}
+]`)
+
+	if len(c.Accounts) != 2 {
+		t.Fatalf("Accounts = %+v", c.Accounts)
+	}
+
+	// 没有配置的项使用顶层的值
+	u1 := c.Accounts[0]
+	if u1.Key != "accounts[0]" || u1.UserName != "u1" || u1.ListenAddr != "127.0.0.1:8080" || u1.ProbeAccount != "755000001" {
+		t.Errorf("accounts[0] = %+v", u1)
+	}
+
+	// 账号自己的配置项优先于顶层
+	u2 := c.Accounts[1]
+	if u2.Key != "accounts[1]" || u2.UserName != "u2" || u2.ListenAddr != "127.0.0.1:8081" || u2.URL != "http://127.0.0.1:8081" {
+		t.Errorf("accounts[1] = %+v", u2)
+	}
+
+	if u2.LoginPassword != "12345678" || u2.ProbeAccount != "755000001" {
+		t.Errorf("accounts[1] does not fall back to the top level: %+v", u2)
+	}
+
+	if u2.dialogErr != nil || u2.DialogRules[0].Name != "custom" || u1.DialogRules[0].Name == "custom" {
+		t.Errorf("dialog-rules = %+v, %+v, %v", u1.DialogRules, u2.DialogRules, u2.dialogErr)
+	}
+
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate = %v", err)
+	}
+}
+
+func TestAccountConfigsSingle(t *testing.T) {
+	c := newTestConfig(t, validConf)
+
+	if len(c.Accounts) != 1 || c.Accounts[0].Key != "" || c.Accounts[0].UserName != "u1" {
+		t.Errorf("Accounts = %+v", c.Accounts)
+	}
+}
@@ -0,0 +1,295 @@
+package config
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gogap/cmb_robot/monitor"
+	"github.com/gogap/cmb_robot/monitor/models"
+	"github.com/gogap/cmb_robot/robot"
+)
+
+var (
+	ErrRequired          = errors.New("is required")
+	ErrBadLength         = errors.New("length must be 8")
+	ErrNotPositive       = errors.New("must be greater than zero")
+	ErrBadDate           = errors.New("must be a valid date in YYYYMMDD format")
+	ErrUnknownStatus     = errors.New("unknown RTNFLG status")
+	ErrBadURL            = errors.New("must be an http url with host and port")
+	ErrBadListenAddr     = errors.New("must be in host:port format")
+	ErrEndpointMismatch  = errors.New("url and listen-addr point to different FBSdk endpoints")
+	ErrNoAccounts        = errors.New("at least one account is required")
+	ErrDuplicateUserName = errors.New("username is used by more than one account")
+	ErrLookbackTooLong   = errors.New("exceeds the GetPaymentInfo query range")
+	ErrUnknownProbe      = errors.New("unknown probe kind")
+	ErrNegative          = errors.New("must not be negative")
+)
+
+// 招行业务处理结果 RTNFLG
+var RTNFLGs = models.RTNFLGs
+
+type FieldError struct {
+	Key string
+	Err error
+}
+
+func (p *FieldError) Error() string {
+	return p.Key + ": " + p.Err.Error()
+}
+
+func (p *FieldError) Unwrap() error {
+	return p.Err
+}
+
+// Errors 收集全部校验错误
+type Errors []error
+
+func (p Errors) Error() string {
+	var msgs []string
+	for _, e := range p {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate 检查全部配置项，返回 Errors 或 nil
+func (p *Config) Validate() error {
+	var errs Errors
+
+	add := func(key string, err error) {
+		errs = append(errs, &FieldError{Key: key, Err: err})
+	}
+
+	if len(p.Path) == 0 {
+		add("path", ErrRequired)
+	}
+
+	if p.profileErr != nil {
+		key := "ui-profiles-dir"
+		if errors.Is(p.profileErr, robot.ErrProfileNotFound) {
+			key = "ui-profile"
+		}
+		add(key, p.profileErr)
+	}
+
+	if p.FBSdkLogInterval < 0 {
+		add("fbsdk-log-interval", ErrNegative)
+	}
+
+	if p.ReadyTimeout <= 0 {
+		add("ready-timeout", ErrNotPositive)
+	}
+
+	if p.CrashLimit < 0 {
+		add("crash-limit", ErrNegative)
+	} else if p.CrashLimit > 0 {
+		if p.CrashWindow <= 0 {
+			add("crash-window", ErrNotPositive)
+		}
+		if p.CrashBackoff <= 0 {
+			add("crash-backoff", ErrNotPositive)
+		}
+	}
+
+	if p.loadErr != nil {
+		errs = append(errs, p.loadErr)
+	} else if len(p.Accounts) == 0 {
+		add("accounts", ErrNoAccounts)
+	}
+
+	userNames := map[string]bool{}
+
+	for _, acc := range p.Accounts {
+		errs = append(errs, acc.validate()...)
+
+		if len(acc.UserName) == 0 {
+			continue
+		}
+
+		if userNames[acc.UserName] {
+			errs = append(errs, &FieldError{Key: acc.key("username"), Err: ErrDuplicateUserName})
+		}
+
+		userNames[acc.UserName] = true
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+func (p *Account) key(name string) string {
+	if len(p.Key) == 0 {
+		return name
+	}
+	return p.Key + "." + name
+}
+
+func (p *Account) validate() (errs Errors) {
+	add := func(name string, err error) {
+		errs = append(errs, &FieldError{Key: p.key(name), Err: err})
+	}
+
+	if len(p.UserName) == 0 {
+		add("username", ErrRequired)
+	}
+
+	if len(p.LoginPassword) == 0 {
+		add("login-password", ErrRequired)
+	} else if len(p.LoginPassword) != 8 {
+		add("login-password", ErrBadLength)
+	}
+
+	if len(p.USBKeyPassword) == 0 {
+		add("usbkey-password", ErrRequired)
+	} else if len(p.USBKeyPassword) != 8 {
+		add("usbkey-password", ErrBadLength)
+	}
+
+	urlHost, urlPort, urlErr := splitURL(p.URL)
+	if len(p.URL) == 0 {
+		add("url", ErrRequired)
+	} else if urlErr != nil {
+		add("url", ErrBadURL)
+	}
+
+	listenHost, listenPort, listenErr := net.SplitHostPort(p.ListenAddr)
+	if len(p.ListenAddr) == 0 {
+		add("listen-addr", ErrRequired)
+	} else if listenErr != nil || len(listenPort) == 0 {
+		add("listen-addr", ErrBadListenAddr)
+	}
+
+	if len(p.URL) > 0 && urlErr == nil && len(p.ListenAddr) > 0 && listenErr == nil {
+		if urlPort != listenPort || !sameHost(urlHost, listenHost) {
+			add("url", ErrEndpointMismatch)
+		}
+	}
+
+	if p.dialogErr != nil {
+		add("dialog-rules", p.dialogErr)
+	}
+
+	if p.RunTimeout <= 0 {
+		add("run-timeout", ErrNotPositive)
+	}
+
+	if p.SnapshotKeep < 0 {
+		add("snapshot-keep", ErrNegative)
+	} else if p.SnapshotKeep > 0 && len(p.SnapshotDir) == 0 {
+		add("snapshot-dir", ErrRequired)
+	}
+
+	if len(p.Probe) > 0 {
+		if _, exist := monitor.ProbeKinds[p.Probe]; !exist {
+			add("probe", ErrUnknownProbe)
+		}
+	}
+
+	if (p.Probe == monitor.ProbeBalance || len(p.Probe) == 0) && len(p.ProbeAccount) == 0 {
+		add("probe-account", ErrRequired)
+	}
+
+	if !p.ManualCanary() {
+		if p.CanaryLookbackDays <= 0 {
+			add("canary-lookback-days", ErrNotPositive)
+		} else if p.CanaryLookbackDays > models.GetPaymentInfoMaxDays {
+			add("canary-lookback-days", ErrLookbackTooLong)
+		}
+
+		if p.CanaryMaxAgeDays <= 0 {
+			add("canary-max-age-days", ErrNotPositive)
+		}
+
+		return
+	}
+
+	if len(p.SystemSN) == 0 {
+		add("system-sn", ErrRequired)
+	}
+
+	if len(p.ChannelSN) == 0 {
+		add("channel-sn", ErrRequired)
+	}
+
+	if p.Amount <= 0 {
+		add("amount", ErrNotPositive)
+	}
+
+	if len(p.Status) == 0 {
+		add("status", ErrRequired)
+	} else if _, exist := RTNFLGs[p.Status]; !exist {
+		add("status", ErrUnknownStatus)
+	}
+
+	if len(p.Date) == 0 {
+		add("date", ErrRequired)
+	} else if !validDate(p.Date) {
+		add("date", ErrBadDate)
+	}
+
+	return
+}
+
+func validDate(date string) bool {
+	if len(date) != 8 {
+		return false
+	}
+
+	_, err := time.Parse("20060102", date)
+
+	return err == nil
+}
+
+func splitURL(rawURL string) (host, port string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return
+	}
+
+	if u.Scheme != "http" || len(u.Host) == 0 {
+		err = ErrBadURL
+		return
+	}
+
+	host, port = u.Hostname(), u.Port()
+	if len(port) == 0 {
+		port = "80"
+	}
+
+	return
+}
+
+// 监听地址为空或0.0.0.0时，任何本机地址都可以访问
+func sameHost(urlHost, listenHost string) bool {
+	if urlHost == listenHost || isAny(listenHost) {
+		return true
+	}
+
+	return isLoopback(urlHost) && isLoopback(listenHost)
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+func isAny(host string) bool {
+	if len(host) == 0 {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsUnspecified()
+}
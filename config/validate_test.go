@@ -0,0 +1,149 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// validConf 自动选取探测交易的最小有效配置
+const validConf = `
+path: "C:\\FBSdk\\FBSdk.exe"
+username: "u1"
+login-password: "12345678"
+usbkey-password: "87654321"
+url: "http://127.0.0.1:8080"
+listen-addr: "127.0.0.1:8080"
+probe-account: "755000001"
+`
+
+// manualConf 手动配置探测交易
+const manualConf = validConf + `
+system-sn: "S0001"
+channel-sn: "C0001"
+amount: 1
+status: "S"
+date: "20200102"
+`
+
+func newTestConfig(t *testing.T, text string) *Config {
+	conf, err := Parse([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(conf)
+}
+
+func TestValidateValid(t *testing.T) {
+	for _, text := range []string{validConf, manualConf} {
+		if err := newTestConfig(t, text).Validate(); err != nil {
+			t.Errorf("Validate = %v", err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		conf     string
+		override string
+		key      string
+		err      error
+		msg      string
+	}{
+		{"empty path", validConf, `path: ""`, "path", ErrRequired, "path: is required"},
+		{"unknown ui-profile", validConf, `ui-profile: "v9"`, "ui-profile", nil, ""},
+		{"zero ready-timeout", validConf, `ready-timeout: 0s`, "ready-timeout", ErrNotPositive, "ready-timeout: must be greater than zero"},
+		{"negative crash-limit", validConf, `crash-limit: -1`, "crash-limit", ErrNegative, "crash-limit: must not be negative"},
+		{"zero crash-window", validConf, `crash-window: 0s`, "crash-window", ErrNotPositive, "crash-window: must be greater than zero"},
+		{"zero crash-backoff", validConf, `crash-backoff: 0s`, "crash-backoff", ErrNotPositive, "crash-backoff: must be greater than zero"},
+		{"no accounts", validConf, `accounts: []`, "accounts", ErrNoAccounts, "accounts: at least one account is required"},
+		{"accounts not array", validConf, `accounts: "u1"`, "accounts", ErrNoAccounts, "accounts: at least one account is required"},
+		{"account not object", validConf, `accounts: ["u1"]`, "accounts[0]", ErrAccountNotObject, "accounts[0]: account must be an object"},
+		{"duplicate username", validConf, `accounts: [{}, {}]`, "accounts[1].username", ErrDuplicateUserName, "accounts[1].username: username is used by more than one account"},
+		{"empty username", validConf, `username: ""`, "username", ErrRequired, "username: is required"},
+		{"empty login-password", validConf, `login-password: ""`, "login-password", ErrRequired, "login-password: is required"},
+		{"short login-password", validConf, `login-password: "1234"`, "login-password", ErrBadLength, "login-password: length must be 8"},
+		{"empty usbkey-password", validConf, `usbkey-password: ""`, "usbkey-password", ErrRequired, "usbkey-password: is required"},
+		{"long usbkey-password", validConf, `usbkey-password: "123456789"`, "usbkey-password", ErrBadLength, "usbkey-password: length must be 8"},
+		{"empty url", validConf, `url: ""`, "url", ErrRequired, "url: is required"},
+		{"https url", validConf, `url: "https://127.0.0.1:8080"`, "url", ErrBadURL, "url: must be an http url with host and port"},
+		{"bad listen-addr", validConf, `listen-addr: "8080"`, "listen-addr", ErrBadListenAddr, "listen-addr: must be in host:port format"},
+		{"endpoint port mismatch", validConf, `listen-addr: "127.0.0.1:9090"`, "url", ErrEndpointMismatch, "url: url and listen-addr point to different FBSdk endpoints"},
+		{"endpoint host mismatch", validConf, `url: "http://10.0.0.1:8080"`, "url", ErrEndpointMismatch, "url: url and listen-addr point to different FBSdk endpoints"},
+		{"bad dialog-rules", validConf, `dialog-rules: "close"`, "dialog-rules", nil, ""},
+		{"zero run-timeout", validConf, `run-timeout: 0s`, "run-timeout", ErrNotPositive, "run-timeout: must be greater than zero"},
+		{"negative snapshot-keep", validConf, `snapshot-keep: -1`, "snapshot-keep", ErrNegative, "snapshot-keep: must not be negative"},
+		{"empty snapshot-dir", validConf, `snapshot-dir: ""`, "snapshot-dir", ErrRequired, "snapshot-dir: is required"},
+		{"unknown probe", validConf, `probe: "ping"`, "probe", ErrUnknownProbe, "probe: unknown probe kind"},
+		{"empty probe-account", validConf, `probe-account: ""`, "probe-account", ErrRequired, "probe-account: is required"},
+		{"zero canary-lookback-days", validConf, `canary-lookback-days: 0`, "canary-lookback-days", ErrNotPositive, "canary-lookback-days: must be greater than zero"},
+		{"long canary-lookback-days", validConf, `canary-lookback-days: 101`, "canary-lookback-days", ErrLookbackTooLong, "canary-lookback-days: exceeds the GetPaymentInfo query range"},
+		{"zero canary-max-age-days", validConf, `canary-max-age-days: 0`, "canary-max-age-days", ErrNotPositive, "canary-max-age-days: must be greater than zero"},
+		{"empty system-sn", manualConf, `system-sn: ""`, "system-sn", ErrRequired, "system-sn: is required"},
+		{"empty channel-sn", manualConf, `channel-sn: ""`, "channel-sn", ErrRequired, "channel-sn: is required"},
+		{"zero amount", manualConf, `amount: 0`, "amount", ErrNotPositive, "amount: must be greater than zero"},
+		{"empty status", manualConf, `status: ""`, "status", ErrRequired, "status: is required"},
+		{"unknown status", manualConf, `status: "X"`, "status", ErrUnknownStatus, "status: unknown RTNFLG status"},
+		{"empty date", manualConf, `date: ""`, "date", ErrRequired, "date: is required"},
+		{"bad date", manualConf, `date: "20201301"`, "date", ErrBadDate, "date: must be a valid date in YYYYMMDD format"},
+		{"short date", manualConf, `date: "202001"`, "date", ErrBadDate, "date: must be a valid date in YYYYMMDD format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newTestConfig(t, tt.conf+tt.override).Validate()
+
+			var errs Errors
+			if !errors.As(err, &errs) || len(errs) != 1 {
+				t.Fatalf("Validate = %v, want one error for %s", err, tt.key)
+			}
+
+			var fieldErr *FieldError
+			if !errors.As(errs[0], &fieldErr) || fieldErr.Key != tt.key {
+				t.Fatalf("Validate = %v, want an error for %s", err, tt.key)
+			}
+
+			if tt.err != nil && !errors.Is(errs[0], tt.err) {
+				t.Errorf("Validate = %v, want %v", err, tt.err)
+			}
+
+			if len(tt.msg) > 0 && err.Error() != tt.msg {
+				t.Errorf("Validate message = %q, want %q", err.Error(), tt.msg)
+			}
+		})
+	}
+}
+
+// HOCON 中的时长不能为负数，直接设置字段检查
+func TestValidateNegativeLogInterval(t *testing.T) {
+	c := newTestConfig(t, validConf)
+	c.FBSdkLogInterval = -time.Second
+
+	if err := c.Validate(); err == nil || err.Error() != "fbsdk-log-interval: must not be negative" {
+		t.Errorf("Validate = %v", err)
+	}
+}
+
+func TestValidateCollectsAllErrors(t *testing.T) {
+	err := newTestConfig(t, `path: "", accounts: [{username: "u1"}, {username: "u1"}]`).Validate()
+
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Validate = %v", err)
+	}
+
+	keys := map[string]bool{}
+	for _, e := range errs {
+		var fieldErr *FieldError
+		if errors.As(e, &fieldErr) {
+			keys[fieldErr.Key] = true
+		}
+	}
+
+	for _, key := range []string{"path", "accounts[0].login-password", "accounts[1].url", "accounts[1].username"} {
+		if !keys[key] {
+			t.Errorf("Validate = %v, missing %s", err, key)
+		}
+	}
+}
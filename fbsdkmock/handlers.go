@@ -0,0 +1,181 @@
+package fbsdkmock
+
+import (
+	"encoding/xml"
+
+	"github.com/gogap/cmb_robot/monitor/models"
+)
+
+// Balance 账户余额
+type Balance struct {
+	BBKNBR int
+	ACCNBR string
+	ACCBLV models.Amount // 上日余额
+	ONLBLV models.Amount // 联机余额
+	HLDBLV models.Amount // 冻结余额
+	AVLBLV models.Amount // 可用余额
+}
+
+// AddPayment 添加一条可通过 GetPaymentInfo 查询到的支付记录
+func (p *Server) AddPayment(item models.RespGetPaymentInfoListItem) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.payments = append(p.payments, item)
+}
+
+func (p *Server) Payments() []models.RespGetPaymentInfoListItem {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]models.RespGetPaymentInfoListItem(nil), p.payments...)
+}
+
+// UpdatePayment 修改指定业务参考号的支付状态，模拟银行处理过程
+func (p *Server) UpdatePayment(yurref, reqsts, rtnflg, rtnnar string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := range p.payments {
+		if p.payments[i].YURREF == yurref {
+			p.payments[i].REQSTS = reqsts
+			p.payments[i].RTNFLG = rtnflg
+			p.payments[i].RTNNAR = rtnnar
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Server) SetBalance(b Balance) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.balances[b.ACCNBR] = b
+}
+
+func handleGetPaymentInfo(s *Server, lgnnam string, body []byte) (resp interface{}, e *Error) {
+	req := models.ReqGetPaymentInfo{}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		return nil, &Error{RETCOD: models.RETCODBadFormat, ERRMSG: "数据格式错误"}
+	}
+
+	if len(req.BGNDAT) != 8 || len(req.ENDDAT) != 8 || req.BGNDAT > req.ENDDAT {
+		return nil, &Error{RETCOD: models.RETCODFailure, ERRMSG: "期望日期错误"}
+	}
+
+	s.mu.Lock()
+	var items []models.RespGetPaymentInfoListItem
+	for _, item := range s.payments {
+		if item.OPRDAT < req.BGNDAT || item.OPRDAT > req.ENDDAT {
+			continue
+		}
+
+		if len(req.YURREF) > 0 && item.YURREF != req.YURREF {
+			continue
+		}
+
+		items = append(items, item)
+	}
+	extra := s.scenario.ExtraRecords
+	s.mu.Unlock()
+
+	if len(items) > 0 {
+		for i := 0; i < extra; i++ {
+			items = append(items, items[0])
+		}
+	}
+
+	return &models.RespGetPaymentInfo{
+		RespBasicInfo: models.RespBasicInfo{FUNNAM: req.FUNNAM, DATTYP: 2},
+		NTQPAYQYZ:     items,
+	}, nil
+}
+
+func handleDirectPayment(s *Server, lgnnam string, body []byte) (resp interface{}, e *Error) {
+	req := models.ReqDirectPayment{}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		return nil, &Error{RETCOD: models.RETCODBadFormat, ERRMSG: "数据格式错误"}
+	}
+
+	result := &models.RespDirectPayment{
+		RespBasicInfo: models.RespBasicInfo{FUNNAM: req.FUNNAM, DATTYP: 2},
+		YURREF:        req.YURREF,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, item := range s.payments {
+		if item.YURREF == req.YURREF {
+			result.ERRCOD = "CSAC006"
+			result.ERRTXT = "业务参考号重复"
+			result.REQSTS = "FIN"
+			result.RTNFLG = "F"
+			return result, nil
+		}
+	}
+
+	if _, exist := s.balances[req.DBTACC]; !exist {
+		result.ERRCOD = "CSAC001"
+		result.ERRTXT = "付方账号不存在"
+		result.REQSTS = "FIN"
+		result.RTNFLG = "F"
+		return result, nil
+	}
+
+	result.ERRCOD = "SUC0000"
+	result.REQNBR = s.nextReqNbr()
+	result.REQSTS = "BNK"
+
+	s.payments = append(s.payments, models.RespGetPaymentInfoListItem{
+		CRTACC: req.CRTACC,
+		CRTNAM: req.CRTNAM,
+		CRTBNK: req.CRTBNK,
+		CRTADR: req.CRTADR,
+		TRSAMT: req.TRSAMT,
+		BNKFLG: req.BNKFLG,
+		STLCHN: req.STLCHN,
+		NUSAGE: req.NUSAGE,
+		OPRDAT: result.REQNBR[:8],
+		YURREF: req.YURREF,
+		REQNBR: result.REQNBR,
+		REQSTS: result.REQSTS,
+	})
+
+	return result, nil
+}
+
+func handleGetAccInfo(s *Server, lgnnam string, body []byte) (resp interface{}, e *Error) {
+	req := models.ReqGetBalanceInfo{}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		return nil, &Error{RETCOD: models.RETCODBadFormat, ERRMSG: "数据格式错误"}
+	}
+
+	result := &models.RespGetBalanceInfo{
+		RespBasicInfo: models.RespBasicInfo{FUNNAM: req.FUNNAM, DATTYP: 2},
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, acc := range req.SDKACINFX {
+		b, exist := s.balances[acc.ACCNBR]
+		if !exist || b.BBKNBR != acc.BBKNBR {
+			return nil, &Error{RETCOD: models.RETCODFailure, ERRMSG: "账号" + acc.ACCNBR + "不存在"}
+		}
+
+		result.NTQACINFZ = append(result.NTQACINFZ, models.RespGetBalanceInfoItem{
+			BBKNBR: b.BBKNBR,
+			ACCNBR: b.ACCNBR,
+			CCYNBR: string(models.CNY),
+			ACCBLV: b.ACCBLV,
+			ONLBLV: b.ONLBLV,
+			HLDBLV: b.HLDBLV,
+			AVLBLV: b.AVLBLV,
+		})
+	}
+
+	return result, nil
+}
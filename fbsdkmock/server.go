@@ -0,0 +1,254 @@
+// Package fbsdkmock 模拟 FBSdk 的HTTP监听，使用与真实客户端相同的GBK编码XML协议，
+// 用于在没有Windows客户端和USBKey的环境中进行端到端测试
+package fbsdkmock
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogap/cmb_robot/monitor/models"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/transform"
+)
+
+// Scenario 描述服务端的异常情况，可以随时切换
+type Scenario struct {
+	NotLoggedIn    bool          // 全部请求返回"尚未登录系统"
+	SignatureError bool          // 需要签名的请求（DCPAYMNT、GetAccInfo）返回签名错误
+	Delay          time.Duration // 每个请求的响应延迟，大于客户端超时即可模拟超时
+	Drop           bool          // 不返回任何内容直接断开连接
+	ExtraRecords   int           // 查询类请求额外返回的重复记录数，模拟数量不符
+
+	// Errors 按 FUNNAM 返回指定的 RETCOD/ERRMSG
+	Errors map[string]Error
+}
+
+type Error struct {
+	RETCOD int64
+	ERRMSG string
+}
+
+type Handler func(s *Server, lgnnam string, body []byte) (resp interface{}, err *Error)
+
+type Request struct {
+	FUNNAM string
+	LGNNAM string
+	Body   string
+	Time   time.Time
+}
+
+type Server struct {
+	mu sync.Mutex
+
+	scenario Scenario
+	handlers map[string]Handler
+	requests []Request
+
+	payments     []models.RespGetPaymentInfoListItem
+	balances     map[string]Balance
+	transactions []transaction
+	pageSize     int
+
+	reqSeq int
+}
+
+func New() *Server {
+	s := &Server{
+		handlers: make(map[string]Handler),
+		balances: make(map[string]Balance),
+	}
+
+	s.Handle("GetPaymentInfo", handleGetPaymentInfo)
+	s.Handle("DCPAYMNT", handleDirectPayment)
+	s.Handle("GetAccInfo", handleGetAccInfo)
+	s.Handle("GetTransInfo", handleGetTransInfo)
+
+	return s
+}
+
+// Handle 注册或替换某个 FUNNAM 的处理函数
+func (p *Server) Handle(funnam string, h Handler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.handlers[funnam] = h
+}
+
+func (p *Server) SetScenario(s Scenario) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.scenario = s
+}
+
+func (p *Server) Scenario() Scenario {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.scenario
+}
+
+// Requests 返回收到的全部请求
+func (p *Server) Requests() []Request {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]Request(nil), p.requests...)
+}
+
+// ListenAndServe 在 addr 上监听，返回实际监听的地址与关闭函数
+func (p *Server) ListenAndServe(addr string) (listenAddr string, closeFn func() error, err error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return
+	}
+
+	srv := &http.Server{Handler: p}
+
+	go srv.Serve(l)
+
+	return l.Addr().String(), srv.Close, nil
+}
+
+func (p *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	scenario := p.Scenario()
+
+	if scenario.Delay > 0 {
+		select {
+		case <-time.After(scenario.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if scenario.Drop {
+		if hj, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+		panic(http.ErrAbortHandler)
+	}
+
+	raw, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	body, err := decodeGBK(raw)
+	if err != nil {
+		p.writeError(w, "", &Error{RETCOD: models.RETCODBadFormat, ERRMSG: "数据格式错误"})
+		return
+	}
+
+	basic := struct {
+		XMLName xml.Name `xml:"CMBSDKPGK"`
+		models.ReqBasicInfo
+	}{}
+
+	if err = xml.Unmarshal(body, &basic); err != nil {
+		p.writeError(w, "", &Error{RETCOD: models.RETCODBadFormat, ERRMSG: "数据格式错误"})
+		return
+	}
+
+	p.mu.Lock()
+	p.requests = append(p.requests, Request{
+		FUNNAM: basic.FUNNAM,
+		LGNNAM: basic.LGNNAM,
+		Body:   string(body),
+		Time:   time.Now(),
+	})
+	handler := p.handlers[basic.FUNNAM]
+	p.mu.Unlock()
+
+	switch {
+	case scenario.NotLoggedIn:
+		p.writeError(w, basic.FUNNAM, &Error{RETCOD: models.RETCODNotLoggedIn, ERRMSG: "尚未登录系统"})
+		return
+	case scenario.SignatureError && signedFunctions[basic.FUNNAM]:
+		p.writeError(w, basic.FUNNAM, &Error{RETCOD: models.RETCODFailure, ERRMSG: models.ERRMSGSignatureError})
+		return
+	}
+
+	if e, exist := scenario.Errors[basic.FUNNAM]; exist {
+		p.writeError(w, basic.FUNNAM, &e)
+		return
+	}
+
+	if handler == nil {
+		p.writeError(w, basic.FUNNAM, &Error{RETCOD: models.RETCODOther, ERRMSG: "不支持的交易: " + basic.FUNNAM})
+		return
+	}
+
+	resp, e := handler(p, basic.LGNNAM, body)
+	if e != nil {
+		p.writeError(w, basic.FUNNAM, e)
+		return
+	}
+
+	p.write(w, resp)
+}
+
+// 需要USBKey签名的交易
+var signedFunctions = map[string]bool{
+	"DCPAYMNT":   true,
+	"GetAccInfo": true,
+}
+
+func (p *Server) writeError(w http.ResponseWriter, funnam string, e *Error) {
+	p.write(w, &struct {
+		XMLName xml.Name `xml:"CMBSDKPGK"`
+		models.RespBasicInfo
+	}{
+		RespBasicInfo: models.RespBasicInfo{
+			FUNNAM: funnam,
+			DATTYP: 2,
+			RETCOD: e.RETCOD,
+			ERRMSG: e.ERRMSG,
+		},
+	})
+}
+
+func (p *Server) write(w http.ResponseWriter, resp interface{}) {
+	data, err := xml.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data = append([]byte(`<?xml version="1.0" encoding="GBK"?>`), data...)
+
+	out, _, err := transform.Bytes(simplifiedchinese.GBK.NewEncoder(), data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml; charset=GBK")
+	w.Write(out)
+}
+
+func decodeGBK(raw []byte) (body []byte, err error) {
+	body, _, err = transform.Bytes(simplifiedchinese.GBK.NewDecoder(), raw)
+	if err != nil {
+		return
+	}
+
+	// 与 monitor 一样，解码后将声明的编码改为UTF-8
+	s := strings.Replace(string(body), "GBK", "UTF-8", 1)
+
+	return []byte(s), nil
+}
+
+func (p *Server) nextReqNbr() string {
+	p.reqSeq++
+	return fmt.Sprintf("%s%010d", time.Now().Format("20060102"), p.reqSeq)
+}
@@ -0,0 +1,190 @@
+package fbsdkmock
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gogap/cmb_robot/monitor/models"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/transform"
+)
+
+// post 以GBK编码发送请求，返回解码后的响应
+func post(t *testing.T, url string, req models.Request, resp interface{}) {
+	req.SetBasicInfo(models.ReqBasicInfo{FUNNAM: req.FunctionName(), DATTYP: models.DATTYPXML, LGNNAM: "u1"})
+
+	data, err := xml.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data = append([]byte(`<?xml version="1.0" encoding="GBK"?>`), data...)
+
+	body, _, err := transform.Bytes(simplifiedchinese.GBK.NewEncoder(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := http.Post(url, "text/xml", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+
+	raw, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(r.Header.Get("Content-Type"), "GBK") {
+		t.Errorf("Content-Type = %q, want GBK", r.Header.Get("Content-Type"))
+	}
+
+	out, err := decodeGBK(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = xml.Unmarshal(out, resp); err != nil {
+		t.Fatalf("unmarshal %s: %v", out, err)
+	}
+}
+
+func TestGetPaymentInfo(t *testing.T) {
+	s := New()
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	s.AddPayment(models.RespGetPaymentInfoListItem{
+		YURREF: "R1",
+		OPRDAT: "20240102",
+		CRTNAM: "张三",
+		TRSAMT: models.Fen(12345),
+		REQSTS: "FIN",
+		RTNFLG: "B",
+		RTNNAR: "收款人账号不存在",
+	})
+	s.AddPayment(models.RespGetPaymentInfoListItem{YURREF: "R2", OPRDAT: "20240301"})
+
+	resp := models.RespGetPaymentInfo{}
+	post(t, srv.URL, &models.ReqGetPaymentInfo{BUSCOD: "N02031", BGNDAT: "20240101", ENDDAT: "20240131"}, &resp)
+
+	if err := resp.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.NTQPAYQYZ) != 1 {
+		t.Fatalf("got %d payments, want 1", len(resp.NTQPAYQYZ))
+	}
+
+	item := resp.NTQPAYQYZ[0]
+	if item.YURREF != "R1" || item.CRTNAM != "张三" || item.RTNNAR != "收款人账号不存在" || item.TRSAMT.Fen() != 12345 {
+		t.Errorf("payment = %+v", item)
+	}
+
+	reqs := s.Requests()
+	if len(reqs) != 1 || reqs[0].FUNNAM != "GetPaymentInfo" || reqs[0].LGNNAM != "u1" {
+		t.Errorf("requests = %+v", reqs)
+	}
+}
+
+func TestDirectPayment(t *testing.T) {
+	s := New()
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	s.SetBalance(Balance{BBKNBR: 75, ACCNBR: "755000001"})
+
+	pay := &models.ReqDirectPayment{YURREF: "P1", DBTACC: "755000001", CRTNAM: "李四", TRSAMT: models.Fen(100)}
+
+	resp := models.RespDirectPayment{}
+	post(t, srv.URL, pay, &resp)
+
+	if resp.ERRCOD != models.ERRCODSuccess || resp.REQSTS != "BNK" || len(resp.REQNBR) == 0 {
+		t.Errorf("first payment = %+v", resp)
+	}
+
+	// 同一个业务参考号再次提交时返回重复
+	resp = models.RespDirectPayment{}
+	post(t, srv.URL, pay, &resp)
+
+	if resp.ERRCOD != models.ERRCODDuplicateYURREF || resp.ERRTXT != "业务参考号重复" {
+		t.Errorf("duplicate payment = %+v", resp)
+	}
+
+	if !s.UpdatePayment("P1", "FIN", "S", "") {
+		t.Error("UpdatePayment did not find P1")
+	}
+
+	payments := s.Payments()
+	if len(payments) != 1 || payments[0].CRTNAM != "李四" || payments[0].RTNFLG != "S" {
+		t.Errorf("payments = %+v", payments)
+	}
+}
+
+func TestScenario(t *testing.T) {
+	s := New()
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		scenario Scenario
+		req      models.Request
+		retcod   int64
+		errmsg   string
+	}{
+		{"not logged in", Scenario{NotLoggedIn: true}, &models.ReqGetPaymentInfo{}, models.RETCODNotLoggedIn, "尚未登录系统"},
+		{"signature error", Scenario{SignatureError: true}, &models.ReqDirectPayment{}, models.RETCODFailure, models.ERRMSGSignatureError},
+		{"signature error does not affect queries", Scenario{SignatureError: true}, &models.ReqGetPaymentInfo{}, models.RETCODFailure, "期望日期错误"},
+		{"configured error", Scenario{Errors: map[string]Error{"GetPaymentInfo": {RETCOD: models.RETCODTooFrequent, ERRMSG: "请求太频繁"}}}, &models.ReqGetPaymentInfo{}, models.RETCODTooFrequent, "请求太频繁"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.SetScenario(tt.scenario)
+
+			resp := models.RespBasicInfo{}
+			post(t, srv.URL, tt.req, &resp)
+
+			if resp.RETCOD != tt.retcod || resp.ERRMSG != tt.errmsg {
+				t.Errorf("RETCOD/ERRMSG = %d/%q, want %d/%q", resp.RETCOD, resp.ERRMSG, tt.retcod, tt.errmsg)
+			}
+
+			if resp.FUNNAM != tt.req.FunctionName() {
+				t.Errorf("FUNNAM = %q, want %q", resp.FUNNAM, tt.req.FunctionName())
+			}
+		})
+	}
+}
+
+func TestBadFormat(t *testing.T) {
+	srv := httptest.NewServer(New())
+	defer srv.Close()
+
+	r, err := http.Post(srv.URL, "text/xml", strings.NewReader("not xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+
+	raw, _ := ioutil.ReadAll(r.Body)
+	out, err := decodeGBK(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := models.RespBasicInfo{}
+	if err = xml.Unmarshal(out, &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.RETCOD != models.RETCODBadFormat {
+		t.Errorf("RETCOD = %d, want %d", resp.RETCOD, models.RETCODBadFormat)
+	}
+}
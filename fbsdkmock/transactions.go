@@ -0,0 +1,97 @@
+package fbsdkmock
+
+import (
+	"encoding/xml"
+	"strconv"
+	"time"
+
+	"github.com/gogap/cmb_robot/monitor/models"
+)
+
+type transaction struct {
+	BBKNBR int
+	ACCNBR string
+	Item   models.RespGetTransInfoItem
+}
+
+// AddTransaction 添加一条可通过 GetTransInfo 查询到的账务明细，交易日为 item.ETYDAT
+func (p *Server) AddTransaction(bbknbr int, accnbr string, item models.RespGetTransInfoItem) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.transactions = append(p.transactions, transaction{BBKNBR: bbknbr, ACCNBR: accnbr, Item: item})
+}
+
+// SetPageSize 设置 GetTransInfo 每次返回的最大记录数，超过时返回续传键值，0 表示不分页
+func (p *Server) SetPageSize(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pageSize = n
+}
+
+func handleGetTransInfo(s *Server, lgnnam string, body []byte) (resp interface{}, e *Error) {
+	req := models.ReqGetTransInfo{}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		return nil, &Error{RETCOD: models.RETCODBadFormat, ERRMSG: "数据格式错误"}
+	}
+
+	begin, err1 := time.Parse("20060102", req.BGNDAT)
+	end, err2 := time.Parse("20060102", req.ENDDAT)
+	if err1 != nil || err2 != nil || end.Before(begin) {
+		return nil, &Error{RETCOD: models.RETCODFailure, ERRMSG: "期望日期错误"}
+	}
+
+	if end.Sub(begin) >= models.GetTransInfoMaxDays*24*time.Hour {
+		return nil, &Error{RETCOD: models.RETCODFailure, ERRMSG: "查询日期范围超过" + strconv.Itoa(models.GetTransInfoMaxDays) + "天"}
+	}
+
+	offset := 0
+	if len(req.CTNKEY) > 0 {
+		n, err := strconv.Atoi(req.CTNKEY)
+		if err != nil || n < 0 {
+			return nil, &Error{RETCOD: models.RETCODFailure, ERRMSG: "续传键值错误"}
+		}
+		offset = n
+	}
+
+	s.mu.Lock()
+	pageSize := s.pageSize
+
+	var items []models.RespGetTransInfoItem
+	for _, t := range s.transactions {
+		if t.ACCNBR != req.ACCNBR || t.BBKNBR != req.BBKNBR {
+			continue
+		}
+
+		if t.Item.ETYDAT < req.BGNDAT || t.Item.ETYDAT > req.ENDDAT {
+			continue
+		}
+
+		if len(req.AMTCDR) > 0 && t.Item.AMTCDR != req.AMTCDR {
+			continue
+		}
+
+		items = append(items, t.Item)
+	}
+	s.mu.Unlock()
+
+	result := &models.RespGetTransInfo{
+		RespBasicInfo: models.RespBasicInfo{FUNNAM: req.FUNNAM, DATTYP: 2},
+	}
+
+	if offset > len(items) {
+		offset = len(items)
+	}
+
+	items = items[offset:]
+
+	if pageSize > 0 && len(items) > pageSize {
+		items = items[:pageSize]
+		result.CTNKEY = strconv.Itoa(offset + pageSize)
+	}
+
+	result.NTQTSINFZ = items
+
+	return result, nil
+}
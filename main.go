@@ -1,20 +1,22 @@
 package main
 
 import (
-	"crypto/rc4"
-	"encoding/base64"
+	"context"
+	"flag"
 	"fmt"
 	"github.com/gogap/logrus_mate"
 	"github.com/sirupsen/logrus"
-	"io/ioutil"
+	"os"
+	"os/signal"
 	"sync"
 	"syscall"
-	"time"
 
 	"github.com/go-akka/configuration"
+	"github.com/gogap/cmb_robot/config"
 	"github.com/gogap/cmb_robot/monitor"
+	"github.com/gogap/cmb_robot/password"
 	"github.com/gogap/cmb_robot/robot"
-	"golang.org/x/crypto/ssh/terminal"
+	"github.com/gogap/cmb_robot/supervisor"
 
 	_ "github.com/gogap/logrus_mate/hooks/bearychat"
 	_ "github.com/gogap/logrus_mate/hooks/expander"
@@ -22,76 +24,128 @@ import (
 
 func main() {
 
+	code := exitOK
+
 	var err error
 	defer func() {
 		if err != nil {
 			logrus.Errorln(err)
-			return
+			code = exitError
 		}
+		exit(code)
 	}()
 
-	logrus_mate.Hijack(logrus.StandardLogger(), logrus_mate.ConfigFile("log.conf"))
+	configFile := flag.String("config", "cmb-robot.conf", "encrypted config file")
+	checkConfig := flag.Bool("check-config", false, "validate config file, print every problem and exit")
+	passwordSource := flag.String("password-source", "tty", "config password source: tty, env[:NAME], fd:N, file:PATH, cmd:PROGRAM, systemd[:NAME]")
+	shutdownTimeout := flag.Duration("shutdown-timeout", defaultShutdownTimeout, "on SIGINT/SIGTERM, how long to wait for a running login before aborting it")
+
+	flag.Parse()
 
-	fmt.Print("请输入配置文件密码:")
+	logrus_mate.Hijack(logrus.StandardLogger(), logrus_mate.ConfigFile("log.conf"))
 
-	bytePassword, err := terminal.ReadPassword(int(syscall.Stdin))
+	src, err := password.Parse(*passwordSource)
 	if err != nil {
 		return
 	}
 
-	fmt.Println()
+	bytePassword, err := src.Password()
+	if err != nil {
+		err = fmt.Errorf("读取配置文件密码失败(%s): %w", src.Name(), err)
+		return
+	}
 
-	conf, err := getConfig(bytePassword, "cmb-robot.conf")
+	conf, format, err := config.Load(bytePassword, *configFile)
 	if err != nil {
-		logrus.Errorln(err)
+		switch err {
+		case config.ErrWrongPassword:
+			err = fmt.Errorf("加载配置文件失败，请检查密码是否正确")
+		case config.ErrCorruptFile:
+			err = fmt.Errorf("加载配置文件失败，配置文件已损坏")
+		}
 		return
 	}
 
-	if conf == nil {
-		err = fmt.Errorf("加载配置文件失败，请检查密码是否正确")
+	if format == config.FormatLegacyRC4 {
+		logrus.Warnln("配置文件仍为旧的RC4加密格式，请使用 cmbctl rotate-password 迁移")
+	}
+
+	if e := config.New(conf).Validate(); e != nil {
+		printConfigErrors(e)
+		err = fmt.Errorf("配置文件检查失败")
+		return
+	}
+
+	if *checkConfig {
+		fmt.Println("配置文件检查通过")
 		return
 	}
 
 	wg := sync.WaitGroup{}
 
-	err = startRobot(&wg, conf)
+	mgr := newAccountManager(&wg, *configFile, bytePassword)
+
+	// 在启动账号之前注册，启动过程中收到的信号由 wait 处理，正在进行的登录可以正常结束
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+	err = mgr.start(conf)
 	if err != nil {
 		return
 	}
 
-	wg.Wait()
-}
+	go mgr.watch()
 
-func getConfig(bytePassword []byte, filename string) (conf *configuration.Config, err error) {
-	defer func() {
-		recover()
-	}()
+	code = mgr.wait(sig, *shutdownTimeout)
+}
 
-	data, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return
+func printConfigErrors(err error) {
+	errs, ok := err.(config.Errors)
+	if !ok {
+		errs = config.Errors{err}
 	}
 
-	src, err := base64.StdEncoding.DecodeString(string(data))
-	if err != nil {
-		return
+	for _, e := range errs {
+		fmt.Fprintln(os.Stderr, e)
 	}
+}
 
-	cipher, err := rc4.NewCipher(bytePassword)
-	if err != nil {
-		return
+func startRobot(wg *sync.WaitGroup, w *accountWorker, probe supervisor.Probe, remediator supervisor.Remediator) {
+	username := w.userName
+
+	opts := supervisor.DefaultOptions()
+	opts.IsFatal = func(err error) bool {
+		return err == robot.ErrWrongLoginPassword || err == robot.ErrWrongUSBKeyPassword
+	}
+	opts.Classify = classify
+	opts.Listener = func(event supervisor.Event) {
+		logEvent(username, event)
 	}
 
-	dst := make([]byte, len(src))
+	w.sup = supervisor.New(probe, remediator, opts)
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
 
-	cipher.XORKeyStream(dst, src)
+		logrus.WithField("username", username).Infoln("开始监控......")
 
-	conf = configuration.ParseString(string(dst))
+		e := w.sup.RunContext(w.ctx)
 
-	return
+		switch {
+		case e == supervisor.ErrLockedOut:
+			w.lockedOut = true
+			logrus.WithField("username", username).Errorln("账号因致命错误停止监控，修改配置文件并重新加载后重新开始")
+		case w.removed:
+			logrus.WithField("username", username).Infoln("账号已从配置中移除，停止监控")
+		default:
+			logrus.WithField("username", username).Infoln("停止监控")
+		}
+	}()
 }
 
-func startRobot(wg *sync.WaitGroup, conf *configuration.Config) (err error) {
+func newProbeAndRemediator(conf *configuration.Config) (probe supervisor.Probe, remediator supervisor.Remediator, err error) {
 	bot, err := robot.NewRobot(conf)
 	if err != nil {
 		return
@@ -102,63 +156,54 @@ func startRobot(wg *sync.WaitGroup, conf *configuration.Config) (err error) {
 		return
 	}
 
-	username := conf.GetString("username")
+	logrus.WithField("username", conf.GetString("username")).WithField("probe", mon.ProbeKind()).Infoln("签名检查方式")
+	logrus.WithField("username", conf.GetString("username")).WithField("profile", bot.ProfileName()).Infoln("FBSdk界面profile")
 
-	wg.Add(1)
+	remediator = supervisor.RemediatorFunc(func(ctx context.Context, mode supervisor.Mode) error {
+		return bot.RunContext(ctx, robot.RunMode(mode))
+	})
 
-	go func(bot *robot.Robot, mon *monitor.CMBMonitor) {
+	return mon, remediator, nil
+}
 
-		logrus.WithField("username", username).Infoln("开始监控......")
+// classify 按探测失败的原因选择恢复动作
+func classify(err error) supervisor.Mode {
+	switch monitor.Diagnose(err) {
+	case monitor.DiagnosisListenerDown:
+		return supervisor.ModeReListen
+	case monitor.DiagnosisNotLoggedIn, monitor.DiagnosisSignatureError:
+		return supervisor.ModeReLogin
+	case monitor.DiagnosisTimeout:
+		return supervisor.ModeFull
+	case monitor.DiagnosisBackendDown, monitor.DiagnosisDataMismatch:
+		// 机器人无法修复，只告警
+		return supervisor.ModeNone
+	}
+	return supervisor.ModeReListen | supervisor.ModeReLogin
+}
 
-		runMode := robot.RunModeReListen | robot.RunModeReLogin
-
-		pingExceptionCountMax := 3
-		pingExceptionCount := 0
-
-		for {
-
-			excepetion := false
-
-			if e := mon.Ping(); e != nil {
-				excepetion = true
-				pingExceptionCount++
-				if pingExceptionCount == 1 {
-					logrus.WithField("username", username).WithError(e).Warnln("PING 业务状态开始抖动")
-				}
-				time.Sleep(time.Second * 10)
-			}
-
-			if !excepetion {
-				if pingExceptionCount > 0 {
-					logrus.WithField("username", username).Infof("PING 业务状态抖动恢复, 抖动次数: %d", pingExceptionCount)
-				}
-				pingExceptionCount = 0
-				time.Sleep(time.Second)
-				continue
-			}
-
-			if pingExceptionCount < pingExceptionCountMax {
-				time.Sleep(time.Second)
-				continue
-			}
-
-			logrus.WithField("username", username).Errorln("发现异常，即将启动机器人")
-
-			if e := bot.Run(runMode); e != nil {
-				if e == robot.ErrWrongLoginPassword || e == robot.ErrWrongUSBKeyPassword {
-					logrus.WithField("username", username).WithError(e).Panicln("YOU ENTER THE WRONG PASSWORD!!!!!!!")
-				}
-
-				logrus.WithField("username", username).WithError(e).Errorln("机器人执行登录时异常, 30s后将执行应用重启")
-				runMode = robot.RunModeRestart | robot.RunModeReListen | robot.RunModeReLogin
-			} else {
-				logrus.WithField("username", username).Infoln("机器人执行登录成功")
-				runMode = robot.RunModeReListen | robot.RunModeReLogin
-			}
-			time.Sleep(time.Second * 30)
-			pingExceptionCount = 0
+func logEvent(username string, event supervisor.Event) {
+	entry := logrus.WithField("username", username)
+
+	switch event.To {
+	case supervisor.StateFlapping:
+		entry.WithError(event.Err).Warnln("PING 业务状态开始抖动")
+	case supervisor.StateRecovering:
+		entry.WithField("mode", event.Mode).WithField("diagnosis", monitor.Diagnose(event.Err)).Errorln("发现异常，即将启动机器人")
+	case supervisor.StateRestarting:
+		entry.WithError(event.Err).Errorln("机器人执行登录时异常, 下次恢复将执行应用重启")
+	case supervisor.StateLockedOut:
+		entry.WithError(event.Err).Errorln("YOU ENTER THE WRONG PASSWORD!!!!!!! 已停止该账号的自动登录")
+	case supervisor.StateWaiting:
+		entry.WithError(event.Err).Errorln("招行后台异常或探测交易数据不符，不启动机器人，等待恢复")
+	case supervisor.StateHealthy:
+		switch event.From {
+		case supervisor.StateFlapping:
+			entry.Infof("PING 业务状态抖动恢复, 抖动次数: %d", event.Failures)
+		case supervisor.StateRecovering:
+			entry.Infoln("机器人执行登录成功")
+		case supervisor.StateWaiting:
+			entry.Infoln("PING 业务状态已恢复")
 		}
-	}(bot, mon)
-
-	return
+	}
 }
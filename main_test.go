@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/gogap/cmb_robot/cmbclient"
+	"github.com/gogap/cmb_robot/monitor"
+	"github.com/gogap/cmb_robot/monitor/models"
+	"github.com/gogap/cmb_robot/supervisor"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		diagnosis monitor.Diagnosis
+		mode      supervisor.Mode
+	}{
+		{monitor.DiagnosisListenerDown, supervisor.ModeReListen},
+		{monitor.DiagnosisTimeout, supervisor.ModeFull},
+		{monitor.DiagnosisNotLoggedIn, supervisor.ModeReLogin},
+		{monitor.DiagnosisSignatureError, supervisor.ModeReLogin},
+		// 机器人无法修复的问题只告警
+		{monitor.DiagnosisBackendDown, supervisor.ModeNone},
+		{monitor.DiagnosisDataMismatch, supervisor.ModeNone},
+		{monitor.DiagnosisUnknown, supervisor.ModeReListen | supervisor.ModeReLogin},
+	}
+
+	for _, tt := range tests {
+		err := &monitor.PingError{Diagnosis: tt.diagnosis, Err: errors.New("ping failed")}
+		if mode := classify(err); mode != tt.mode {
+			t.Errorf("classify(%s) = %v, want %v", tt.diagnosis, mode, tt.mode)
+		}
+	}
+}
+
+// 没有经过 Ping 包装的原始错误同样按诊断结果分类
+func TestClassifyRawErrors(t *testing.T) {
+	tests := []struct {
+		err  error
+		mode supervisor.Mode
+	}{
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, supervisor.ModeReListen},
+		{context.DeadlineExceeded, supervisor.ModeFull},
+		{models.ErrActionFailed{RETCOD: models.RETCODNotLoggedIn}, supervisor.ModeReLogin},
+		{models.ErrActionFailed{RETCOD: models.RETCODFailure, ERRMSG: models.ERRMSGSignatureError}, supervisor.ModeReLogin},
+		{models.ErrActionFailed{RETCOD: models.RETCODTooFrequent}, supervisor.ModeNone},
+		{monitor.ErrBadTXCount, supervisor.ModeNone},
+		{&cmbclient.StatusError{StatusCode: 500}, supervisor.ModeReListen | supervisor.ModeReLogin},
+	}
+
+	for _, tt := range tests {
+		if mode := classify(tt.err); mode != tt.mode {
+			t.Errorf("classify(%v) = %v, want %v", tt.err, mode, tt.mode)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gogap/cmb_robot/monitor/models"
+)
+
+var (
+	ErrNoBalanceAccounts = errors.New("no account to query balance")
+	ErrAccountNotFound   = errors.New("account not found in response")
+)
+
+// GetBalanceInfo 通过一次 GetAccInfo 请求查询多个账户的余额
+func (p *CMBMonitor) GetBalanceInfo(accounts ...models.ReqGetBalanceInfoItem) ([]models.BalanceInfo, error) {
+	return p.GetBalanceInfoContext(context.Background(), accounts...)
+}
+
+func (p *CMBMonitor) GetBalanceInfoContext(ctx context.Context, accounts ...models.ReqGetBalanceInfoItem) (balances []models.BalanceInfo, err error) {
+	if len(accounts) == 0 {
+		err = ErrNoBalanceAccounts
+		return
+	}
+
+	req := &models.ReqGetBalanceInfo{
+		SDKACINFX: accounts,
+	}
+
+	resp := models.RespGetBalanceInfo{}
+	err = p.client.Call(ctx, req, &resp)
+	if err != nil {
+		return
+	}
+
+	if len(resp.NTQACINFZ) != len(accounts) {
+		err = ErrBadTXCount
+		return
+	}
+
+	items := make(map[string]*models.RespGetBalanceInfoItem, len(resp.NTQACINFZ))
+	for i := range resp.NTQACINFZ {
+		items[resp.NTQACINFZ[i].ACCNBR] = &resp.NTQACINFZ[i]
+	}
+
+	// 按请求的顺序返回
+	for _, acc := range accounts {
+		item, exist := items[acc.ACCNBR]
+		if !exist {
+			err = ErrAccountNotFound
+			return
+		}
+
+		balances = append(balances, item.BalanceInfo())
+	}
+
+	return
+}
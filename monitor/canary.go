@@ -0,0 +1,122 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gogap/cmb_robot/monitor/models"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrBadCanaryWindow = errors.New("canary lookback and max age days must be greater than zero")
+)
+
+const (
+	DefaultCanaryLookbackDays = 30
+	DefaultCanaryMaxAgeDays   = 30
+)
+
+// 没有找到参考支付时重新选取的间隔
+const (
+	canaryRetryMin = time.Minute
+	canaryRetryMax = time.Hour
+)
+
+// canaryExpired 还没有选取参考支付，或参考支付已超过 maxAgeDays 天
+func (p *CMBMonitor) canaryExpired(now time.Time) bool {
+	if len(p.date) == 0 {
+		return true
+	}
+
+	date, err := time.ParseInLocation("20060102", p.date, now.Location())
+	if err != nil {
+		return true
+	}
+
+	return now.Sub(date) > time.Duration(p.maxAgeDays)*24*time.Hour
+}
+
+// provisionCanary 在最近 lookbackDays 天内选取最新的一笔已完成支付作为参考，
+// 没有找到时只要查询成功就认为网络正常，等待 canaryBackoff 后再重新选取
+func (p *CMBMonitor) provisionCanary(ctx context.Context, now time.Time) (err error) {
+	req := &models.ReqGetPaymentInfo{
+		BUSCOD: "N02031",
+		BGNDAT: now.AddDate(0, 0, 1-p.lookbackDays).Format("20060102"),
+		ENDDAT: now.Format("20060102"),
+	}
+
+	resp := models.RespGetPaymentInfo{}
+	err = p.client.Call(ctx, req, &resp)
+	if err != nil {
+		return
+	}
+
+	var canary *models.RespGetPaymentInfoListItem
+	for i := range resp.NTQPAYQYZ {
+		item := &resp.NTQPAYQYZ[i]
+
+		if item.REQSTS != "FIN" || len(item.YURREF) == 0 || len(item.REQNBR) == 0 || item.TRSAMT.Sign() <= 0 {
+			continue
+		}
+
+		if len(p.payee) > 0 && item.CRTACC != p.payee {
+			continue
+		}
+
+		if canary == nil || item.OPRDAT >= canary.OPRDAT {
+			canary = item
+		}
+	}
+
+	if canary == nil {
+		p.date = ""
+
+		p.canaryBackoff *= 2
+		if p.canaryBackoff < canaryRetryMin {
+			p.canaryBackoff = canaryRetryMin
+		} else if p.canaryBackoff > canaryRetryMax {
+			p.canaryBackoff = canaryRetryMax
+		}
+
+		p.canaryRetryAt = now.Add(p.canaryBackoff)
+
+		logrus.WithField("username", p.username).
+			WithField("lookback_days", p.lookbackDays).
+			WithField("payee", p.payee).
+			WithField("retry_after", p.canaryBackoff).
+			Warnln("没有找到可用作探测的已完成支付，只检查查询是否成功，无法发现数据不符")
+		return
+	}
+
+	p.canaryBackoff = 0
+	p.canaryRetryAt = time.Time{}
+
+	p.systemSN = canary.YURREF
+	p.channelSN = canary.REQNBR
+	p.amount = canary.TRSAMT.Fen()
+	p.status = canary.RTNFLG
+	p.date = canary.OPRDAT
+
+	logrus.WithField("username", p.username).
+		WithField("system_sn", p.systemSN).
+		WithField("channel_sn", p.channelSN).
+		WithField("date", p.date).
+		Infoln("已自动选取探测用的参考支付")
+
+	return
+}
+
+// queryToday 没有参考支付时只查询当天的支付，查询成功即认为网络正常
+func (p *CMBMonitor) queryToday(ctx context.Context, now time.Time) (err error) {
+	req := &models.ReqGetPaymentInfo{
+		BUSCOD: "N02031",
+		BGNDAT: now.Format("20060102"),
+		ENDDAT: now.Format("20060102"),
+	}
+
+	resp := models.RespGetPaymentInfo{}
+
+	return p.client.Call(ctx, req, &resp)
+}
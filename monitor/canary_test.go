@@ -0,0 +1,204 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/gogap/cmb_robot/cmbclient"
+	"github.com/gogap/cmb_robot/monitor/models"
+)
+
+// payments 返回 OPRDAT 在查询日期范围内、YURREF 匹配的支付，并记录查询
+type payments struct {
+	items []models.RespGetPaymentInfoListItem
+	reqs  []models.ReqGetPaymentInfo
+}
+
+func (p *payments) Call(ctx context.Context, req models.Request, resp models.Response) error {
+	r := req.(*models.ReqGetPaymentInfo)
+	p.reqs = append(p.reqs, *r)
+
+	out := resp.(*models.RespGetPaymentInfo)
+	for _, item := range p.items {
+		if item.OPRDAT < r.BGNDAT || item.OPRDAT > r.ENDDAT {
+			continue
+		}
+		if len(r.YURREF) > 0 && item.YURREF != r.YURREF {
+			continue
+		}
+		out.NTQPAYQYZ = append(out.NTQPAYQYZ, item)
+	}
+
+	return nil
+}
+
+// lastRange 最后一次查询的日期范围
+func (p *payments) lastRange() string {
+	r := p.reqs[len(p.reqs)-1]
+	return r.BGNDAT + "-" + r.ENDDAT + "/" + r.YURREF
+}
+
+func finished(yurref, date string) models.RespGetPaymentInfoListItem {
+	return models.RespGetPaymentInfoListItem{
+		YURREF: yurref,
+		REQNBR: "N" + yurref,
+		REQSTS: "FIN",
+		RTNFLG: "S",
+		TRSAMT: models.Fen(100),
+		OPRDAT: date,
+	}
+}
+
+type fakeNow struct {
+	now time.Time
+}
+
+func (p *fakeNow) Now() time.Time {
+	return p.now
+}
+
+func newTestMonitor(t *testing.T, bank cmbclient.Caller) (*CMBMonitor, *fakeNow) {
+	conf := configuration.ParseString(`{
+		url: "http://127.0.0.1:8080"
+		username: "u1"
+		probe: "none"
+		canary-lookback-days: 10
+		canary-max-age-days: 5
+	}`)
+
+	mon, err := NewCMBMonitorWithClient(conf, bank)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := &fakeNow{now: time.Date(2024, 1, 20, 10, 0, 0, 0, time.Local)}
+	mon.now = clock.Now
+
+	return mon, clock
+}
+
+func TestCanaryFound(t *testing.T) {
+	bank := &payments{items: []models.RespGetPaymentInfoListItem{
+		finished("R1", "20240115"),
+		finished("R2", "20240118"),
+		{YURREF: "R3", REQNBR: "N3", REQSTS: "OPR", TRSAMT: models.Fen(100), OPRDAT: "20240119"},
+	}}
+	mon, _ := newTestMonitor(t, bank)
+
+	if err := mon.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := bank.lastRange(); got != "20240111-20240120/" {
+		t.Errorf("lookup = %s, want the lookback window", got)
+	}
+
+	// 选取最新的已完成支付，之后按业务参考号查询
+	if err := mon.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := bank.lastRange(); got != "20240118-20240118/R2" {
+		t.Errorf("probe = %s, want the latest finished payment", got)
+	}
+}
+
+func TestCanaryMissing(t *testing.T) {
+	bank := &payments{}
+	mon, clock := newTestMonitor(t, bank)
+
+	if err := mon.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := bank.lastRange(); got != "20240111-20240120/" {
+		t.Errorf("lookup = %s, want the lookback window", got)
+	}
+
+	// 重新选取前只查询当天
+	for i := 0; i < 3; i++ {
+		clock.now = clock.now.Add(time.Second)
+		if err := mon.Ping(); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := bank.lastRange(); got != "20240120-20240120/" {
+			t.Fatalf("ping %d = %s, want today only", i, got)
+		}
+	}
+
+	// 间隔逐次加倍，不超过 canaryRetryMax
+	backoff := canaryRetryMin
+	for i := 0; i < 10; i++ {
+		clock.now = clock.now.Add(backoff)
+		if err := mon.Ping(); err != nil {
+			t.Fatal(err)
+		}
+
+		if r := bank.reqs[len(bank.reqs)-1]; r.BGNDAT == r.ENDDAT {
+			t.Fatalf("retry %d = %s, want the lookback window", i, bank.lastRange())
+		}
+
+		if backoff *= 2; backoff > canaryRetryMax {
+			backoff = canaryRetryMax
+		}
+
+		if mon.canaryBackoff != backoff {
+			t.Fatalf("retry %d backoff = %v, want %v", i, mon.canaryBackoff, backoff)
+		}
+	}
+
+	// 出现新的支付后，下一次重新选取时使用
+	clock.now = clock.now.Add(canaryRetryMax)
+	bank.items = append(bank.items, finished("R9", clock.now.Format("20060102")))
+
+	if err := mon.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	if mon.systemSN != "R9" || mon.canaryBackoff != 0 || !mon.canaryRetryAt.IsZero() {
+		t.Errorf("canary = %s, backoff = %v, retry at %v", mon.systemSN, mon.canaryBackoff, mon.canaryRetryAt)
+	}
+}
+
+func TestCanaryStale(t *testing.T) {
+	bank := &payments{items: []models.RespGetPaymentInfoListItem{finished("R1", "20240118")}}
+	mon, clock := newTestMonitor(t, bank)
+
+	if err := mon.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 超过 canary-max-age-days 后重新选取
+	bank.items = append(bank.items, finished("R2", "20240124"))
+	clock.now = clock.now.AddDate(0, 0, 6)
+
+	if err := mon.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := bank.lastRange(); got != "20240117-20240126/" {
+		t.Errorf("lookup = %s, want a new lookback window", got)
+	}
+
+	if mon.systemSN != "R2" || mon.date != "20240124" {
+		t.Errorf("canary = %s %s, want R2", mon.systemSN, mon.date)
+	}
+
+	// 参考支付查询不到时下次重新选取
+	bank.items = nil
+
+	if err := mon.Ping(); Diagnose(err) != DiagnosisDataMismatch {
+		t.Fatalf("Ping = %v, want %v", err, DiagnosisDataMismatch)
+	}
+
+	if err := mon.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := bank.lastRange(); got != "20240117-20240126/" {
+		t.Errorf("lookup = %s, want a new lookback window", got)
+	}
+}
@@ -0,0 +1,95 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/gogap/cmb_robot/cmbclient"
+	"github.com/gogap/cmb_robot/monitor/models"
+)
+
+// Diagnosis 探测失败的原因
+type Diagnosis int
+
+const (
+	DiagnosisUnknown        Diagnosis = iota // 无法判断
+	DiagnosisListenerDown                    // 连接被拒绝，FBSdk 没有监听
+	DiagnosisTimeout                         // FBSdk 无响应
+	DiagnosisNotLoggedIn                     // FBSdk 尚未登录
+	DiagnosisSignatureError                  // 签名错误，USBKey 未插入或会话失效
+	DiagnosisBackendDown                     // FBSdk 正常，但招行后台返回错误
+	DiagnosisDataMismatch                    // 查询成功，但探测交易的数据不符
+)
+
+func (p Diagnosis) String() string {
+	switch p {
+	case DiagnosisListenerDown:
+		return "listener down"
+	case DiagnosisTimeout:
+		return "timeout"
+	case DiagnosisNotLoggedIn:
+		return "not logged in"
+	case DiagnosisSignatureError:
+		return "signature error"
+	case DiagnosisBackendDown:
+		return "cmb backend down"
+	case DiagnosisDataMismatch:
+		return "probe data mismatch"
+	}
+	return "unknown"
+}
+
+// PingError Ping 返回的错误，附带诊断结果
+type PingError struct {
+	Diagnosis Diagnosis
+	Err       error
+}
+
+func (p *PingError) Error() string {
+	return p.Diagnosis.String() + ": " + p.Err.Error()
+}
+
+func (p *PingError) Unwrap() error {
+	return p.Err
+}
+
+// Diagnose 返回错误的诊断结果，err 为 Ping 返回的错误或 FBSdk 调用的原始错误
+func Diagnose(err error) Diagnosis {
+	var pingErr *PingError
+	if errors.As(err, &pingErr) {
+		return pingErr.Diagnosis
+	}
+
+	switch {
+	case errors.Is(err, ErrBadTXCount), errors.Is(err, ErrBadRespTXAmount), errors.Is(err, ErrBadRespTXStatus):
+		return DiagnosisDataMismatch
+	case errors.Is(err, cmbclient.ErrNotLoggedIn), errors.Is(err, cmbclient.ErrNotCertUser):
+		return DiagnosisNotLoggedIn
+	case errors.Is(err, cmbclient.ErrSignature):
+		return DiagnosisSignatureError
+	case errors.Is(err, context.DeadlineExceeded):
+		return DiagnosisTimeout
+	}
+
+	if e, ok := cmbclient.ActionFailed(err); ok {
+		switch e.RETCOD {
+		case models.RETCODFailure, models.RETCODExecuteFailure, models.RETCODTooFrequent, models.RETCODOther:
+			return DiagnosisBackendDown
+		}
+		return DiagnosisUnknown
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return DiagnosisTimeout
+	}
+
+	// 连接阶段失败，包括各平台的连接被拒绝
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return DiagnosisListenerDown
+	}
+
+	return DiagnosisUnknown
+}
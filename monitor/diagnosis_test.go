@@ -0,0 +1,51 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/gogap/cmb_robot/cmbclient"
+	"github.com/gogap/cmb_robot/monitor/models"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestDiagnose(t *testing.T) {
+	tests := []struct {
+		err  error
+		want Diagnosis
+	}{
+		{ErrBadTXCount, DiagnosisDataMismatch},
+		{ErrBadRespTXAmount, DiagnosisDataMismatch},
+		{ErrBadRespTXStatus, DiagnosisDataMismatch},
+		{models.ErrActionFailed{FUNNAM: "GetPaymentInfo", RETCOD: models.RETCODNotLoggedIn}, DiagnosisNotLoggedIn},
+		{models.ErrActionFailed{RETCOD: models.RETCODNotCertUser}, DiagnosisNotLoggedIn},
+		{models.ErrActionFailed{RETCOD: models.RETCODFailure, ERRMSG: models.ERRMSGSignatureError}, DiagnosisSignatureError},
+		{models.ErrActionFailed{RETCOD: models.RETCODFailure}, DiagnosisBackendDown},
+		{models.ErrActionFailed{RETCOD: models.RETCODExecuteFailure}, DiagnosisBackendDown},
+		{models.ErrActionFailed{RETCOD: models.RETCODTooFrequent}, DiagnosisBackendDown},
+		{models.ErrActionFailed{RETCOD: models.RETCODOther}, DiagnosisBackendDown},
+		{models.ErrActionFailed{RETCOD: models.RETCODBadFormat}, DiagnosisUnknown},
+		{context.DeadlineExceeded, DiagnosisTimeout},
+		{fmt.Errorf("post: %w", timeoutError{}), DiagnosisTimeout},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, DiagnosisListenerDown},
+		{&net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset")}, DiagnosisUnknown},
+		{&cmbclient.StatusError{StatusCode: 500}, DiagnosisUnknown},
+		{errors.New("unexpected"), DiagnosisUnknown},
+		// Ping 返回的错误直接使用其中的诊断结果
+		{&PingError{Diagnosis: DiagnosisTimeout, Err: ErrBadTXCount}, DiagnosisTimeout},
+	}
+
+	for _, tt := range tests {
+		if got := Diagnose(tt.err); got != tt.want {
+			t.Errorf("Diagnose(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package models
+
+import (
+	"encoding/xml"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrBadAmount        = errors.New("bad amount")
+	ErrAmountOverflow   = errors.New("amount overflow")
+	ErrCurrencyMismatch = errors.New("amount currency mismatch")
+)
+
+// Currency 招行币种代码
+type Currency string
+
+const (
+	CNY Currency = "10" // 人民币
+)
+
+// Amount 金额，以分为单位的定点数，不经过浮点运算。零值为人民币0元
+type Amount struct {
+	fen      int64
+	currency Currency
+}
+
+// NewAmount 以分为单位创建金额，currency 为空时为人民币
+func NewAmount(fen int64, currency Currency) Amount {
+	return Amount{fen: fen, currency: currency}
+}
+
+// Fen 创建人民币金额
+func Fen(fen int64) Amount {
+	return Amount{fen: fen}
+}
+
+// ParseAmount 解析 "123.45" 格式的人民币金额，超过两位小数时返回错误，空字符串为0
+func ParseAmount(s string) (amount Amount, err error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+
+	if len(intPart) == 0 && len(fracPart) == 0 || len(fracPart) > 2 || !isDigits(intPart) || !isDigits(fracPart) {
+		err = ErrBadAmount
+		return
+	}
+
+	for len(fracPart) < 2 {
+		fracPart += "0"
+	}
+
+	if len(intPart) == 0 {
+		intPart = "0"
+	}
+
+	yuan, err := strconv.ParseInt(intPart, 10, 64)
+	if err != nil || yuan > math.MaxInt64/100-1 {
+		err = ErrBadAmount
+		return
+	}
+
+	fen, _ := strconv.ParseInt(fracPart, 10, 64)
+
+	amount.fen = yuan*100 + fen
+	if negative {
+		amount.fen = -amount.fen
+	}
+
+	return
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Fen 以分为单位的金额
+func (p Amount) Fen() int64 {
+	return p.fen
+}
+
+func (p Amount) Currency() Currency {
+	if len(p.currency) == 0 {
+		return CNY
+	}
+	return p.currency
+}
+
+// WithCurrency 返回相同数值、指定币种的金额
+func (p Amount) WithCurrency(currency Currency) Amount {
+	return Amount{fen: p.fen, currency: currency}
+}
+
+func (p Amount) IsZero() bool {
+	return p.fen == 0
+}
+
+// Sign 返回 -1, 0 或 1
+func (p Amount) Sign() int {
+	switch {
+	case p.fen < 0:
+		return -1
+	case p.fen > 0:
+		return 1
+	}
+	return 0
+}
+
+// Equal 数值和币种都相同
+func (p Amount) Equal(o Amount) bool {
+	return p.fen == o.fen && p.Currency() == o.Currency()
+}
+
+// Cmp 比较大小，币种不同时返回错误
+func (p Amount) Cmp(o Amount) (c int, err error) {
+	if p.Currency() != o.Currency() {
+		err = ErrCurrencyMismatch
+		return
+	}
+
+	switch {
+	case p.fen < o.fen:
+		c = -1
+	case p.fen > o.fen:
+		c = 1
+	}
+
+	return
+}
+
+// Add 相加，币种不同或溢出时返回错误
+func (p Amount) Add(o Amount) (sum Amount, err error) {
+	if p.Currency() != o.Currency() {
+		err = ErrCurrencyMismatch
+		return
+	}
+
+	if o.fen > 0 && p.fen > math.MaxInt64-o.fen || o.fen < 0 && p.fen < math.MinInt64-o.fen {
+		err = ErrAmountOverflow
+		return
+	}
+
+	sum = Amount{fen: p.fen + o.fen, currency: p.currency}
+
+	return
+}
+
+// Sub 相减，币种不同或溢出时返回错误
+func (p Amount) Sub(o Amount) (diff Amount, err error) {
+	if o.fen == math.MinInt64 {
+		err = ErrAmountOverflow
+		return
+	}
+
+	return p.Add(Amount{fen: -o.fen, currency: o.currency})
+}
+
+// Neg 取反
+func (p Amount) Neg() Amount {
+	return Amount{fen: -p.fen, currency: p.currency}
+}
+
+// String 格式为 "123.45"，与招行接口一致
+func (p Amount) String() string {
+	fen := p.fen
+
+	sign := ""
+	if fen < 0 {
+		sign = "-"
+	}
+
+	// MinInt64 取反会溢出，按无符号处理
+	abs := uint64(fen)
+	if fen < 0 {
+		abs = uint64(-(fen + 1)) + 1
+	}
+
+	frac := strconv.FormatUint(abs%100, 10)
+	if len(frac) < 2 {
+		frac = "0" + frac
+	}
+
+	return sign + strconv.FormatUint(abs/100, 10) + "." + frac
+}
+
+func (p Amount) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(p.String(), start)
+}
+
+func (p *Amount) UnmarshalXML(d *xml.Decoder, start xml.StartElement) (err error) {
+	var s string
+	if err = d.DecodeElement(&s, &start); err != nil {
+		return
+	}
+
+	amount, err := ParseAmount(s)
+	if err != nil {
+		return
+	}
+
+	p.fen = amount.fen
+
+	return
+}
+
+func (p Amount) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Amount) UnmarshalText(text []byte) (err error) {
+	amount, err := ParseAmount(string(text))
+	if err != nil {
+		return
+	}
+
+	p.fen = amount.fen
+
+	return
+}
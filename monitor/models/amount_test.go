@@ -0,0 +1,167 @@
+package models
+
+import (
+	"encoding/xml"
+	"math"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in   string
+		fen  int64
+		want string
+		err  error
+	}{
+		{"", 0, "0.00", nil},
+		{"0", 0, "0.00", nil},
+		{"1", 100, "1.00", nil},
+		{"1.5", 150, "1.50", nil},
+		{"1.05", 105, "1.05", nil},
+		{".05", 5, "0.05", nil},
+		{"12.", 1200, "12.00", nil},
+		{" 123.45 ", 12345, "123.45", nil},
+		{"+0.01", 1, "0.01", nil},
+		{"-0.01", -1, "-0.01", nil},
+		{"-1234567.89", -123456789, "-1234567.89", nil},
+		{"0.10", 10, "0.10", nil},
+		{"92233720368547757.00", 9223372036854775700, "92233720368547757.00", nil},
+		{"92233720368547758.00", 0, "", ErrBadAmount},
+		{"1.234", 0, "", ErrBadAmount},
+		{".", 0, "", ErrBadAmount},
+		{"-", 0, "", ErrBadAmount},
+		{"1,000.00", 0, "", ErrBadAmount},
+		{"1e3", 0, "", ErrBadAmount},
+		{"abc", 0, "", ErrBadAmount},
+		{"--1", 0, "", ErrBadAmount},
+	}
+
+	for _, tt := range tests {
+		amount, err := ParseAmount(tt.in)
+		if err != tt.err {
+			t.Errorf("ParseAmount(%q) error = %v, want %v", tt.in, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		if amount.Fen() != tt.fen {
+			t.Errorf("ParseAmount(%q) = %d fen, want %d", tt.in, amount.Fen(), tt.fen)
+		}
+
+		if s := amount.String(); s != tt.want {
+			t.Errorf("ParseAmount(%q).String() = %q, want %q", tt.in, s, tt.want)
+		}
+
+		// 格式化后再解析得到相同的金额
+		again, err := ParseAmount(amount.String())
+		if err != nil || !again.Equal(amount) {
+			t.Errorf("round trip of %q = %v, %v", tt.in, again, err)
+		}
+	}
+}
+
+func TestAmountString(t *testing.T) {
+	tests := []struct {
+		fen  int64
+		want string
+	}{
+		{0, "0.00"},
+		{1, "0.01"},
+		{-1, "-0.01"},
+		{99, "0.99"},
+		{100, "1.00"},
+		{-100005, "-1000.05"},
+		{math.MaxInt64, "92233720368547758.07"},
+		{math.MinInt64, "-92233720368547758.08"},
+	}
+
+	for _, tt := range tests {
+		if s := Fen(tt.fen).String(); s != tt.want {
+			t.Errorf("Fen(%d).String() = %q, want %q", tt.fen, s, tt.want)
+		}
+	}
+}
+
+func TestAmountArithmetic(t *testing.T) {
+	sum, err := Fen(10).Add(Fen(20))
+	if err != nil || sum.Fen() != 30 {
+		t.Errorf("0.10 + 0.20 = %v, %v", sum, err)
+	}
+
+	diff, err := Fen(10).Sub(Fen(30))
+	if err != nil || diff.Fen() != -20 || diff.Sign() != -1 {
+		t.Errorf("0.10 - 0.30 = %v, %v", diff, err)
+	}
+
+	if _, err = Fen(math.MaxInt64).Add(Fen(1)); err != ErrAmountOverflow {
+		t.Errorf("overflow error = %v, want %v", err, ErrAmountOverflow)
+	}
+
+	if _, err = Fen(0).Sub(Fen(math.MinInt64)); err != ErrAmountOverflow {
+		t.Errorf("overflow error = %v, want %v", err, ErrAmountOverflow)
+	}
+
+	usd := NewAmount(100, "21")
+	if _, err = Fen(100).Add(usd); err != ErrCurrencyMismatch {
+		t.Errorf("currency error = %v, want %v", err, ErrCurrencyMismatch)
+	}
+
+	if _, err = Fen(100).Cmp(usd); err != ErrCurrencyMismatch {
+		t.Errorf("currency error = %v, want %v", err, ErrCurrencyMismatch)
+	}
+
+	if c, err := Fen(100).Cmp(Fen(99)); err != nil || c != 1 {
+		t.Errorf("Cmp = %d, %v, want 1", c, err)
+	}
+
+	if !Fen(5).Equal(NewAmount(5, CNY)) {
+		t.Error("empty currency should equal CNY")
+	}
+}
+
+func TestAmountXML(t *testing.T) {
+	type item struct {
+		XMLName xml.Name `xml:"NTQACINFZ"`
+		ACCBLV  Amount   `xml:"ACCBLV"`
+		ONLBLV  Amount   `xml:"ONLBLV"`
+	}
+
+	in := item{ACCBLV: Fen(123456), ONLBLV: Fen(-5)}
+
+	data, err := xml.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<NTQACINFZ><ACCBLV>1234.56</ACCBLV><ONLBLV>-0.05</ONLBLV></NTQACINFZ>"
+	if string(data) != want {
+		t.Errorf("Marshal = %s, want %s", data, want)
+	}
+
+	var out item
+	if err = xml.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if !out.ACCBLV.Equal(in.ACCBLV) || !out.ONLBLV.Equal(in.ONLBLV) {
+		t.Errorf("Unmarshal = %+v, want %+v", out, in)
+	}
+
+	if err = xml.Unmarshal([]byte("<NTQACINFZ><ACCBLV>1.234</ACCBLV></NTQACINFZ>"), &out); err != ErrBadAmount {
+		t.Errorf("Unmarshal bad amount error = %v, want %v", err, ErrBadAmount)
+	}
+}
+
+func TestAmountText(t *testing.T) {
+	var a Amount
+	if err := a.UnmarshalText([]byte("88.8")); err != nil || a.Fen() != 8880 {
+		t.Errorf("UnmarshalText = %v, %v", a, err)
+	}
+
+	text, err := a.MarshalText()
+	if err != nil || string(text) != "88.80" {
+		t.Errorf("MarshalText = %s, %v", text, err)
+	}
+}
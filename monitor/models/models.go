@@ -2,8 +2,8 @@ package models
 
 import (
 	"encoding/xml"
-	"fmt"
 	"strconv"
+	"strings"
 )
 
 type ReqBasicInfo struct {
@@ -11,12 +11,71 @@ type ReqBasicInfo struct {
 	DATTYP int    `xml:"INFO>DATTYP"`
 	LGNNAM string `xml:"INFO>LGNNAM"`
 }
+
+// DATTYPXML 数据格式: XML
+const DATTYPXML = 2
+
+// SetBasicInfo 由客户端在发送前统一填写
+func (p *ReqBasicInfo) SetBasicInfo(info ReqBasicInfo) {
+	*p = info
+}
+
 type RespBasicInfo struct {
 	FUNNAM string `xml:"INFO>FUNNAM"`
 	DATTYP int    `xml:"INFO>DATTYP"`
 	RETCOD int64  `xml:"INFO>RETCOD"` // 检查操作错误. (如: 期望日期错误.)
 	ERRMSG string `xml:"INFO>ERRMSG"` // 返回操作错误
 }
+
+// RETCOD 返回码
+const (
+	RETCODSuccess        int64 = 0  // 成功
+	RETCODFailure        int64 = -1 // 失败
+	RETCODExecuteFailure int64 = -2 // 执行失败
+	RETCODBadFormat      int64 = -3 // 数据格式错误
+	RETCODNotLoggedIn    int64 = -4 // 尚未登录系统
+	RETCODTooFrequent    int64 = -5 // 请求太频繁
+	RETCODNotCertUser    int64 = -6 // 不是证书卡用户
+	RETCODCancelled      int64 = -7 // 用户取消操作
+	RETCODOther          int64 = -9 // 其他错误
+)
+
+const ERRMSGSignatureError = "签名错误，请检查证书卡是否正确插入"
+
+// ERRCOD 业务错误码
+const (
+	ERRCODSuccess         = "SUC0000" // 成功
+	ERRCODDuplicateYURREF = "CSAC006" // 业务参考号重复
+)
+
+// 业务请求状态 REQSTS
+var REQSTSs = map[string]string{
+	"AUT": "等待审批",
+	"NTE": "终审完毕",
+	"WCF": "订单待确认",
+	"BNK": "银行处理中",
+	"FIN": "完成",
+	"ACK": "等待确认",
+	"APD": "待银行确认",
+	"OPR": "数据接收中",
+}
+
+// 业务处理结果 RTNFLG, 仅在 REQSTS 为 FIN 时有意义
+var RTNFLGs = map[string]string{
+	"S": "成功",
+	"F": "失败",
+	"B": "退票",
+	"R": "否决",
+	"D": "过期",
+	"C": "撤消",
+	"U": "银行挂账",
+}
+
+type Request interface {
+	FunctionName() string
+	SetBasicInfo(info ReqBasicInfo)
+}
+
 type Response interface {
 	Validate() (err error)
 }
@@ -32,6 +91,28 @@ func (p ErrActionFailed) Error() string {
 	return "CMB Enterprise error: " + p.FUNNAM + "; Return code: " + strconv.FormatInt(p.RETCOD, 10) + "; Error message: " + p.ERRMSG
 }
 
+// Is 用于 errors.Is, target 中为空的字段不参与比较, ERRMSG 按包含匹配
+func (p ErrActionFailed) Is(target error) bool {
+	t, ok := target.(ErrActionFailed)
+	if !ok {
+		return false
+	}
+
+	if len(t.FUNNAM) > 0 && t.FUNNAM != p.FUNNAM {
+		return false
+	}
+
+	if t.RETCOD != 0 && t.RETCOD != p.RETCOD {
+		return false
+	}
+
+	if len(t.ERRMSG) > 0 && !strings.Contains(p.ERRMSG, t.ERRMSG) {
+		return false
+	}
+
+	return true
+}
+
 // 验证是否有操作错误.
 func (p *RespBasicInfo) Validate() (err error) {
 	if p.RETCOD != 0 {
@@ -45,31 +126,27 @@ func (p *RespBasicInfo) Validate() (err error) {
 	return
 }
 
-type PrettyFloat float64
-
-func (f PrettyFloat) MarshalXML(e *xml.Encoder, start xml.StartElement) (err error) {
-	e.EncodeElement(fmt.Sprintf("%.2f", f), start)
-	return
-}
-
 // 支付
 type ReqDirectPayment struct {
 	XMLName xml.Name `xml:"CMBSDKPGK"`
 	ReqBasicInfo
-	BUSCOD string      `xml:"SDKPAYRQX>BUSCOD"`
-	YURREF string      `xml:"DCOPDPAYX>YURREF"` // System serial number
-	DBTACC string      `xml:"DCOPDPAYX>DBTACC"` // 付方账号
-	DBTBBK string      `xml:"DCOPDPAYX>DBTBBK"` // 付方开户地区代码
-	TRSAMT PrettyFloat `xml:"DCOPDPAYX>TRSAMT"`
-	CCYNBR string      `xml:"DCOPDPAYX>CCYNBR"`
-	STLCHN string      `xml:"DCOPDPAYX>STLCHN"` // 结算方式代码: N:普通转出/F:快速转出
-	NUSAGE string      `xml:"DCOPDPAYX>NUSAGE"`
-	BNKFLG string      `xml:"DCOPDPAYX>BNKFLG"`           // 是否招行：Y/N
-	CRTACC string      `xml:"DCOPDPAYX>CRTACC"`           // 收款企业转入账号
-	CRTNAM string      `xml:"DCOPDPAYX>CRTNAM"`           // 收方账户名
-	CRTBNK string      `xml:"DCOPDPAYX>CRTBNK,omitempty"` // 收方开户行（跨行支付必填）
-	CRTADR string      `xml:"DCOPDPAYX>CRTADR,omitempty"` // 收方行地址（跨行支付必填）
+	BUSCOD string `xml:"SDKPAYRQX>BUSCOD"`
+	YURREF string `xml:"DCOPDPAYX>YURREF"` // System serial number
+	DBTACC string `xml:"DCOPDPAYX>DBTACC"` // 付方账号
+	DBTBBK string `xml:"DCOPDPAYX>DBTBBK"` // 付方开户地区代码
+	TRSAMT Amount `xml:"DCOPDPAYX>TRSAMT"`
+	CCYNBR string `xml:"DCOPDPAYX>CCYNBR"`
+	STLCHN string `xml:"DCOPDPAYX>STLCHN"` // 结算方式代码: N:普通转出/F:快速转出
+	NUSAGE string `xml:"DCOPDPAYX>NUSAGE"`
+	BNKFLG string `xml:"DCOPDPAYX>BNKFLG"`           // 是否招行：Y/N
+	CRTACC string `xml:"DCOPDPAYX>CRTACC"`           // 收款企业转入账号
+	CRTNAM string `xml:"DCOPDPAYX>CRTNAM"`           // 收方账户名
+	CRTBNK string `xml:"DCOPDPAYX>CRTBNK,omitempty"` // 收方开户行（跨行支付必填）
+	CRTADR string `xml:"DCOPDPAYX>CRTADR,omitempty"` // 收方行地址（跨行支付必填）
 }
+
+func (ReqDirectPayment) FunctionName() string { return "DCPAYMNT" }
+
 type RespDirectPayment struct {
 	XMLName xml.Name `xml:"CMBSDKPGK"`
 	RespBasicInfo
@@ -91,29 +168,35 @@ type ReqGetPaymentInfo struct {
 	ENDDAT string `xml:"SDKPAYQYX>ENDDAT"` // 结束日期
 	YURREF string `xml:"SDKPAYQYX>YURREF,omitempty"`
 }
+
+func (ReqGetPaymentInfo) FunctionName() string { return "GetPaymentInfo" }
+
+// GetPaymentInfoMaxDays 单次查询的最大日期跨度
+const GetPaymentInfoMaxDays = 100
+
 type RespGetPaymentInfo struct {
 	XMLName xml.Name `xml:"CMBSDKPGK"`
 	RespBasicInfo
 	NTQPAYQYZ []RespGetPaymentInfoListItem `xml:"NTQPAYQYZ"`
 }
 type RespGetPaymentInfoListItem struct {
-	BUSMOD   string      `xml:"BUSMOD"` // 业务模式
-	CRTACC   string      `xml:"CRTACC"`
-	CRTADR   string      `xml:"CRTADR"`
-	CRTBNK   string      `xml:"CRTBNK"`
-	CRTNAM   string      `xml:"CRTNAM"`
-	TRSAMT   PrettyFloat `xml:"TRSAMT"`
-	BNKFLG   string      `xml:"BNKFLG"`
-	STLCHN   string      `xml:"STLCHN"`
-	NUSAGE   string      `xml:"NUSAGE"`
-	OPRDAT   string      `xml:"OPRDAT"`
-	YURREF   string      `xml:"YURREF"`
-	REQNBR   string      `xml:"REQNBR"`
-	C_REQSTS string      `xml:"C_REQSTS"`
-	REQSTS   string      `xml:"REQSTS"`
-	C_RTNFLG string      `xml:"C_RTNFLG"`
-	RTNFLG   string      `xml:"RTNFLG"`
-	RTNNAR   string      `xml:"RTNNAR"` // 支付失败原因/退票原因
+	BUSMOD   string `xml:"BUSMOD"` // 业务模式
+	CRTACC   string `xml:"CRTACC"`
+	CRTADR   string `xml:"CRTADR"`
+	CRTBNK   string `xml:"CRTBNK"`
+	CRTNAM   string `xml:"CRTNAM"`
+	TRSAMT   Amount `xml:"TRSAMT"`
+	BNKFLG   string `xml:"BNKFLG"`
+	STLCHN   string `xml:"STLCHN"`
+	NUSAGE   string `xml:"NUSAGE"`
+	OPRDAT   string `xml:"OPRDAT"`
+	YURREF   string `xml:"YURREF"`
+	REQNBR   string `xml:"REQNBR"`
+	C_REQSTS string `xml:"C_REQSTS"`
+	REQSTS   string `xml:"REQSTS"`
+	C_RTNFLG string `xml:"C_RTNFLG"`
+	RTNFLG   string `xml:"RTNFLG"`
+	RTNNAR   string `xml:"RTNNAR"` // 支付失败原因/退票原因
 	//C_BUSCOD string `xml:"C_BUSCOD"`
 	//BUSCOD   string `xml:"BUSCOD"`
 	//C_DBTBBK string `xml:"C_DBTBBK"`
@@ -146,6 +229,9 @@ type ReqGetBalanceInfo struct {
 	ReqBasicInfo
 	SDKACINFX []ReqGetBalanceInfoItem `xml:"SDKACINFX"`
 }
+
+func (ReqGetBalanceInfo) FunctionName() string { return "GetAccInfo" }
+
 type ReqGetBalanceInfoItem struct {
 	BBKNBR int    `xml:"BBKNBR"`
 	ACCNBR string `xml:"ACCNBR"`
@@ -156,27 +242,89 @@ type RespGetBalanceInfo struct {
 	NTQACINFZ []RespGetBalanceInfoItem `xml:"NTQACINFZ"`
 }
 type RespGetBalanceInfoItem struct {
-	ACCBLV float64 `xml:"ACCBLV"` // 上日余额
-	ONLBLV float64 `xml:"ONLBLV"` // 联机余额
-	HLDBLV float64 `xml:"HLDBLV"` // 冻结余额
-	AVLBLV float64 `xml:"AVLBLV"` // 可用余额
+	BBKNBR int    `xml:"BBKNBR"` // 分行号
+	ACCNBR string `xml:"ACCNBR"` // 账号
+	CCYNBR string `xml:"CCYNBR"` // 币种
+	ACCBLV Amount `xml:"ACCBLV"` // 上日余额
+	ONLBLV Amount `xml:"ONLBLV"` // 联机余额
+	HLDBLV Amount `xml:"HLDBLV"` // 冻结余额
+	AVLBLV Amount `xml:"AVLBLV"` // 可用余额
 	//LMTOVR  []string        `xml:"LMTOVR"`
-	//BBKNBR  []string        `xml:"BBKNBR"`
 	//DPSTXT  []string        `xml:"DPSTXT"`
 	//ACCNAM  []string        `xml:"ACCNAM"`
 	//STSCOD  []string        `xml:"STSCOD"`
 	//MUTDAT  []string        `xml:"MUTDAT"`
 	//ACCITM  []string        `xml:"ACCITM"`
-	//CCYNBR  []string        `xml:"CCYNBR"`
 	//C_CCYNBR        []string        `xml:"C_CCYNBR"`
 	//OPNDAT  []string        `xml:"OPNDAT"`
 	//INTCOD  []string        `xml:"INTCOD"`
-	//ACCNBR  []string        `xml:"ACCNBR"`
 	//C_INTRAT        []string        `xml:"C_INTRAT"`
 }
+
+// BalanceInfo 金额的币种取自 CCYNBR
+func (p *RespGetBalanceInfoItem) BalanceInfo() BalanceInfo {
+	currency := Currency(p.CCYNBR)
+
+	return BalanceInfo{
+		BBKNBR:           p.BBKNBR,
+		ACCNBR:           p.ACCNBR,
+		CCYNBR:           p.CCYNBR,
+		AvailableBalance: p.AVLBLV.WithCurrency(currency),
+		FreezingBalance:  p.HLDBLV.WithCurrency(currency),
+		OnlineBalance:    p.ONLBLV.WithCurrency(currency),
+		YesterdayBalance: p.ACCBLV.WithCurrency(currency),
+	}
+}
+
 type BalanceInfo struct {
-	AvailableBalance int64 // 可用余额
-	FreezingBalance  int64 // 冻结余额
-	OnlineBalance    int64 // 联机余额
-	YesterdayBalance int64 // 昨日余额
+	BBKNBR           int    // 分行号
+	ACCNBR           string // 账号
+	CCYNBR           string // 币种
+	AvailableBalance Amount // 可用余额
+	FreezingBalance  Amount // 冻结余额
+	OnlineBalance    Amount // 联机余额
+	YesterdayBalance Amount // 昨日余额
+}
+
+// 账务明细查询
+type ReqGetTransInfo struct {
+	XMLName xml.Name `xml:"CMBSDKPGK"`
+	ReqBasicInfo
+	BBKNBR int    `xml:"SDKTSINFX>BBKNBR"`           // 分行号
+	ACCNBR string `xml:"SDKTSINFX>ACCNBR"`           // 账号
+	BGNDAT string `xml:"SDKTSINFX>BGNDAT"`           // 开始日期
+	ENDDAT string `xml:"SDKTSINFX>ENDDAT"`           // 结束日期
+	AMTCDR string `xml:"SDKTSINFX>AMTCDR,omitempty"` // 借贷码 C:贷 D:借，为空时全部返回
+	CTNKEY string `xml:"SDKTSINFX>CTNKEY,omitempty"` // 续传键值，首次查询为空
+}
+
+func (ReqGetTransInfo) FunctionName() string { return "GetTransInfo" }
+
+// GetTransInfoMaxDays 单次查询的最大日期跨度
+const GetTransInfoMaxDays = 100
+
+type RespGetTransInfo struct {
+	XMLName xml.Name `xml:"CMBSDKPGK"`
+	RespBasicInfo
+	NTQTSINFZ []RespGetTransInfoItem `xml:"NTQTSINFZ"`
+	CTNKEY    string                 `xml:"NTQTSINFY>CTNKEY"` // 不为空时还有数据，需带上继续查询
+}
+
+type RespGetTransInfoItem struct {
+	ETYDAT string `xml:"ETYDAT"` // 交易日
+	ETYTIM string `xml:"ETYTIM"` // 交易时间
+	VLTDAT string `xml:"VLTDAT"` // 起息日
+	TRSCOD string `xml:"TRSCOD"` // 交易类型
+	NARTXT string `xml:"NARTXT"` // 摘要
+	AMTCDR string `xml:"AMTCDR"` // 借贷标记 C:贷 D:借
+	TRSAMT Amount `xml:"TRSAMT"` // 交易金额，借方为负
+	TRSBLV Amount `xml:"TRSBLV"` // 余额
+	REFNBR string `xml:"REFNBR"` // 流水号
+	REQNBR string `xml:"REQNBR"` // 流程实例号
+	BUSNAM string `xml:"BUSNAM"` // 业务名称
+	NUSAGE string `xml:"NUSAGE"` // 用途
+	YURREF string `xml:"YURREF"` // 业务参考号
+	RPYACC string `xml:"RPYACC"` // 收/付方账号
+	RPYNAM string `xml:"RPYNAM"` // 收/付方名称
+	RPYBNK string `xml:"RPYBNK"` // 收/付方开户行
 }
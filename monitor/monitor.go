@@ -1,24 +1,14 @@
 package monitor
 
 import (
-	"bytes"
-	"encoding/xml"
+	"context"
 	"errors"
-	"io/ioutil"
-	"net/http"
-	"strings"
 	"time"
 
 	"github.com/go-akka/configuration"
+	"github.com/gogap/cmb_robot/cmbclient"
 	"github.com/gogap/cmb_robot/monitor/models"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/text/encoding/simplifiedchinese"
-	"golang.org/x/text/transform"
-)
-
-var (
-	GBKEncoder transform.Transformer = simplifiedchinese.GBK.NewEncoder()
-	GBKDecoder transform.Transformer = simplifiedchinese.GBK.NewDecoder()
 )
 
 var (
@@ -36,10 +26,6 @@ var (
 
 const CMBRespErrCodeSuc = "SUC0000"
 
-var httpCli http.Client = http.Client{
-	Timeout: 29 * time.Second,
-}
-
 type CMBMonitor struct {
 	url       string
 	username  string
@@ -49,10 +35,30 @@ type CMBMonitor struct {
 	status    string
 	date      string
 
+	// 没有手动配置探测交易时自动选取，见 canary.go
+	manual       bool
+	lookbackDays int
+	maxAgeDays   int
+	payee        string
+
+	// 没有找到参考支付时，在 canaryRetryAt 之前只查询当天的支付，重新选取的间隔逐次加倍
+	canaryRetryAt time.Time
+	canaryBackoff time.Duration
+
+	now func() time.Time
+
+	client cmbclient.Caller
+	probe  Probe // 签名检查，为空时不检查
+
 	networkCheckedTimes int64
 }
 
 func NewCMBMonitor(conf *configuration.Config) (mon *CMBMonitor, err error) {
+	return NewCMBMonitorWithClient(conf, nil)
+}
+
+// NewCMBMonitorWithClient client 为空时按配置中的 url 和 username 创建
+func NewCMBMonitorWithClient(conf *configuration.Config, client cmbclient.Caller) (mon *CMBMonitor, err error) {
 
 	url := conf.GetString("url")
 	if len(url) == 0 {
@@ -67,33 +73,58 @@ func NewCMBMonitor(conf *configuration.Config) (mon *CMBMonitor, err error) {
 	}
 
 	systemSN := conf.GetString("system-sn")
-	if len(systemSN) == 0 {
-		err = ErrChannelSNIsEmpty
-		return
-	}
-
 	channelSN := conf.GetString("channel-sn")
-	if len(channelSN) == 0 {
-		err = ErrChannelSNIsEmpty
-		return
+	amount := conf.GetInt64("amount")
+	status := conf.GetString("status")
+	date := conf.GetString("date")
+
+	manual := len(systemSN) > 0 || len(channelSN) > 0 || len(date) > 0
+
+	if manual {
+		if len(systemSN) == 0 {
+			err = ErrSystemSNIsEmpty
+			return
+		}
+
+		if len(channelSN) == 0 {
+			err = ErrChannelSNIsEmpty
+			return
+		}
+
+		if amount == 0 {
+			err = ErrAmountIsZero
+			return
+		}
+
+		if len(status) == 0 {
+			err = ErrStatusIsEmpty
+			return
+		}
+
+		if len(date) == 0 {
+			err = ErrDateIsEmpty
+			return
+		}
 	}
 
-	amount := conf.GetInt64("amount")
-	if amount == 0 {
-		err = ErrAmountIsZero
+	lookbackDays := int(conf.GetInt32("canary-lookback-days", DefaultCanaryLookbackDays))
+	maxAgeDays := int(conf.GetInt32("canary-max-age-days", DefaultCanaryMaxAgeDays))
+
+	if !manual && (lookbackDays <= 0 || maxAgeDays <= 0) {
+		err = ErrBadCanaryWindow
 		return
 	}
 
-	status := conf.GetString("status")
-	if len(status) == 0 {
-		err = ErrStatusIsEmpty
+	probe, err := NewProbe(conf)
+	if err != nil {
 		return
 	}
 
-	date := conf.GetString("date")
-	if len(date) == 0 {
-		err = ErrDateIsEmpty
-		return
+	if client == nil {
+		client, err = cmbclient.New(url, username, cmbclient.DefaultOptions())
+		if err != nil {
+			return
+		}
 	}
 
 	mon = &CMBMonitor{
@@ -104,60 +135,35 @@ func NewCMBMonitor(conf *configuration.Config) (mon *CMBMonitor, err error) {
 		amount:    amount,
 		status:    status,
 		date:      date,
+		client:    client,
+		probe:     probe,
+
+		manual:       manual,
+		lookbackDays: lookbackDays,
+		maxAgeDays:   maxAgeDays,
+		payee:        conf.GetString("canary-payee"),
+
+		now: time.Now,
 	}
 
 	return mon, nil
 }
-func (p *CMBMonitor) request(req interface{}, resp models.Response) (reqStr, respStr string, err error) {
-	reqBytes, err := xml.Marshal(req)
-	if err != nil {
-		return
-	}
-	reqBytes = append([]byte(`<?xml version="1.0" encoding = "GBK"?>`), reqBytes...)
-	//logrus.WithField("username",p.username).Debugln("request: ", string(reqBytes))
-	reqStr, _, err = transform.String(GBKEncoder, string(reqBytes))
-	if err != nil {
-		return
-	}
 
-	reqReader := bytes.NewReader([]byte(reqStr))
-	rawResp, err := httpCli.Post(p.url, "application/json", reqReader)
-	if err != nil {
-		// logrus.WithField("username", p.username).Errorln(err)
-		return
-	}
-	defer rawResp.Body.Close()
-	respBody, err := ioutil.ReadAll(rawResp.Body)
-	if err != nil {
-		// logrus.WithField("username", p.username).Errorln(err)
-		return
-	}
-	respStr, _, err = transform.String(GBKDecoder, string(respBody))
-	if err != nil {
-		// logrus.WithField("username", p.username).Errorln(err)
-		return
-	}
-
-	respStr = strings.Replace(respStr, "GBK", "UTF-8", 1)
-	//logrus.WithField("username", p.username).Debugln("response xml: ", respStr)
-	respBytes := []byte(respStr)
-	err = xml.Unmarshal(respBytes, resp)
-	if err != nil {
-		// logrus.WithField("username", p.username).Errorln(err)
-		return
-	}
-	//logrus.WithField("username",p.username).Debugf("CMB Enterprise Response: %+v", resp)
-	err = resp.Validate()
-	if err != nil {
-		// logrus.WithField("username", p.username).Errorln(err)
-		return
-	}
-	return
+func (p *CMBMonitor) Ping() error {
+	return p.PingContext(context.Background())
 }
 
-func (p *CMBMonitor) Ping() (err error) {
+// PingContext 失败时返回 *PingError，可用 Diagnose 取得失败原因。
+// ctx 被取消时正在进行的请求立即返回
+func (p *CMBMonitor) PingContext(ctx context.Context) (err error) {
+
+	defer func() {
+		if err != nil {
+			err = &PingError{Diagnosis: Diagnose(err), Err: err}
+		}
+	}()
 
-	err = p.pingNetwork()
+	err = p.pingNetwork(ctx)
 
 	if err != nil {
 		return
@@ -169,54 +175,29 @@ func (p *CMBMonitor) Ping() (err error) {
 
 	p.networkCheckedTimes = 0
 
-	lastSN := "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFF"
-
-	req := &models.ReqDirectPayment{
-		ReqBasicInfo: models.ReqBasicInfo{
-			FUNNAM: "DCPAYMNT",
-			DATTYP: 2,
-			LGNNAM: p.username,
-		},
-
-		BUSCOD: "N02031",
-
-		YURREF: lastSN,
-		DBTACC: "0000000000000000",
-		DBTBBK: "92",
-		CCYNBR: "10",
-		NUSAGE: "机器人出金测试",
-		BNKFLG: "Y",
-
-		STLCHN: "N",
-		CRTBNK: "招商银行",
-		TRSAMT: 0,
-		CRTACC: "0000000000000000",
-		CRTNAM: "",
+	if p.probe == nil {
+		return
 	}
 
-	resp := models.RespGetPaymentInfo{}
-	_, _, err = p.request(req, &resp)
-
-	if err != nil {
-		if strings.Contains(err.Error(), "签名错误，请检查证书卡是否正确插入") {
-			return
-		}
-		err = nil
-	}
+	logrus.WithField("username", p.username).WithField("probe", p.probe.Kind()).Debugln("执行签名检查")
 
-	return nil
+	return p.probe.Check(ctx, p.client)
 }
 
-func (p *CMBMonitor) pingNetwork() (err error) {
+func (p *CMBMonitor) pingNetwork(ctx context.Context) (err error) {
 
 	p.networkCheckedTimes++
 
+	logrus.WithField("username", p.username).WithField("probe", probeKindPaymentInfo).Debugln("执行探测")
+
+	if now := p.now(); !p.manual && p.canaryExpired(now) {
+		if now.Before(p.canaryRetryAt) {
+			return p.queryToday(ctx, now)
+		}
+		return p.provisionCanary(ctx, now)
+	}
+
 	req := &models.ReqGetPaymentInfo{
-		ReqBasicInfo: models.ReqBasicInfo{
-			FUNNAM: "GetPaymentInfo",
-			DATTYP: 2,
-			LGNNAM: p.username,
-		},
 		BUSCOD: "N02031",
 		BGNDAT: p.date,
 		ENDDAT: p.date,
@@ -224,7 +205,7 @@ func (p *CMBMonitor) pingNetwork() (err error) {
 	}
 
 	resp := models.RespGetPaymentInfo{}
-	_, _, err = p.request(req, &resp)
+	err = p.client.Call(ctx, req, &resp)
 	if err != nil {
 		// logrus.WithField("username", p.username).Errorln(err)
 		return
@@ -233,12 +214,17 @@ func (p *CMBMonitor) pingNetwork() (err error) {
 	if len(resp.NTQPAYQYZ) != 1 {
 		err = ErrBadTXCount
 		logrus.WithField("username", p.username).WithField("count", len(resp.NTQPAYQYZ)).Errorln("与期望的返回数据量不匹配")
+
+		// 自动选取的参考支付可能已查询不到，下次重新选取
+		if !p.manual {
+			p.date = ""
+		}
 		return
 	}
 
 	item := resp.NTQPAYQYZ[0]
 
-	if int64(item.TRSAMT*100) != p.amount {
+	if item.TRSAMT.Fen() != p.amount {
 		err = ErrBadRespTXAmount
 		logrus.WithField("username", p.username).WithField("response_amount", item.TRSAMT).WithField("expect", p.amount).Errorln("与期望的交易金额大小不对")
 		return
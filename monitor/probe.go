@@ -0,0 +1,137 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-akka/configuration"
+	"github.com/gogap/cmb_robot/cmbclient"
+	"github.com/gogap/cmb_robot/monitor/models"
+)
+
+var (
+	ErrUnknownProbe        = errors.New("unknown probe kind")
+	ErrProbeAccountIsEmpty = errors.New("probe account is empty")
+)
+
+// 签名检查的种类，对应配置项 probe
+const (
+	ProbeNone    = "none"    // 不做签名检查，只查询探测交易
+	ProbeBalance = "balance" // 查询 probe-account 的余额，只读
+	ProbePayment = "payment" // 发送金额为0的 DCPAYMNT 请求，需要显式开启
+)
+
+// DefaultProbe 未配置 probe 时的签名检查，需要填写 probe-account，不检查时需显式配置 none
+const DefaultProbe = ProbeBalance
+
+// ProbeKinds 可用的签名检查种类
+var ProbeKinds = map[string]string{
+	ProbeNone:    "不做签名检查",
+	ProbeBalance: "余额查询",
+	ProbePayment: "支付请求",
+}
+
+// 只查询探测交易的周期在日志中的种类
+const probeKindPaymentInfo = "payment-info"
+
+// Probe 每隔几次探测执行一次的签名检查，确认 USBKey 和登录会话仍然有效
+type Probe interface {
+	Kind() string
+	Check(ctx context.Context, client cmbclient.Caller) error
+}
+
+// NewProbe 按配置创建签名检查，probe 为空时查询 probe-account 的余额，没有填写 probe-account 时返回错误。
+// 返回 nil 表示不做签名检查
+func NewProbe(conf *configuration.Config) (probe Probe, err error) {
+	account := conf.GetString("probe-account")
+
+	kind := conf.GetString("probe", DefaultProbe)
+	if len(kind) == 0 {
+		kind = DefaultProbe
+	}
+
+	switch kind {
+	case ProbeNone:
+	case ProbeBalance:
+		if len(account) == 0 {
+			err = ErrProbeAccountIsEmpty
+			return
+		}
+
+		probe = &BalanceProbe{
+			BBKNBR: int(conf.GetInt32("probe-bbknbr")),
+			ACCNBR: account,
+		}
+	case ProbePayment:
+		probe = &PaymentProbe{}
+	default:
+		err = ErrUnknownProbe
+	}
+
+	return
+}
+
+// ProbeKind 返回使用的签名检查种类
+func (p *CMBMonitor) ProbeKind() string {
+	if p.probe == nil {
+		return ProbeNone
+	}
+	return p.probe.Kind()
+}
+
+// BalanceProbe 查询一个账户的余额 (GetAccInfo)，不会产生任何业务
+type BalanceProbe struct {
+	BBKNBR int
+	ACCNBR string
+}
+
+func (p *BalanceProbe) Kind() string {
+	return ProbeBalance
+}
+
+func (p *BalanceProbe) Check(ctx context.Context, client cmbclient.Caller) error {
+	req := &models.ReqGetBalanceInfo{
+		SDKACINFX: []models.ReqGetBalanceInfoItem{{BBKNBR: p.BBKNBR, ACCNBR: p.ACCNBR}},
+	}
+
+	resp := models.RespGetBalanceInfo{}
+	return client.Call(ctx, req, &resp)
+}
+
+// PaymentProbe 发送一笔金额为0、账号无效的 DCPAYMNT 请求，只关心是否返回签名错误
+type PaymentProbe struct{}
+
+func (p *PaymentProbe) Kind() string {
+	return ProbePayment
+}
+
+func (p *PaymentProbe) Check(ctx context.Context, client cmbclient.Caller) (err error) {
+	lastSN := "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFF"
+
+	req := &models.ReqDirectPayment{
+		BUSCOD: cmbclient.BUSCODPayment,
+
+		YURREF: lastSN,
+		DBTACC: "0000000000000000",
+		DBTBBK: "92",
+		CCYNBR: "10",
+		NUSAGE: "机器人出金测试",
+		BNKFLG: "Y",
+
+		STLCHN: "N",
+		CRTBNK: "招商银行",
+		TRSAMT: models.Amount{},
+		CRTACC: "0000000000000000",
+		CRTNAM: "",
+	}
+
+	resp := models.RespDirectPayment{}
+	err = client.Call(ctx, req, &resp)
+
+	// 账号无效必然失败，只有签名错误说明会话异常
+	if err != nil && !errors.Is(err, cmbclient.ErrSignature) {
+		err = nil
+	}
+
+	return
+}
@@ -0,0 +1,44 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/go-akka/configuration"
+)
+
+func TestNewProbe(t *testing.T) {
+	tests := []struct {
+		conf string
+		kind string
+		err  error
+	}{
+		{`probe-account: "755000001"`, ProbeBalance, nil},
+		{``, "", ErrProbeAccountIsEmpty},
+		{`probe: ""`, "", ErrProbeAccountIsEmpty},
+		{`probe: "balance"`, "", ErrProbeAccountIsEmpty},
+		{`probe: "none"`, ProbeNone, nil},
+		{`probe: "none", probe-account: "755000001"`, ProbeNone, nil},
+		{`probe: "payment"`, ProbePayment, nil},
+		{`probe: "ping"`, "", ErrUnknownProbe},
+	}
+
+	for _, tt := range tests {
+		probe, err := NewProbe(configuration.ParseString("{" + tt.conf + "}"))
+		if err != tt.err {
+			t.Errorf("NewProbe(%s) error = %v, want %v", tt.conf, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		kind := ProbeNone
+		if probe != nil {
+			kind = probe.Kind()
+		}
+
+		if kind != tt.kind {
+			t.Errorf("NewProbe(%s) = %s, want %s", tt.conf, kind, tt.kind)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package password
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnknownSource      = errors.New("unknown password source")
+	ErrEmptyPassword      = errors.New("password is empty")
+	ErrEnvNotSet          = errors.New("password environment variable is not set")
+	ErrBadFD              = errors.New("bad password file descriptor")
+	ErrInsecurePermission = errors.New("password file is accessible by group or others")
+	ErrNotRegularFile     = errors.New("password file is not a regular file")
+	ErrNoCredentialsDir   = errors.New("CREDENTIALS_DIRECTORY is not set")
+	ErrBadCredentialName  = errors.New("bad credential name")
+	ErrEmptyCommand       = errors.New("password helper command is empty")
+)
+
+const (
+	DefaultEnvName        = "CMB_ROBOT_CONFIG_PASSWORD"
+	DefaultCredentialName = "cmb-robot.password"
+)
+
+// Source 配置文件密码的来源
+type Source interface {
+	Name() string
+	Password() ([]byte, error)
+}
+
+// Parse 解析密码来源描述:
+//
+//	tty               交互式输入（默认）
+//	env[:NAME]        环境变量，读取后清除
+//	fd:N              已打开的文件描述符
+//	file:PATH         文件，要求仅属主可读
+//	cmd:PROGRAM ARGS  外部helper程序的标准输出
+//	systemd[:NAME]    $CREDENTIALS_DIRECTORY 下的凭据文件
+func Parse(spec string) (src Source, err error) {
+	kind, arg := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, arg = spec[:i], spec[i+1:]
+	}
+
+	switch kind {
+	case "", "tty":
+		return &TTYSource{Prompt: "请输入配置文件密码:"}, nil
+	case "env":
+		if len(arg) == 0 {
+			arg = DefaultEnvName
+		}
+		return &EnvSource{Key: arg}, nil
+	case "fd":
+		var fd int
+		if fd, err = strconv.Atoi(arg); err != nil || fd < 0 {
+			err = ErrBadFD
+			return
+		}
+		return &FDSource{FD: uintptr(fd)}, nil
+	case "file":
+		return &FileSource{Path: arg}, nil
+	case "cmd":
+		args := strings.Fields(arg)
+		if len(args) == 0 {
+			err = ErrEmptyCommand
+			return
+		}
+		return &CommandSource{Path: args[0], Args: args[1:]}, nil
+	case "systemd":
+		if len(arg) == 0 {
+			arg = DefaultCredentialName
+		}
+		return &CredentialSource{CredentialName: arg}, nil
+	}
+
+	err = fmt.Errorf("%w: %s", ErrUnknownSource, kind)
+
+	return
+}
+
+// 只去掉行尾的换行，密码本身可能包含空格
+func trimNewline(b []byte) []byte {
+	return bytes.TrimRight(b, "\r\n")
+}
+
+func checkEmpty(b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return nil, ErrEmptyPassword
+	}
+	return b, nil
+}
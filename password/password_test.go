@@ -0,0 +1,93 @@
+package password
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec string
+		src  Source
+		err  error
+	}{
+		{"", &TTYSource{Prompt: "请输入配置文件密码:"}, nil},
+		{"tty", &TTYSource{Prompt: "请输入配置文件密码:"}, nil},
+		{"env", &EnvSource{Key: DefaultEnvName}, nil},
+		{"env:MY_PASSWORD", &EnvSource{Key: "MY_PASSWORD"}, nil},
+		{"fd:3", &FDSource{FD: 3}, nil},
+		{"fd:", nil, ErrBadFD},
+		{"fd:-1", nil, ErrBadFD},
+		{"fd:x", nil, ErrBadFD},
+		{"file:/etc/cmb-robot/password", &FileSource{Path: "/etc/cmb-robot/password"}, nil},
+		{"cmd:pass show cmb-robot", &CommandSource{Path: "pass", Args: []string{"show", "cmb-robot"}}, nil},
+		{"cmd:", nil, ErrEmptyCommand},
+		{"cmd:   ", nil, ErrEmptyCommand},
+		{"systemd", &CredentialSource{CredentialName: DefaultCredentialName}, nil},
+		{"systemd:robot.pw", &CredentialSource{CredentialName: "robot.pw"}, nil},
+		{"vault:secret", nil, ErrUnknownSource},
+		{"stdin", nil, ErrUnknownSource},
+	}
+
+	for _, tt := range tests {
+		src, err := Parse(tt.spec)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Parse(%q) error = %v, want %v", tt.spec, err, tt.err)
+			continue
+		}
+
+		if tt.err == nil && !reflect.DeepEqual(src, tt.src) {
+			t.Errorf("Parse(%q) = %#v, want %#v", tt.spec, src, tt.src)
+		}
+	}
+}
+
+func TestParseUnknownSourceNamesKind(t *testing.T) {
+	_, err := Parse("vault:secret")
+	if err == nil || err.Error() != "unknown password source: vault" {
+		t.Errorf("Parse error = %v", err)
+	}
+}
+
+func TestEnvSource(t *testing.T) {
+	t.Setenv("CMB_ROBOT_TEST_PASSWORD", "secret")
+
+	src := &EnvSource{Key: "CMB_ROBOT_TEST_PASSWORD"}
+
+	password, err := src.Password()
+	if err != nil || string(password) != "secret" {
+		t.Fatalf("Password = %q, %v", password, err)
+	}
+
+	// 读取后清除，避免被子进程继承
+	if _, exist := os.LookupEnv("CMB_ROBOT_TEST_PASSWORD"); exist {
+		t.Error("environment variable is still set after reading")
+	}
+
+	if _, err = src.Password(); err != ErrEnvNotSet {
+		t.Errorf("second Password = %v, want %v", err, ErrEnvNotSet)
+	}
+
+	t.Setenv("CMB_ROBOT_TEST_PASSWORD", "")
+	if _, err = src.Password(); err != ErrEmptyPassword {
+		t.Errorf("Password of empty variable = %v, want %v", err, ErrEmptyPassword)
+	}
+}
+
+func TestCredentialSourceErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"", ".", "..", "../password", "a/b", `a\b`} {
+		src := &CredentialSource{Dir: dir, CredentialName: name}
+		if _, err := src.Password(); err != ErrBadCredentialName {
+			t.Errorf("Password(%q) = %v, want %v", name, err, ErrBadCredentialName)
+		}
+	}
+
+	t.Setenv("CREDENTIALS_DIRECTORY", "")
+	if _, err := (&CredentialSource{CredentialName: DefaultCredentialName}).Password(); err != ErrNoCredentialsDir {
+		t.Errorf("Password without CREDENTIALS_DIRECTORY = %v, want %v", err, ErrNoCredentialsDir)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package password
+
+import (
+	"os"
+	"syscall"
+)
+
+// 以非阻塞方式打开，路径是FIFO时不会在检查类型前阻塞
+const openFlags = syscall.O_NONBLOCK
+
+func checkPermission(f *os.File, fi os.FileInfo) error {
+	if fi.Mode().Perm()&0077 != 0 {
+		return ErrInsecurePermission
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+//go:build windows
+// +build windows
+
+package password
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// 允许读取文件时视为不安全的账户：Everyone、Authenticated Users、Users
+var insecureSids = []windows.WELL_KNOWN_SID_TYPE{
+	windows.WinWorldSid,
+	windows.WinAuthenticatedUserSid,
+	windows.WinBuiltinUsersSid,
+}
+
+// 文件的读取权限 FILE_READ_DATA 以及包含它的通用权限
+const readMask = 0x1 | windows.GENERIC_READ | windows.GENERIC_ALL
+
+const openFlags = 0
+
+// Windows 下检查已打开文件的DACL，没有DACL或允许上述账户读取时返回 ErrInsecurePermission
+func checkPermission(f *os.File, fi os.FileInfo) (err error) {
+	sd, err := windows.GetSecurityInfo(windows.Handle(f.Fd()), windows.SE_FILE_OBJECT, windows.DACL_SECURITY_INFORMATION)
+	if err != nil {
+		return
+	}
+
+	dacl, _, err := sd.DACL()
+	if err == windows.ERROR_OBJECT_NOT_FOUND {
+		return ErrInsecurePermission
+	} else if err != nil {
+		return
+	}
+
+	if dacl == nil {
+		return ErrInsecurePermission
+	}
+
+	for i := uint32(0); i < uint32(dacl.AceCount); i++ {
+		var ace *windows.ACCESS_ALLOWED_ACE
+		if err = windows.GetAce(dacl, i, &ace); err != nil {
+			return
+		}
+
+		if ace.Header.AceType != windows.ACCESS_ALLOWED_ACE_TYPE ||
+			ace.Header.AceFlags&windows.INHERIT_ONLY_ACE != 0 ||
+			ace.Mask&readMask == 0 {
+			continue
+		}
+
+		sid := (*windows.SID)(unsafe.Pointer(&ace.SidStart))
+		for _, t := range insecureSids {
+			if sid.IsWellKnown(t) {
+				return ErrInsecurePermission
+			}
+		}
+	}
+
+	return
+}
@@ -0,0 +1,187 @@
+package password
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+type TTYSource struct {
+	Prompt string
+}
+
+func (p *TTYSource) Name() string {
+	return "tty"
+}
+
+func (p *TTYSource) Password() (password []byte, err error) {
+	fmt.Print(p.Prompt)
+
+	password, err = terminal.ReadPassword(int(syscall.Stdin))
+	if err != nil {
+		return
+	}
+
+	fmt.Println()
+
+	return checkEmpty(password)
+}
+
+type EnvSource struct {
+	Key string
+}
+
+func (p *EnvSource) Name() string {
+	return "env:" + p.Key
+}
+
+// Password 读取后立即清除环境变量，避免被子进程继承
+func (p *EnvSource) Password() (password []byte, err error) {
+	value, exist := os.LookupEnv(p.Key)
+	if !exist {
+		err = ErrEnvNotSet
+		return
+	}
+
+	os.Unsetenv(p.Key)
+
+	return checkEmpty([]byte(value))
+}
+
+type FDSource struct {
+	FD uintptr
+}
+
+func (p *FDSource) Name() string {
+	return fmt.Sprintf("fd:%d", p.FD)
+}
+
+func (p *FDSource) Password() (password []byte, err error) {
+	f := os.NewFile(p.FD, "password-fd")
+	if f == nil {
+		err = ErrBadFD
+		return
+	}
+
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return
+	}
+
+	return checkEmpty(trimNewline(data))
+}
+
+type FileSource struct {
+	Path string
+}
+
+func (p *FileSource) Name() string {
+	return "file:" + p.Path
+}
+
+// Password 只打开一次文件，对打开的句柄检查类型和权限后再读取，
+// 避免检查和读取之间路径被替换
+func (p *FileSource) Password() (password []byte, err error) {
+	f, err := os.OpenFile(p.Path, os.O_RDONLY|openFlags, 0)
+	if err != nil {
+		return
+	}
+
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return
+	}
+
+	if !fi.Mode().IsRegular() {
+		err = ErrNotRegularFile
+		return
+	}
+
+	if err = checkPermission(f, fi); err != nil {
+		return
+	}
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return
+	}
+
+	return checkEmpty(trimNewline(data))
+}
+
+type CommandSource struct {
+	Path    string
+	Args    []string
+	Timeout time.Duration
+}
+
+func (p *CommandSource) Name() string {
+	return "cmd:" + p.Path
+}
+
+func (p *CommandSource) Password() (password []byte, err error) {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stdout := bytes.Buffer{}
+
+	cmd := exec.CommandContext(ctx, p.Path, p.Args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+
+	if err = cmd.Run(); err != nil {
+		err = fmt.Errorf("password helper %s failed: %w", p.Path, err)
+		return
+	}
+
+	return checkEmpty(trimNewline(stdout.Bytes()))
+}
+
+// CredentialSource 兼容 systemd LoadCredential= 的凭据目录
+type CredentialSource struct {
+	Dir            string
+	CredentialName string
+}
+
+func (p *CredentialSource) Name() string {
+	return "systemd:" + p.CredentialName
+}
+
+func (p *CredentialSource) Password() (password []byte, err error) {
+	dir := p.Dir
+	if len(dir) == 0 {
+		dir = os.Getenv("CREDENTIALS_DIRECTORY")
+	}
+
+	if len(dir) == 0 {
+		err = ErrNoCredentialsDir
+		return
+	}
+
+	name := p.CredentialName
+	if len(name) == 0 || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		err = ErrBadCredentialName
+		return
+	}
+
+	return (&FileSource{Path: filepath.Join(dir, name)}).Password()
+}
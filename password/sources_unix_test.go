@@ -0,0 +1,130 @@
+//go:build !windows
+// +build !windows
+
+package password
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func writePassword(t *testing.T, dir, name, text string, perm os.FileMode) string {
+	filename := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(filename, []byte(text), perm); err != nil {
+		t.Fatal(err)
+	}
+
+	// WriteFile 受 umask 影响，显式设置权限
+	if err := os.Chmod(filename, perm); err != nil {
+		t.Fatal(err)
+	}
+
+	return filename
+}
+
+func TestFileSource(t *testing.T) {
+	dir := t.TempDir()
+
+	fifo := filepath.Join(dir, "fifo")
+	if err := syscall.Mkfifo(fifo, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		password string
+		err      error
+	}{
+		{"owner only", writePassword(t, dir, "0600", "secret\n", 0600), "secret", nil},
+		{"read only", writePassword(t, dir, "0400", "secret\r\n", 0400), "secret", nil},
+		{"keeps spaces", writePassword(t, dir, "spaces", " secret \n", 0600), " secret ", nil},
+		{"group readable", writePassword(t, dir, "0640", "secret", 0640), "", ErrInsecurePermission},
+		{"world readable", writePassword(t, dir, "0644", "secret", 0644), "", ErrInsecurePermission},
+		{"empty", writePassword(t, dir, "empty", "\n", 0600), "", ErrEmptyPassword},
+		{"directory", dir, "", ErrNotRegularFile},
+		// 没有写入方的FIFO不能阻塞
+		{"fifo", fifo, "", ErrNotRegularFile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			password, err := (&FileSource{Path: tt.path}).Password()
+			if err != tt.err || string(password) != tt.password {
+				t.Errorf("Password = %q, %v, want %q, %v", password, err, tt.password, tt.err)
+			}
+		})
+	}
+
+	if _, err := (&FileSource{Path: filepath.Join(dir, "missing")}).Password(); !os.IsNotExist(err) {
+		t.Errorf("Password of missing file = %v", err)
+	}
+}
+
+func TestFileSourceFollowsSymlinkTarget(t *testing.T) {
+	dir := t.TempDir()
+
+	// 权限检查针对实际读取的文件，而不是链接本身
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(writePassword(t, dir, "0644", "secret", 0644), link); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (&FileSource{Path: link}).Password(); err != ErrInsecurePermission {
+		t.Errorf("Password through symlink to 0644 file = %v, want %v", err, ErrInsecurePermission)
+	}
+}
+
+func TestFDSource(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = w.WriteString("secret\n"); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	// FDSource 会关闭描述符，交给它一个副本
+	fd, err := syscall.Dup(int(r.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+
+	password, err := (&FDSource{FD: uintptr(fd)}).Password()
+	if err != nil || string(password) != "secret" {
+		t.Errorf("Password = %q, %v", password, err)
+	}
+}
+
+func TestCommandSource(t *testing.T) {
+	password, err := (&CommandSource{Path: "echo", Args: []string{"secret"}}).Password()
+	if err != nil || string(password) != "secret" {
+		t.Errorf("Password = %q, %v", password, err)
+	}
+
+	if _, err = (&CommandSource{Path: "true"}).Password(); err != ErrEmptyPassword {
+		t.Errorf("Password of silent helper = %v, want %v", err, ErrEmptyPassword)
+	}
+
+	if _, err = (&CommandSource{Path: "false"}).Password(); err == nil {
+		t.Error("failing helper returned no error")
+	}
+}
+
+func TestCredentialSource(t *testing.T) {
+	dir := t.TempDir()
+	writePassword(t, dir, DefaultCredentialName, "secret\n", 0400)
+
+	t.Setenv("CREDENTIALS_DIRECTORY", dir)
+
+	password, err := (&CredentialSource{CredentialName: DefaultCredentialName}).Password()
+	if err != nil || string(password) != "secret" {
+		t.Errorf("Password = %q, %v", password, err)
+	}
+}
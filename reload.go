@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/gogap/cmb_robot/config"
+	"github.com/gogap/cmb_robot/robot"
+	"github.com/gogap/cmb_robot/supervisor"
+	"github.com/sirupsen/logrus"
+)
+
+const reloadPollInterval = 5 * time.Second
+
+type accountWorker struct {
+	userName string
+	account  *config.Account
+	sup      *supervisor.Supervisor
+
+	// cancel 中断正在进行的探测和恢复
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	removed   bool // 已从配置中移除
+	lockedOut bool // 因密码错误等致命错误停止
+}
+
+type accountManager struct {
+	wg       *sync.WaitGroup
+	filename string
+	password []byte
+
+	conf    *config.Config
+	workers map[string]*accountWorker
+
+	modTime time.Time
+	size    int64
+
+	quit      chan struct{}
+	watchDone chan struct{}
+
+	// stopLogStream 停止输出 FBSdk 日志
+	stopLogStream context.CancelFunc
+}
+
+func newAccountManager(wg *sync.WaitGroup, filename string, password []byte) *accountManager {
+	return &accountManager{
+		wg:       wg,
+		filename: filename,
+		password: password,
+		workers:  make(map[string]*accountWorker),
+
+		quit:      make(chan struct{}),
+		watchDone: make(chan struct{}),
+	}
+}
+
+func (p *accountManager) start(conf *configuration.Config) (err error) {
+	p.stat()
+
+	typed := config.New(conf)
+
+	accConfs, err := config.AccountConfigs(conf)
+	if err != nil {
+		return
+	}
+
+	var pending []pendingWorker
+
+	for i, accConf := range accConfs {
+		pw := pendingWorker{account: typed.Accounts[i]}
+		if pw.probe, pw.remediator, err = newProbeAndRemediator(accConf); err != nil {
+			return
+		}
+		pending = append(pending, pw)
+	}
+
+	for _, pw := range pending {
+		p.startWorker(pw)
+	}
+
+	p.conf = typed
+
+	p.startLogStream(conf)
+
+	return
+}
+
+// startLogStream 启动 FBSdk 日志输出，已经启动时先停止旧的
+func (p *accountManager) startLogStream(conf *configuration.Config) {
+	if p.stopLogStream != nil {
+		p.stopLogStream()
+		p.stopLogStream = nil
+	}
+
+	stream, err := robot.NewLogStream(conf)
+	if err != nil {
+		logrus.WithError(err).Errorln("启动FBSdk日志输出失败")
+		return
+	}
+
+	var ctx context.Context
+	ctx, p.stopLogStream = context.WithCancel(context.Background())
+
+	go stream.Run(ctx)
+}
+
+// pendingWorker 重新加载时需要启动或切换的账号，全部账号的机器人创建成功后才生效
+type pendingWorker struct {
+	account *config.Account
+	worker  *accountWorker // 已有的账号，新增的账号为 nil
+	restart bool           // 已因致命错误停止，重新开始监控
+
+	probe      supervisor.Probe
+	remediator supervisor.Remediator
+}
+
+func (p *accountManager) startWorker(pw pendingWorker) {
+	w := &accountWorker{
+		userName: pw.account.UserName,
+		account:  pw.account,
+	}
+
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+
+	startRobot(p.wg, w, pw.probe, pw.remediator)
+
+	p.workers[w.userName] = w
+}
+
+// watch 在收到 SIGHUP 或配置文件发生变化时重新加载，直到 quit 被关闭
+func (p *accountManager) watch() {
+	defer close(p.watchDone)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(reloadPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.quit:
+			return
+		case <-hup:
+			logrus.Infoln("收到SIGHUP，重新加载配置文件")
+		case <-ticker.C:
+			if !p.stat() {
+				continue
+			}
+			logrus.Infoln("配置文件发生变化，重新加载配置文件")
+		}
+
+		if err := p.reload(); err != nil {
+			logrus.WithError(err).Errorln("重新加载配置文件失败，继续使用旧配置")
+		}
+	}
+}
+
+// stat 记录文件的修改时间和大小，返回是否发生了变化
+func (p *accountManager) stat() (changed bool) {
+	fi, err := os.Stat(p.filename)
+	if err != nil {
+		return false
+	}
+
+	changed = !fi.ModTime().Equal(p.modTime) || fi.Size() != p.size
+
+	p.modTime = fi.ModTime()
+	p.size = fi.Size()
+
+	return
+}
+
+func (p *accountManager) reload() (err error) {
+	conf, _, err := config.Load(p.password, p.filename)
+	if err != nil {
+		return
+	}
+
+	typed := config.New(conf)
+
+	if err = typed.Validate(); err != nil {
+		return
+	}
+
+	accConfs, err := config.AccountConfigs(conf)
+	if err != nil {
+		return
+	}
+
+	globalChanges := p.conf.Diff(typed)
+
+	var pending []pendingWorker
+
+	// 先为新增和修改的账号创建机器人，任何一个失败都不改动正在进行的监控
+	for i, accConf := range accConfs {
+		pw := pendingWorker{account: typed.Accounts[i]}
+
+		if w, exist := p.workers[pw.account.UserName]; exist {
+			changes := w.account.Diff(pw.account)
+
+			// 因密码错误等致命错误停止的账号不会再检查，配置修改后重新开始监控
+			pw.worker, pw.restart = w, w.sup.State() == supervisor.StateLockedOut
+
+			if len(changes) == 0 && len(globalChanges) == 0 {
+				if pw.restart {
+					logrus.WithField("username", w.userName).Warnln("账号已因致命错误停止监控，修改配置后重新加载才会重新开始")
+				}
+				continue
+			}
+
+			logChanges(logrus.WithField("username", w.userName), changes)
+		}
+
+		if pw.probe, pw.remediator, err = newProbeAndRemediator(accConf); err != nil {
+			err = fmt.Errorf("%s: %w", pw.account.UserName, err)
+			return
+		}
+
+		pending = append(pending, pw)
+	}
+
+	logChanges(logrus.NewEntry(logrus.StandardLogger()), globalChanges)
+
+	for _, pw := range pending {
+		entry := logrus.WithField("username", pw.account.UserName)
+
+		switch {
+		case pw.worker == nil:
+			entry.Infoln("配置中新增账号，开始监控")
+			p.startWorker(pw)
+		case pw.restart:
+			entry.Infoln("账号配置已修改，重新开始监控")
+			pw.worker.cancel()
+			p.startWorker(pw)
+		default:
+			// 在下一次检查前切换，不会打断正在进行的登录
+			pw.worker.account = pw.account
+			pw.worker.sup.Swap(pw.probe, pw.remediator)
+		}
+	}
+
+	for userName, w := range p.workers {
+		if typed.Account(userName) == nil {
+			w.removed = true
+			w.cancel()
+			delete(p.workers, userName)
+		}
+	}
+
+	p.conf = typed
+
+	// 界面 profile 等全局配置变化后重新启动
+	if len(globalChanges) > 0 {
+		p.startLogStream(conf)
+	}
+
+	return
+}
+
+func logChanges(entry *logrus.Entry, changes []config.Change) {
+	for _, c := range changes {
+		if c.Secret {
+			entry.WithField("key", c.Key).Infoln("配置项已修改")
+			continue
+		}
+		entry.WithField("key", c.Key).WithField("old", c.Old).WithField("new", c.New).Infoln("配置项已修改")
+	}
+}
@@ -0,0 +1,50 @@
+package robot
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNoDesktop = errors.New("no desktop available on this platform")
+)
+
+type HWND uintptr
+
+const (
+	VKShift   uint16 = 0x10
+	VKControl uint16 = 0x11
+	VKAlt     uint16 = 0x12
+)
+
+// Desktop 封装机器人对桌面的全部操作，Windows 下由 w32 实现，
+// 其他平台可使用 fakedesktop 在内存中模拟 FBSdk 的窗口与弹窗
+type Desktop interface {
+	FindWindow(className, title string) HWND
+	// EnumChildWindows 遍历子窗口，parent 为0时遍历所有顶层窗口，fn 返回false时停止
+	EnumChildWindows(parent HWND, fn func(hwnd HWND) bool)
+	ClassName(hwnd HWND) string
+	WindowText(hwnd HWND) string
+	// ControlText 通过 WM_GETTEXT 读取其他进程中控件的文本
+	ControlText(hwnd HWND) string
+	IsWindowVisible(hwnd HWND) bool
+	WindowProcessID(hwnd HWND) int
+
+	ShowWindow(hwnd HWND)
+	SetForeground(hwnd HWND)
+	Focus(hwnd HWND)
+	// Click 同步发送点击，PostClick 异步发送点击，用于会弹出模态窗口的按钮
+	Click(hwnd HWND)
+	PostClick(hwnd HWND)
+	// CloseWindow 发送 Alt+X 关闭窗口
+	CloseWindow(hwnd HWND)
+	TapKey(keys ...uint16)
+
+	ListViewRowCount(hwnd HWND) int
+	ListViewColumnCount(hwnd HWND) int
+	ListViewItem(hwnd HWND, row, col int) string
+
+	// Sleep 等待 d，ctx 结束时立即返回 ctx.Err()
+	Sleep(ctx context.Context, d time.Duration) error
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+// +build !windows
+
+package robot
+
+// 非Windows平台没有真实的桌面，需要通过 NewRobotWithDesktop 注入
+func DefaultDesktop() Desktop {
+	return nil
+}
+
+func DefaultProcessManager() ProcessManager {
+	return nil
+}
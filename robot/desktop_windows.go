@@ -0,0 +1,133 @@
+package robot
+
+import (
+	"context"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/AllenDang/w32"
+)
+
+type w32Desktop struct{}
+
+func DefaultDesktop() Desktop {
+	return w32Desktop{}
+}
+
+func (w32Desktop) FindWindow(className, title string) HWND {
+	return HWND(w32.FindWindowW(syscall.StringToUTF16Ptr(className), syscall.StringToUTF16Ptr(title)))
+}
+
+// w32.EnumChildWindows 每次都对回调调用 syscall.NewCallback，回调最多约2000个且不会释放，
+// 同一个函数只占用一个。所有调用共用 enumChildProc，通过 lParam 找到本次调用的 fn
+var enumCallbacks = struct {
+	sync.Mutex
+	next uintptr
+	fns  map[uintptr]func(hwnd HWND) bool
+}{fns: make(map[uintptr]func(hwnd HWND) bool)}
+
+func enumChildProc(childHwnd w32.HWND, lParam w32.LPARAM) w32.LRESULT {
+	enumCallbacks.Lock()
+	fn := enumCallbacks.fns[uintptr(lParam)]
+	enumCallbacks.Unlock()
+
+	if fn != nil && fn(HWND(childHwnd)) {
+		return 1
+	}
+	return 0
+}
+
+func (w32Desktop) EnumChildWindows(parent HWND, fn func(hwnd HWND) bool) {
+	enumCallbacks.Lock()
+	enumCallbacks.next++
+	id := enumCallbacks.next
+	enumCallbacks.fns[id] = fn
+	enumCallbacks.Unlock()
+
+	defer func() {
+		enumCallbacks.Lock()
+		delete(enumCallbacks.fns, id)
+		enumCallbacks.Unlock()
+	}()
+
+	w32.EnumChildWindows(w32.HWND(parent), enumChildProc, w32.LPARAM(id))
+}
+
+func (w32Desktop) ClassName(hwnd HWND) string {
+	return w32.GetClassNameW(w32.HWND(hwnd))
+}
+
+func (w32Desktop) WindowText(hwnd HWND) string {
+	return w32.GetWindowText(w32.HWND(hwnd))
+}
+
+func (w32Desktop) ControlText(hwnd HWND) string {
+	txt := make([]uint16, 255)
+
+	w32.SendMessage(w32.HWND(hwnd), w32.WM_GETTEXT, 255, uintptr(unsafe.Pointer(&txt[0])))
+
+	return syscall.UTF16ToString(txt)
+}
+
+func (w32Desktop) IsWindowVisible(hwnd HWND) bool {
+	return w32.IsWindowVisible(w32.HWND(hwnd))
+}
+
+func (w32Desktop) WindowProcessID(hwnd HWND) int {
+	_, pid := w32.GetWindowThreadProcessId(w32.HWND(hwnd))
+	return pid
+}
+
+func (w32Desktop) ShowWindow(hwnd HWND) {
+	w32.ShowWindow(w32.HWND(hwnd), w32.SW_NORMAL)
+}
+
+func (w32Desktop) SetForeground(hwnd HWND) {
+	w32.SetForegroundWindow(w32.HWND(hwnd))
+}
+
+func (w32Desktop) Focus(hwnd HWND) {
+	w32.SendMessage(w32.HWND(hwnd), w32.WM_SETFOCUS, 0, 0)
+}
+
+func (w32Desktop) Click(hwnd HWND) {
+	w32.SendMessage(w32.HWND(hwnd), w32.BM_CLICK, 0, 0)
+}
+
+func (w32Desktop) PostClick(hwnd HWND) {
+	w32.PostMessage(w32.HWND(hwnd), w32.BM_CLICK, 0, 0)
+}
+
+func (w32Desktop) CloseWindow(hwnd HWND) {
+	w32.PostMessage(w32.HWND(hwnd), w32.WM_SYSKEYDOWN, 'X', 1<<29)
+}
+
+func (w32Desktop) TapKey(keys ...uint16) {
+	TapKey(keys...)
+}
+
+func (w32Desktop) ListViewRowCount(hwnd HWND) int {
+	return getLVItemRowCount(w32.HWND(hwnd))
+}
+
+func (w32Desktop) ListViewColumnCount(hwnd HWND) int {
+	return getLVColumnCount(w32.HWND(hwnd))
+}
+
+func (w32Desktop) ListViewItem(hwnd HWND, row, col int) string {
+	return getLVItem(w32.HWND(hwnd), row, col)
+}
+
+func (w32Desktop) Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,278 @@
+package robot
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-akka/configuration"
+	"github.com/go-akka/configuration/hocon"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrDialog              = errors.New("dialog rule matched")
+	ErrBadDialogRule       = errors.New("bad dialog rule")
+	ErrDialogRulesNotArray = errors.New("dialog-rules must be an array of objects")
+)
+
+// Phase 机器人执行到的阶段，弹窗规则只在指定的阶段生效
+type Phase string
+
+const (
+	PhaseLogout     Phase = "logout"      // 签退
+	PhaseListen     Phase = "listen"      // 开始监听
+	PhaseStopListen Phase = "stop-listen" // 停止监听
+	PhaseOpenLogin  Phase = "open-login"  // 打开登录窗口
+	PhaseCheckLogin Phase = "check-login" // 验证登录窗口是否可以输入密码
+	PhaseLoggingIn  Phase = "logging-in"  // 点击登录后等待登录窗口关闭
+	PhaseLoggedIn   Phase = "logged-in"   // 登录窗口关闭后
+)
+
+var phases = map[Phase]bool{
+	PhaseLogout:     true,
+	PhaseListen:     true,
+	PhaseStopListen: true,
+	PhaseOpenLogin:  true,
+	PhaseCheckLogin: true,
+	PhaseLoggingIn:  true,
+	PhaseLoggedIn:   true,
+}
+
+// Action 弹窗规则匹配后的动作，点击按钮后执行
+type Action string
+
+const (
+	ActionDismiss         Action = "dismiss"           // 只关闭弹窗，继续当前步骤
+	ActionRetry           Action = "retry"             // 重新打开登录窗口
+	ActionFail            Action = "fail"              // 以 Error 结束本次操作
+	ActionAlreadyLoggedIn Action = "already-logged-in" // 用户已经登录，登录成功
+)
+
+var actions = map[Action]bool{
+	ActionDismiss:         true,
+	ActionRetry:           true,
+	ActionFail:            true,
+	ActionAlreadyLoggedIn: true,
+}
+
+// DialogErrors 规则中 error 可以使用的内置错误，其他文本返回包装了 ErrDialog 的错误
+var DialogErrors = map[string]error{
+	"open-usbkey-failure":   ErrOpenUSBKeyFailure,
+	"wrong-usbkey-password": ErrWrongUSBKeyPassword,
+	"wrong-login-password":  ErrWrongLoginPassword,
+	"empty-username":        ErrEmptyUserNameWhileLogin,
+	"network-error":         ErrNetworkError,
+	"crash-window":          ErrCrashWindow,
+	"login-failure":         ErrLoginFailure,
+}
+
+const (
+	messageBoxClass = "#32770"
+	messageBoxTitle = "招商银行企业银行直联系统"
+	okButton        = "确定"
+)
+
+// DialogRule 一条弹窗处理规则: 在 Phases 阶段找到类名为 Class、标题为 Title 且内容包含
+// Content 的窗口时，点击 Button，再执行 Action
+type DialogRule struct {
+	Name    string
+	Class   string // 默认 #32770
+	Title   string // 精确匹配，登录过程中的错误提示框标题为空
+	Content string // 为空时不检查内容
+	Button  string // 默认 确定
+	Action  Action
+	Error   string // Action 为 fail 时返回的错误，见 DialogErrors
+	Phases  []Phase
+}
+
+// Err Action 为 fail 时返回的错误
+func (p *DialogRule) Err() error {
+	if err, exist := DialogErrors[p.Error]; exist {
+		return err
+	}
+	return fmt.Errorf("%w: %s: %s", ErrDialog, p.Name, p.Error)
+}
+
+func (p *DialogRule) appliesTo(phase Phase) bool {
+	for _, ph := range p.Phases {
+		if ph == phase {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *DialogRule) validate() (err error) {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w: %s: %s", ErrBadDialogRule, p.Name, reason)
+	}
+
+	switch {
+	case len(p.Name) == 0:
+		return fmt.Errorf("%w: name is required", ErrBadDialogRule)
+	case !actions[p.Action]:
+		return invalid("unknown action " + string(p.Action))
+	case p.Action == ActionFail && len(p.Error) == 0:
+		return invalid("error is required for fail action")
+	case len(p.Phases) == 0:
+		return invalid("phases is required")
+	}
+
+	for _, ph := range p.Phases {
+		if !phases[ph] {
+			return invalid("unknown phase " + string(ph))
+		}
+	}
+
+	return
+}
+
+// DefaultDialogRules 内置规则，与之前写死在代码中的处理一致
+func DefaultDialogRules() []DialogRule {
+	return []DialogRule{
+		{Name: "confirm-logout", Title: messageBoxTitle, Content: "确定要签退用户", Action: ActionDismiss, Phases: []Phase{PhaseLogout}},
+		{Name: "listen-started", Title: messageBoxTitle, Content: "HTTP服务已启动", Action: ActionDismiss, Phases: []Phase{PhaseListen}},
+		{Name: "listen-stopped", Title: messageBoxTitle, Content: "停止HTTP", Action: ActionDismiss, Phases: []Phase{PhaseStopListen}},
+		{Name: "http-notice", Title: messageBoxTitle, Content: "HTTP", Action: ActionRetry, Phases: []Phase{PhaseOpenLogin}},
+		{Name: "vc-runtime-crash", Title: "Microsoft Visual C++ Runtime Library", Action: ActionFail, Error: "crash-window", Phases: []Phase{PhaseCheckLogin}},
+		{Name: "abnormal-termination", Title: "Abnormal program termination", Action: ActionFail, Error: "crash-window", Phases: []Phase{PhaseCheckLogin}},
+		{Name: "open-usbkey-failure", Content: "打开移动证书失败", Action: ActionFail, Error: "open-usbkey-failure", Phases: []Phase{PhaseLoggingIn}},
+		{Name: "wrong-usbkey-password", Content: "证书密码错", Action: ActionFail, Error: "wrong-usbkey-password", Phases: []Phase{PhaseLoggingIn}},
+		{Name: "wrong-login-password", Content: "登录密码错", Action: ActionFail, Error: "wrong-login-password", Phases: []Phase{PhaseLoggingIn}},
+		{Name: "empty-username", Content: "用户登录名不能为空", Action: ActionFail, Error: "empty-username", Phases: []Phase{PhaseLoggingIn}},
+		{Name: "network-error", Content: "通讯故障", Action: ActionFail, Error: "network-error", Phases: []Phase{PhaseLoggingIn}},
+		{Name: "field-table-failure", Content: "取字段定义表文件失败", Action: ActionFail, Error: "network-error", Phases: []Phase{PhaseLoggingIn}},
+		{Name: "already-logged-in", Title: messageBoxTitle, Content: "已经登录", Action: ActionAlreadyLoggedIn, Phases: []Phase{PhaseLoggedIn}},
+	}
+}
+
+// LoadDialogRules 读取 dialog-rules，与内置规则同名的规则替换内置规则，
+// 其他规则排在内置规则之前，先于内置规则匹配
+//
+//	dialog-rules = [
+//		{ name: "cert-expired", content: "证书已过期", action: fail, error: "证书已过期", phases: [logging-in] }
+//	]
+func LoadDialogRules(conf *configuration.Config) (rules []DialogRule, err error) {
+	rules = DefaultDialogRules()
+
+	if conf == nil || !conf.HasPath("dialog-rules") {
+		return
+	}
+
+	if !conf.IsArray("dialog-rules") {
+		err = ErrDialogRulesNotArray
+		return
+	}
+
+	// 全部规则检查通过后才生效，出错时返回内置规则
+	merged := DefaultDialogRules()
+
+	var added []DialogRule
+
+	names := map[string]bool{}
+
+	for _, v := range conf.GetValue("dialog-rules").GetArray() {
+		if !v.IsObject() {
+			err = ErrDialogRulesNotArray
+			return
+		}
+
+		ruleConf := configuration.NewConfigFromRoot(hocon.NewHoconRoot(v))
+
+		rule := DialogRule{
+			Name:    ruleConf.GetString("name"),
+			Class:   ruleConf.GetString("class", messageBoxClass),
+			Title:   ruleConf.GetString("title"),
+			Content: ruleConf.GetString("content"),
+			Button:  ruleConf.GetString("button", okButton),
+			Action:  Action(ruleConf.GetString("action")),
+			Error:   ruleConf.GetString("error"),
+		}
+
+		for _, ph := range ruleConf.GetStringList("phases") {
+			rule.Phases = append(rule.Phases, Phase(ph))
+		}
+
+		if err = rule.validate(); err != nil {
+			return
+		}
+
+		// 同名的规则会被前一条覆盖或遮挡，视为配置错误
+		if names[rule.Name] {
+			err = fmt.Errorf("%w: %s: duplicate name", ErrBadDialogRule, rule.Name)
+			return
+		}
+
+		names[rule.Name] = true
+
+		replaced := false
+		for i := range merged {
+			if merged[i].Name == rule.Name {
+				merged[i] = rule
+				replaced = true
+				break
+			}
+		}
+
+		if !replaced {
+			added = append(added, rule)
+		}
+	}
+
+	rules = append(added, merged...)
+
+	return
+}
+
+// checkDialogs 处理 phase 阶段的弹窗，返回匹配规则的动作，没有匹配时返回空。
+// 动作为 fail 时返回规则中的错误
+func (p *Robot) checkDialogs(hwnd HWND, phase Phase) (action Action, err error) {
+	rule := p.handleDialogs(hwnd, phase)
+	if rule == nil {
+		return
+	}
+
+	action = rule.Action
+	if action == ActionFail {
+		err = rule.Err()
+	}
+
+	return
+}
+
+// handleDialogs 依次尝试 phase 阶段的规则，关闭第一个匹配的弹窗并返回该规则，没有匹配时返回 nil
+func (p *Robot) handleDialogs(hwnd HWND, phase Phase) *DialogRule {
+	for i := range p.dialogRules {
+		rule := &p.dialogRules[i]
+		if !rule.appliesTo(phase) {
+			continue
+		}
+
+		class, button := rule.Class, rule.Button
+		if len(class) == 0 {
+			class = messageBoxClass
+		}
+		if len(button) == 0 {
+			button = okButton
+		}
+
+		if !p.closeMessageBox(hwnd, class, rule.Title, button, rule.Content) {
+			continue
+		}
+
+		entry := logrus.WithField("username", p.userName).
+			WithField("rule", rule.Name).
+			WithField("phase", phase).
+			WithField("action", rule.Action)
+
+		if rule.Action == ActionFail {
+			entry.WithField("error", rule.Error).Errorln("弹窗规则匹配")
+		} else {
+			entry.Infoln("弹窗规则匹配")
+		}
+
+		return rule
+	}
+
+	return nil
+}
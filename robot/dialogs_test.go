@@ -0,0 +1,123 @@
+package robot
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-akka/configuration"
+)
+
+func TestLoadDialogRulesDefault(t *testing.T) {
+	for _, conf := range []*configuration.Config{nil, configuration.ParseString(`{username: "u1"}`)} {
+		rules, err := LoadDialogRules(conf)
+		if err != nil || !reflect.DeepEqual(rules, DefaultDialogRules()) {
+			t.Errorf("LoadDialogRules = %+v, %v, want the built-in rules", rules, err)
+		}
+	}
+}
+
+func TestLoadDialogRules(t *testing.T) {
+	conf := configuration.ParseString(`{
+		dialog-rules: [
+			{ name: "cert-expired", content: "证书已过期", action: fail, error: "证书已过期", phases: [logging-in] }
+			{ name: "network-error", content: "通讯故障", action: retry, phases: [logging-in, open-login] }
+			{ name: "update", class: "TUpdateForm", title: "升级", button: "以后再说", action: dismiss, phases: [logged-in] }
+		]
+	}`)
+
+	rules, err := LoadDialogRules(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defaults := DefaultDialogRules()
+	if len(rules) != len(defaults)+2 {
+		t.Fatalf("got %d rules, want %d", len(rules), len(defaults)+2)
+	}
+
+	// 新增的规则按配置顺序排在内置规则之前，class 和 button 使用默认值
+	want := DialogRule{
+		Name:    "cert-expired",
+		Class:   messageBoxClass,
+		Content: "证书已过期",
+		Button:  okButton,
+		Action:  ActionFail,
+		Error:   "证书已过期",
+		Phases:  []Phase{PhaseLoggingIn},
+	}
+	if !reflect.DeepEqual(rules[0], want) {
+		t.Errorf("rules[0] = %+v, want %+v", rules[0], want)
+	}
+
+	if r := rules[1]; r.Name != "update" || r.Class != "TUpdateForm" || r.Title != "升级" || r.Button != "以后再说" {
+		t.Errorf("rules[1] = %+v", r)
+	}
+
+	// 同名规则替换内置规则，位置不变
+	for i, def := range defaults {
+		r := rules[i+2]
+		if r.Name != def.Name {
+			t.Fatalf("rules[%d] = %s, want %s", i+2, r.Name, def.Name)
+		}
+
+		if r.Name == "network-error" {
+			if r.Action != ActionRetry || !reflect.DeepEqual(r.Phases, []Phase{PhaseLoggingIn, PhaseOpenLogin}) {
+				t.Errorf("network-error = %+v, want the configured rule", r)
+			}
+		} else if !reflect.DeepEqual(r, def) {
+			t.Errorf("rules[%d] = %+v, want the built-in rule", i+2, r)
+		}
+	}
+}
+
+func TestLoadDialogRulesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		err   error
+		msg   string
+	}{
+		{"not array", `dialog-rules: "ignore"`, ErrDialogRulesNotArray, ""},
+		{"not object", `dialog-rules: ["ignore"]`, ErrDialogRulesNotArray, ""},
+		{"no name", `dialog-rules: [{content: "x", action: dismiss, phases: [logout]}]`, ErrBadDialogRule, "name is required"},
+		{"no action", `dialog-rules: [{name: "a", phases: [logout]}]`, ErrBadDialogRule, "a: unknown action"},
+		{"unknown action", `dialog-rules: [{name: "a", action: ignore, phases: [logout]}]`, ErrBadDialogRule, "a: unknown action ignore"},
+		{"fail without error", `dialog-rules: [{name: "a", action: fail, phases: [logout]}]`, ErrBadDialogRule, "a: error is required"},
+		{"no phases", `dialog-rules: [{name: "a", action: dismiss}]`, ErrBadDialogRule, "a: phases is required"},
+		{"unknown phase", `dialog-rules: [{name: "a", action: dismiss, phases: [logout, login]}]`, ErrBadDialogRule, "a: unknown phase login"},
+		{"duplicate name", `dialog-rules: [{name: "a", action: dismiss, phases: [logout]}, {name: "a", action: retry, phases: [logout]}]`, ErrBadDialogRule, "a: duplicate name"},
+		{"duplicate built-in", `dialog-rules: [{name: "http-notice", action: dismiss, phases: [open-login]}, {name: "http-notice", action: retry, phases: [open-login]}]`, ErrBadDialogRule, "http-notice: duplicate name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := LoadDialogRules(configuration.ParseString("{" + tt.rules + "}"))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("LoadDialogRules = %v, want %v", err, tt.err)
+			}
+
+			if !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("error %q does not contain %q", err, tt.msg)
+			}
+
+			// 出错时仍返回内置规则
+			if !reflect.DeepEqual(rules, DefaultDialogRules()) {
+				t.Errorf("rules = %+v, want the built-in rules", rules)
+			}
+		})
+	}
+}
+
+func TestDialogRuleErr(t *testing.T) {
+	rule := DialogRule{Name: "wrong-login-password", Action: ActionFail, Error: "wrong-login-password"}
+	if err := rule.Err(); err != ErrWrongLoginPassword {
+		t.Errorf("Err = %v, want %v", err, ErrWrongLoginPassword)
+	}
+
+	rule = DialogRule{Name: "cert-expired", Action: ActionFail, Error: "证书已过期"}
+	if err := rule.Err(); !errors.Is(err, ErrDialog) || err.Error() != "dialog rule matched: cert-expired: 证书已过期" {
+		t.Errorf("Err = %v, want an error wrapping %v", err, ErrDialog)
+	}
+}
@@ -0,0 +1,452 @@
+// Package fakedesktop 在内存中模拟 Windows 桌面，用于在非Windows平台上驱动 robot.Robot
+package fakedesktop
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogap/cmb_robot/robot"
+)
+
+type Window struct {
+	HWND    robot.HWND
+	Class   string
+	Text    string // 窗口标题或控件文本
+	Visible bool
+	PID     int
+	Rows    [][]string // ListView 的内容，第0行为最新的一行
+	OnClick func()
+
+	parent   *Window
+	children []*Window
+}
+
+func (p *Window) Parent() *Window {
+	return p.parent
+}
+
+func (p *Window) Children() []*Window {
+	return append([]*Window(nil), p.children...)
+}
+
+// PrependRow 在 ListView 顶部插入一行
+func (p *Window) PrependRow(cols ...string) {
+	p.Rows = append([][]string{cols}, p.Rows...)
+}
+
+type timer struct {
+	at time.Duration
+	fn func()
+}
+
+// Desktop 实现 robot.Desktop，Sleep 只推进虚拟时间并触发到期的脚本
+type Desktop struct {
+	mu sync.Mutex
+
+	nextHWND   robot.HWND
+	windows    []*Window
+	byHWND     map[robot.HWND]*Window
+	processes  map[string]*Process
+	starters   map[string]func(args []string, dir string)
+	killers    map[string]func()
+	keys       map[string]func()
+	focus      *Window
+	foreground robot.HWND
+
+	now    time.Duration
+	timers []timer
+
+	actions []string
+}
+
+var _ robot.Desktop = (*Desktop)(nil)
+
+func New() *Desktop {
+	return &Desktop{
+		nextHWND:  0x1000,
+		byHWND:    make(map[robot.HWND]*Window),
+		processes: make(map[string]*Process),
+		starters:  make(map[string]func(args []string, dir string)),
+		killers:   make(map[string]func()),
+		keys:      make(map[string]func()),
+	}
+}
+
+// AddWindow 创建窗口，parent 为 nil 时创建顶层窗口，子窗口继承父窗口的进程号
+func (p *Desktop) AddWindow(parent *Window, class, text string) *Window {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.nextHWND++
+
+	w := &Window{
+		HWND:    p.nextHWND,
+		Class:   class,
+		Text:    text,
+		Visible: true,
+		parent:  parent,
+	}
+
+	if parent != nil {
+		w.PID = parent.PID
+		parent.children = append(parent.children, w)
+	} else {
+		p.windows = append(p.windows, w)
+	}
+
+	p.byHWND[w.HWND] = w
+
+	return w
+}
+
+func (p *Desktop) RemoveWindow(w *Window) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.removeLocked(w)
+}
+
+func (p *Desktop) removeLocked(w *Window) {
+	for _, c := range w.children {
+		p.removeLocked(c)
+	}
+
+	delete(p.byHWND, w.HWND)
+
+	if p.focus == w {
+		p.focus = nil
+	}
+
+	if w.parent == nil {
+		p.windows = removeWindow(p.windows, w)
+		return
+	}
+
+	w.parent.children = removeWindow(w.parent.children, w)
+}
+
+func removeWindow(ws []*Window, w *Window) []*Window {
+	for i := range ws {
+		if ws[i] == w {
+			return append(ws[:i:i], ws[i+1:]...)
+		}
+	}
+	return ws
+}
+
+func (p *Desktop) Window(hwnd robot.HWND) *Window {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.byHWND[hwnd]
+}
+
+// TopWindows 返回全部顶层窗口
+func (p *Desktop) TopWindows() []*Window {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]*Window(nil), p.windows...)
+}
+
+// SetProcess 设置进程号，pid 为0时进程退出。进程号变化时旧的进程退出
+func (p *Desktop) SetProcess(name string, pid int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if proc, exist := p.processes[name]; exist {
+		if proc.pid == pid {
+			return
+		}
+
+		close(proc.exited)
+		delete(p.processes, name)
+	}
+
+	if pid != 0 {
+		p.processes[name] = &Process{d: p, name: name, pid: pid, exited: make(chan struct{})}
+	}
+}
+
+// OnKeys 注册组合键的处理函数，如 OnKeys(fn, robot.VKControl, 'I')
+func (p *Desktop) OnKeys(fn func(), keys ...uint16) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.keys[keyName(keys)] = fn
+}
+
+// After 在虚拟时间经过 d 之后执行 fn
+func (p *Desktop) After(d time.Duration, fn func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.timers = append(p.timers, timer{at: p.now + d, fn: fn})
+	sort.SliceStable(p.timers, func(i, j int) bool {
+		return p.timers[i].at < p.timers[j].at
+	})
+}
+
+func (p *Desktop) Now() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.now
+}
+
+// Actions 返回机器人执行过的操作记录
+func (p *Desktop) Actions() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]string(nil), p.actions...)
+}
+
+func (p *Desktop) record(format string, args ...interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.actions = append(p.actions, fmt.Sprintf(format, args...))
+}
+
+func (p *Desktop) FindWindow(className, title string) robot.HWND {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, w := range p.windows {
+		if w.Class == className && w.Text == title {
+			return w.HWND
+		}
+	}
+
+	return 0
+}
+
+func (p *Desktop) EnumChildWindows(parent robot.HWND, fn func(hwnd robot.HWND) bool) {
+	var hwnds []robot.HWND
+
+	p.mu.Lock()
+	if parent == 0 {
+		for _, w := range p.windows {
+			hwnds = append(hwnds, w.HWND)
+		}
+	} else if w, exist := p.byHWND[parent]; exist {
+		var walk func(w *Window)
+		walk = func(w *Window) {
+			for _, c := range w.children {
+				hwnds = append(hwnds, c.HWND)
+				walk(c)
+			}
+		}
+		walk(w)
+	}
+	p.mu.Unlock()
+
+	for _, hwnd := range hwnds {
+		if !fn(hwnd) {
+			return
+		}
+	}
+}
+
+func (p *Desktop) ClassName(hwnd robot.HWND) string {
+	if w := p.Window(hwnd); w != nil {
+		return w.Class
+	}
+	return ""
+}
+
+func (p *Desktop) WindowText(hwnd robot.HWND) string {
+	if w := p.Window(hwnd); w != nil {
+		return w.Text
+	}
+	return ""
+}
+
+func (p *Desktop) ControlText(hwnd robot.HWND) string {
+	return p.WindowText(hwnd)
+}
+
+func (p *Desktop) IsWindowVisible(hwnd robot.HWND) bool {
+	if w := p.Window(hwnd); w != nil {
+		return w.Visible
+	}
+	return false
+}
+
+func (p *Desktop) WindowProcessID(hwnd robot.HWND) int {
+	if w := p.Window(hwnd); w != nil {
+		return w.PID
+	}
+	return 0
+}
+
+func (p *Desktop) ShowWindow(hwnd robot.HWND) {
+	p.record("show %#x", hwnd)
+}
+
+func (p *Desktop) SetForeground(hwnd robot.HWND) {
+	p.mu.Lock()
+	p.foreground = hwnd
+	p.mu.Unlock()
+}
+
+func (p *Desktop) Foreground() robot.HWND {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.foreground
+}
+
+func (p *Desktop) Focus(hwnd robot.HWND) {
+	p.mu.Lock()
+	p.focus = p.byHWND[hwnd]
+	p.mu.Unlock()
+}
+
+func (p *Desktop) Click(hwnd robot.HWND) {
+	w := p.Window(hwnd)
+	if w == nil {
+		return
+	}
+
+	p.record("click %s %q", w.Class, w.Text)
+
+	if w.OnClick != nil {
+		w.OnClick()
+	}
+}
+
+// PostClick 与 PostMessage 一样异步执行，在下一次 Sleep 时生效
+func (p *Desktop) PostClick(hwnd robot.HWND) {
+	w := p.Window(hwnd)
+	if w == nil {
+		return
+	}
+
+	p.record("post click %s %q", w.Class, w.Text)
+
+	if w.OnClick != nil {
+		p.After(0, w.OnClick)
+	}
+}
+
+func (p *Desktop) CloseWindow(hwnd robot.HWND) {
+	w := p.Window(hwnd)
+	if w == nil {
+		return
+	}
+
+	p.record("close %s %q", w.Class, w.Text)
+
+	p.RemoveWindow(w)
+}
+
+// TapKey 组合键交给 OnKeys 注册的处理函数，单个字符输入到当前焦点控件
+func (p *Desktop) TapKey(keys ...uint16) {
+	name := keyName(keys)
+
+	p.mu.Lock()
+	fn := p.keys[name]
+	focus := p.focus
+	p.mu.Unlock()
+
+	if fn != nil {
+		p.record("key %s", name)
+		fn()
+		return
+	}
+
+	if len(keys) == 1 && focus != nil {
+		p.mu.Lock()
+		focus.Text += string(rune(keys[0]))
+		p.mu.Unlock()
+	}
+}
+
+func (p *Desktop) ListViewRowCount(hwnd robot.HWND) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if w, exist := p.byHWND[hwnd]; exist {
+		return len(w.Rows)
+	}
+	return 0
+}
+
+// ListViewColumnCount 没有表头，以最长的一行为列数
+func (p *Desktop) ListViewColumnCount(hwnd robot.HWND) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	count := 0
+	if w, exist := p.byHWND[hwnd]; exist {
+		for _, row := range w.Rows {
+			if len(row) > count {
+				count = len(row)
+			}
+		}
+	}
+	return count
+}
+
+func (p *Desktop) ListViewItem(hwnd robot.HWND, row, col int) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	w, exist := p.byHWND[hwnd]
+	if !exist || row < 0 || row >= len(w.Rows) || col < 0 || col >= len(w.Rows[row]) {
+		return ""
+	}
+
+	return w.Rows[row][col]
+}
+
+// Sleep 推进虚拟时间，并按顺序执行到期的脚本。脚本中取消 ctx 时，
+// 虚拟时间停在取消的时刻
+func (p *Desktop) Sleep(ctx context.Context, d time.Duration) error {
+	p.mu.Lock()
+	deadline := p.now + d
+	p.mu.Unlock()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		p.mu.Lock()
+		if len(p.timers) == 0 || p.timers[0].at > deadline {
+			p.now = deadline
+			p.mu.Unlock()
+			return nil
+		}
+
+		t := p.timers[0]
+		p.timers = p.timers[1:]
+		if t.at > p.now {
+			p.now = t.at
+		}
+		p.mu.Unlock()
+
+		t.fn()
+	}
+}
+
+func keyName(keys []uint16) string {
+	var names []string
+	for _, k := range keys {
+		switch {
+		case k == robot.VKControl:
+			names = append(names, "ctrl")
+		case k >= 0x20 && k < 0x7f:
+			names = append(names, strings.ToLower(string(rune(k))))
+		default:
+			names = append(names, fmt.Sprintf("%#x", k))
+		}
+	}
+	return strings.Join(names, "+")
+}
@@ -0,0 +1,298 @@
+package fakedesktop
+
+import (
+	"net"
+	"time"
+
+	"github.com/gogap/cmb_robot/robot"
+)
+
+const (
+	DefaultMainTitle   = "招商银行企业银行直联"
+	DefaultProcessName = "FBSdkManager.exe"
+	DefaultPID         = 4242
+
+	LoginClass   = "TOnlineLoginFrm"
+	LoginTitle   = "联机登录 (110100)"
+	MessageTitle = "招商银行企业银行直联系统"
+)
+
+type FBSdkOptions struct {
+	// Profile 模拟的 FBSdk 版本的窗口类名、标题和快捷键，为空时使用 robot.DefaultProfile
+	Profile *robot.Profile
+
+	MainTitle   string
+	ProcessName string
+	PID         int
+
+	UserName       string
+	LoginPassword  string
+	USBKeyPassword string
+
+	// ListenAddr 不为空时，Ctrl+B 会真正监听该地址，供 Robot.IsListening 检测
+	ListenAddr string
+
+	LoginDelay time.Duration
+	// StartDelay 通过 ProcessManager 启动后，经过 StartDelay 才创建主窗口
+	StartDelay time.Duration
+	// LoginError 不为空时，点击登录后弹出内容为 LoginError 的消息框，如"通讯故障"
+	LoginError string
+}
+
+// FBSdk 模拟 FBSdkManager.exe 的主窗口、登录窗口与各种弹窗
+type FBSdk struct {
+	*Desktop
+
+	opts FBSdkOptions
+
+	Main     *Window
+	Logs     *Window
+	Sessions *Window
+	Login    *Window
+
+	listener net.Listener
+}
+
+func NewFBSdk(d *Desktop, opts FBSdkOptions) *FBSdk {
+	if opts.Profile == nil {
+		profile := robot.DefaultProfile()
+		opts.Profile = &profile
+	}
+
+	if len(opts.MainTitle) == 0 {
+		opts.MainTitle = opts.Profile.MainTitle
+	}
+
+	if len(opts.ProcessName) == 0 {
+		opts.ProcessName = DefaultProcessName
+	}
+
+	if opts.PID == 0 {
+		opts.PID = DefaultPID
+	}
+
+	if opts.LoginDelay == 0 {
+		opts.LoginDelay = time.Second * 3
+	}
+
+	f := &FBSdk{
+		Desktop: d,
+		opts:    opts,
+	}
+
+	f.Start()
+
+	d.OnStart(opts.ProcessName, f.startProcess)
+	d.OnKill(opts.ProcessName, f.Kill)
+
+	d.OnKeys(f.openLoginWindow, opts.Profile.LoginKey...)
+	d.OnKeys(f.confirmLogout, opts.Profile.LogoutKey...)
+	d.OnKeys(f.startListen, opts.Profile.ListenKey...)
+	d.OnKeys(f.stopListen, opts.Profile.StopListenKey...)
+
+	return f
+}
+
+// Start 启动进程并创建主窗口
+func (p *FBSdk) Start() {
+	if p.Main != nil {
+		return
+	}
+
+	p.SetProcess(p.opts.ProcessName, p.opts.PID)
+
+	p.createWindows()
+}
+
+func (p *FBSdk) startProcess(args []string, dir string) {
+	if p.Main != nil {
+		return
+	}
+
+	if p.opts.StartDelay == 0 {
+		p.Start()
+		return
+	}
+
+	p.SetProcess(p.opts.ProcessName, p.opts.PID)
+
+	proc := p.Process(p.opts.ProcessName)
+
+	p.After(p.opts.StartDelay, func() {
+		// 创建窗口之前进程已经退出
+		if p.Process(p.opts.ProcessName) != proc || p.Main != nil {
+			return
+		}
+		p.createWindows()
+	})
+}
+
+func (p *FBSdk) createWindows() {
+	ui := p.opts.Profile
+
+	p.Main = p.AddWindow(nil, ui.MainClass, p.opts.MainTitle)
+	p.Main.PID = p.opts.PID
+
+	for i := 0; i < ui.ListViewCount; i++ {
+		lv := p.AddWindow(p.Main, ui.ListViewClass, "")
+		switch i {
+		case ui.LogsListView:
+			p.Logs = lv
+		case ui.LoginListView:
+			p.Sessions = lv
+		}
+	}
+}
+
+// Kill 模拟进程退出，关闭全部窗口
+func (p *FBSdk) Kill() {
+	if p.listener != nil {
+		p.listener.Close()
+		p.listener = nil
+	}
+
+	for _, w := range p.TopWindows() {
+		if w.PID == p.opts.PID {
+			p.RemoveWindow(w)
+		}
+	}
+
+	p.SetProcess(p.opts.ProcessName, 0)
+	p.Main, p.Logs, p.Sessions, p.Login = nil, nil, nil, nil
+}
+
+func (p *FBSdk) IsLoggedIn(userName string) bool {
+	if p.Sessions == nil {
+		return false
+	}
+
+	for _, row := range p.Sessions.Rows {
+		if len(row) > 0 && row[0] == userName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ShowMessageBox 弹出 #32770 消息框，点击"确定"后关闭并执行 onOK
+func (p *FBSdk) ShowMessageBox(title, content string, onOK func()) *Window {
+	dlg := p.AddWindow(nil, "#32770", title)
+	dlg.PID = p.opts.PID
+
+	p.AddWindow(dlg, "Static", content)
+
+	btn := p.AddWindow(dlg, "Button", "确定")
+	btn.OnClick = func() {
+		p.RemoveWindow(dlg)
+		if onOK != nil {
+			onOK()
+		}
+	}
+
+	return dlg
+}
+
+func (p *FBSdk) AddLog(level, message string) {
+	if p.Logs == nil {
+		return
+	}
+
+	p.mu.Lock()
+	p.Logs.PrependRow(level, time.Unix(0, 0).Add(p.now).UTC().Format("15:04:05"), message)
+	p.mu.Unlock()
+}
+
+func (p *FBSdk) openLoginWindow() {
+	if p.Main == nil || p.Login != nil {
+		return
+	}
+
+	ui := p.opts.Profile
+
+	login := p.AddWindow(nil, ui.LoginClass, ui.LoginTitle)
+	login.PID = p.opts.PID
+
+	p.AddWindow(login, ui.UserNameClass, p.opts.UserName)
+	usbKeyBox := p.AddWindow(login, ui.PasswordClassPrefix+"0045E0A8", "")
+	passwordBox := p.AddWindow(login, ui.PasswordClassPrefix+"0045E0A8", "")
+
+	btn := p.AddWindow(login, ui.LoginButtonClass, ui.LoginButtonText)
+	btn.OnClick = func() {
+		p.submitLogin(usbKeyBox.Text, passwordBox.Text)
+	}
+
+	p.Login = login
+}
+
+func (p *FBSdk) submitLogin(usbKeyPassword, loginPassword string) {
+	switch {
+	// 登录过程中的错误提示框没有标题
+	case usbKeyPassword != p.opts.USBKeyPassword:
+		p.ShowMessageBox("", "证书密码错", nil)
+		return
+	case loginPassword != p.opts.LoginPassword:
+		p.ShowMessageBox("", "登录密码错", nil)
+		return
+	case len(p.opts.LoginError) > 0:
+		p.ShowMessageBox("", p.opts.LoginError, nil)
+		return
+	}
+
+	if p.Login != nil {
+		p.RemoveWindow(p.Login)
+		p.Login = nil
+	}
+
+	p.After(p.opts.LoginDelay, func() {
+		if p.Sessions == nil {
+			return
+		}
+
+		p.AddLog("信息", "用户"+p.opts.UserName+"登录成功")
+
+		p.mu.Lock()
+		p.Sessions.PrependRow(p.opts.UserName)
+		p.mu.Unlock()
+	})
+}
+
+func (p *FBSdk) confirmLogout() {
+	if p.Main == nil {
+		return
+	}
+
+	p.ShowMessageBox(MessageTitle, "确定要签退用户"+p.opts.UserName+"吗?", func() {
+		p.mu.Lock()
+		p.Sessions.Rows = nil
+		p.mu.Unlock()
+	})
+}
+
+func (p *FBSdk) startListen() {
+	if p.Main == nil {
+		return
+	}
+
+	if len(p.opts.ListenAddr) > 0 && p.listener == nil {
+		l, err := net.Listen("tcp", p.opts.ListenAddr)
+		if err != nil {
+			p.ShowMessageBox(MessageTitle, "HTTP服务启动失败", nil)
+			return
+		}
+		p.listener = l
+	}
+
+	p.ShowMessageBox(MessageTitle, "HTTP服务已启动", nil)
+}
+
+func (p *FBSdk) stopListen() {
+	if p.listener != nil {
+		p.listener.Close()
+		p.listener = nil
+	}
+
+	if p.Main != nil {
+		p.ShowMessageBox(MessageTitle, "停止HTTP服务", nil)
+	}
+}
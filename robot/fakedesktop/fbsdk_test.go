@@ -0,0 +1,190 @@
+package fakedesktop
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/go-akka/configuration"
+	"github.com/gogap/cmb_robot/robot"
+)
+
+const (
+	testUserName       = "u1"
+	testLoginPassword  = "12345678"
+	testUSBKeyPassword = "87654321"
+)
+
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func newTestRobot(t *testing.T, d *Desktop, listenAddr, extra string) *robot.Robot {
+	conf := configuration.ParseString(fmt.Sprintf(`{
+		username: %q
+		login-password: %q
+		usbkey-password: %q
+		listen-addr: %q
+		snapshot-keep: 0
+		%s
+	}`, testUserName, testLoginPassword, testUSBKeyPassword, listenAddr, extra))
+
+	bot, err := robot.NewRobotWithDesktop(conf, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bot
+}
+
+func newTestFBSdk(opts FBSdkOptions) (*Desktop, *FBSdk) {
+	if len(opts.UserName) == 0 {
+		opts.UserName = testUserName
+	}
+	if len(opts.LoginPassword) == 0 {
+		opts.LoginPassword = testLoginPassword
+	}
+	if len(opts.USBKeyPassword) == 0 {
+		opts.USBKeyPassword = testUSBKeyPassword
+	}
+
+	d := New()
+	return d, NewFBSdk(d, opts)
+}
+
+func TestLogin(t *testing.T) {
+	d, fb := newTestFBSdk(FBSdkOptions{})
+	bot := newTestRobot(t, d, freeAddr(t), "")
+
+	already, err := bot.Login()
+	if err != nil || already {
+		t.Fatalf("Login = %v, %v", already, err)
+	}
+
+	if !fb.IsLoggedIn(testUserName) || !bot.IsLoggedIn() {
+		t.Fatal("not logged in after Login")
+	}
+
+	if fb.Login != nil {
+		t.Error("login window is still open")
+	}
+
+	sessions := bot.Sessions()
+	if len(sessions) != 1 || sessions[0].UserName != testUserName {
+		t.Errorf("Sessions = %+v", sessions)
+	}
+}
+
+func TestLoginErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  FBSdkOptions
+		extra string
+		want  error
+	}{
+		{"wrong login password", FBSdkOptions{LoginPassword: "00000000"}, "", robot.ErrWrongLoginPassword},
+		{"wrong usb key password", FBSdkOptions{USBKeyPassword: "00000000"}, "", robot.ErrWrongUSBKeyPassword},
+		{"network error", FBSdkOptions{LoginError: "通讯故障"}, "", robot.ErrNetworkError},
+		{"custom rule", FBSdkOptions{LoginError: "证书已过期"},
+			`dialog-rules: [{name: "cert-expired", content: "证书已过期", action: fail, error: "证书已过期", phases: [logging-in]}]`,
+			robot.ErrDialog},
+		{"replaced built-in rule", FBSdkOptions{LoginError: "通讯故障"},
+			`dialog-rules: [{name: "network-error", content: "通讯故障", action: fail, error: "login-failure", phases: [logging-in]}]`,
+			robot.ErrLoginFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, fb := newTestFBSdk(tt.opts)
+			bot := newTestRobot(t, d, freeAddr(t), tt.extra)
+
+			_, err := bot.Login()
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Login = %v, want %v", err, tt.want)
+			}
+
+			if fb.IsLoggedIn(testUserName) {
+				t.Error("logged in after a failed login")
+			}
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	d, fb := newTestFBSdk(FBSdkOptions{})
+	bot := newTestRobot(t, d, freeAddr(t), "")
+
+	if _, err := bot.Login(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bot.Logout(); err != nil {
+		t.Fatal(err)
+	}
+
+	if fb.IsLoggedIn(testUserName) || bot.IsLoggedIn() {
+		t.Error("still logged in after Logout")
+	}
+
+	// 签退确认框已经关闭，只剩主窗口
+	if n := len(d.TopWindows()); n != 1 {
+		t.Errorf("%d top windows after Logout, want 1", n)
+	}
+}
+
+func TestListen(t *testing.T) {
+	addr := freeAddr(t)
+	d, _ := newTestFBSdk(FBSdkOptions{ListenAddr: addr})
+	bot := newTestRobot(t, d, addr, "")
+
+	if bot.IsListening() {
+		t.Fatal("listening before Listen")
+	}
+
+	if !bot.Listen() || !bot.IsListening() {
+		t.Fatal("not listening after Listen")
+	}
+
+	if !bot.StopListen() {
+		t.Fatal("StopListen failed")
+	}
+
+	if bot.IsListening() {
+		t.Error("still listening after StopListen")
+	}
+}
+
+func TestRestartProcess(t *testing.T) {
+	d, fb := newTestFBSdk(FBSdkOptions{})
+	bot := newTestRobot(t, d, freeAddr(t), `process-args: ["-auto"]`)
+
+	first := fb.Main
+
+	if err := bot.RestartProcess(); err != nil {
+		t.Fatal(err)
+	}
+
+	if fb.Main == nil || fb.Main == first {
+		t.Fatal("main window was not recreated")
+	}
+
+	proc := d.Process(DefaultProcessName)
+	if proc == nil || len(proc.Args) != 1 || proc.Args[0] != "-auto" {
+		t.Errorf("process = %+v, want args [-auto]", proc)
+	}
+
+	var killed, started bool
+	for _, a := range d.Actions() {
+		killed = killed || strings.HasPrefix(a, "kill ")
+		started = started || strings.HasPrefix(a, "start ")
+	}
+	if !killed || !started {
+		t.Errorf("actions = %v, want Kill and Start", d.Actions())
+	}
+}
@@ -0,0 +1,159 @@
+package fakedesktop
+
+import (
+	"testing"
+
+	"github.com/go-akka/configuration"
+	"github.com/gogap/cmb_robot/robot"
+)
+
+// countingDesktop 统计读取单元格和枚举子窗口的次数
+type countingDesktop struct {
+	*Desktop
+
+	items int
+	enums int
+}
+
+func (p *countingDesktop) ListViewItem(hwnd robot.HWND, row, col int) string {
+	p.items++
+	return p.Desktop.ListViewItem(hwnd, row, col)
+}
+
+func (p *countingDesktop) EnumChildWindows(parent robot.HWND, fn func(hwnd robot.HWND) bool) {
+	p.enums++
+	p.Desktop.EnumChildWindows(parent, fn)
+}
+
+func newTestLogStream(t *testing.T, d robot.Desktop) *robot.LogStream {
+	stream, err := robot.NewLogStreamWithDesktop(configuration.ParseString(`{}`), d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stream
+}
+
+func messages(entries []robot.LogEntry) (msgs []string) {
+	for _, e := range entries {
+		msgs = append(msgs, e.Message)
+	}
+	return
+}
+
+func sameMessages(entries []robot.LogEntry, want ...string) bool {
+	msgs := messages(entries)
+	if len(msgs) != len(want) {
+		return false
+	}
+	for i := range msgs {
+		if msgs[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestLogStream(t *testing.T) {
+	d, fb := newTestFBSdk(FBSdkOptions{})
+	stream := newTestLogStream(t, d)
+
+	fb.AddLog(robot.LogLevelInfo, "启动成功")
+
+	// 启动时已有的日志不输出
+	if entries := stream.Poll(); len(entries) != 0 {
+		t.Fatalf("first Poll = %v, want nothing", messages(entries))
+	}
+
+	fb.AddLog(robot.LogLevelInfo, "监听成功")
+	fb.AddLog(robot.LogLevelError, "登录失败")
+
+	entries := stream.Poll()
+	if !sameMessages(entries, "监听成功", "登录失败") {
+		t.Fatalf("Poll = %v, want new logs oldest first", messages(entries))
+	}
+	if entries[1].Level != robot.LogLevelError {
+		t.Errorf("Level = %q, want %q", entries[1].Level, robot.LogLevelError)
+	}
+
+	if entries = stream.Poll(); len(entries) != 0 {
+		t.Errorf("Poll without new logs = %v", messages(entries))
+	}
+
+	// FBSdk 重启后新窗口中的日志全部输出
+	fb.Kill()
+	if entries = stream.Poll(); len(entries) != 0 {
+		t.Errorf("Poll without main window = %v", messages(entries))
+	}
+
+	fb.Start()
+	fb.AddLog(robot.LogLevelInfo, "重新启动")
+	fb.AddLog(robot.LogLevelWarn, "证书即将过期")
+
+	if entries = stream.Poll(); !sameMessages(entries, "重新启动", "证书即将过期") {
+		t.Errorf("Poll after restart = %v, want every log in the new window", messages(entries))
+	}
+}
+
+func TestLogStreamUnchanged(t *testing.T) {
+	d, fb := newTestFBSdk(FBSdkOptions{})
+	counting := &countingDesktop{Desktop: d}
+	stream := newTestLogStream(t, counting)
+
+	for _, msg := range []string{"启动成功", "监听成功", "登录成功"} {
+		fb.AddLog(robot.LogLevelInfo, msg)
+	}
+
+	stream.Poll()
+
+	// 列表没有变化时只读取最新的一行，日志列表的窗口也不再重新查找
+	counting.items, counting.enums = 0, 0
+
+	if entries := stream.Poll(); len(entries) != 0 {
+		t.Fatalf("Poll = %v, want nothing", messages(entries))
+	}
+	if counting.items != 3 || counting.enums != 0 {
+		t.Errorf("unchanged Poll read %d cells and enumerated %d times, want 3 cells of the top row and no enumeration", counting.items, counting.enums)
+	}
+
+	// 列表已满时行数不变，最新的一行变化后仍然读取新增的日志
+	fb.AddLog(robot.LogLevelInfo, "签退成功")
+	fb.Logs.Rows = fb.Logs.Rows[:3]
+
+	if entries := stream.Poll(); !sameMessages(entries, "签退成功") {
+		t.Errorf("Poll with a full list = %v, want the new log", messages(entries))
+	}
+}
+
+func TestLogs(t *testing.T) {
+	dir, v2 := writeProfile(t, `name: v2
+log-level-column: 2
+log-message-column: 0`)
+
+	d, fb := newTestFBSdk(FBSdkOptions{Profile: &v2})
+	bot := newTestRobot(t, d, freeAddr(t), `ui-profile: v2, ui-profiles-dir: "`+hoconEscape(dir)+`"`)
+
+	fb.Logs.PrependRow("启动成功", "09:00:00", robot.LogLevelInfo)
+	fb.Logs.PrependRow("登录失败", "09:00:05", robot.LogLevelError, "extra")
+
+	logs := bot.Logs()
+	if len(logs) != 2 {
+		t.Fatalf("Logs = %+v", logs)
+	}
+
+	// 第0行为最新的一行，各项按 profile 中的列读取，列数以最长的一行为准
+	want := []robot.LogEntry{
+		{Level: robot.LogLevelError, Time: "09:00:05", Message: "登录失败"},
+		{Level: robot.LogLevelInfo, Time: "09:00:00", Message: "启动成功"},
+	}
+	for i, w := range want {
+		got := logs[i]
+		if got.Level != w.Level || got.Time != w.Time || got.Message != w.Message || len(got.Columns) != 4 {
+			t.Errorf("Logs[%d] = %+v, want %+v", i, got, w)
+		}
+	}
+
+	fb.Kill()
+	if len(bot.Logs()) != 0 {
+		t.Error("Logs without main window is not empty")
+	}
+}
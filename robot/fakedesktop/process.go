@@ -0,0 +1,111 @@
+package fakedesktop
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gogap/cmb_robot/robot"
+)
+
+var _ robot.ProcessManager = (*Desktop)(nil)
+
+// Process 模拟的进程，由 SetProcess 创建，进程号变化或为0时退出
+type Process struct {
+	d      *Desktop
+	name   string
+	pid    int
+	exited chan struct{}
+
+	// Args 和 Dir 为 Start 时的参数和工作目录
+	Args []string
+	Dir  string
+}
+
+func (p *Process) PID() int {
+	return p.pid
+}
+
+func (p *Process) Kill() error {
+	p.d.record("kill %s %d", p.name, p.pid)
+
+	p.d.mu.Lock()
+	fn := p.d.killers[p.name]
+	p.d.mu.Unlock()
+
+	if fn != nil {
+		fn()
+	} else {
+		p.d.SetProcess(p.name, 0)
+	}
+
+	return nil
+}
+
+func (p *Process) Exited() <-chan struct{} {
+	return p.exited
+}
+
+// OnStart 注册进程的启动脚本，脚本中通过 SetProcess 创建进程
+func (p *Desktop) OnStart(name string, fn func(args []string, dir string)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.starters[name] = fn
+}
+
+// OnKill 注册进程被结束时的脚本，没有注册时只将进程号设为0
+func (p *Desktop) OnKill(name string, fn func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.killers[name] = fn
+}
+
+func (p *Desktop) Find(name string) robot.Process {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if proc, exist := p.processes[name]; exist {
+		return proc
+	}
+	return nil
+}
+
+// Process 返回正在运行的进程，没有时返回 nil
+func (p *Desktop) Process(name string) *Process {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.processes[name]
+}
+
+// Start 执行 OnStart 注册的脚本，脚本没有创建进程时返回一个已经退出的进程
+func (p *Desktop) Start(path string, args []string, dir string) (robot.Process, error) {
+	name := path[strings.LastIndexAny(path, `\/`)+1:]
+
+	p.mu.Lock()
+	fn := p.starters[name]
+	p.mu.Unlock()
+
+	if fn == nil {
+		return nil, fmt.Errorf("start %s: %w", path, os.ErrNotExist)
+	}
+
+	p.record("start %s %q %s", name, args, dir)
+
+	fn(args, dir)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	proc, exist := p.processes[name]
+	if !exist {
+		proc = &Process{d: p, name: name, exited: make(chan struct{})}
+		close(proc.exited)
+	}
+
+	proc.Args, proc.Dir = args, dir
+
+	return proc, nil
+}
@@ -0,0 +1,57 @@
+package fakedesktop
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gogap/cmb_robot/robot"
+)
+
+func TestCrashLoop(t *testing.T) {
+	d, fb := newTestFBSdk(FBSdkOptions{})
+	bot := newTestRobot(t, d, freeAddr(t), `crash-limit: 2`)
+
+	// 不是由机器人结束的退出计入次数
+	for i := 0; i < 2; i++ {
+		if err := bot.RestartProcess(); err != nil {
+			t.Fatalf("restart %d: %v", i, err)
+		}
+		fb.Kill()
+	}
+
+	if err := bot.RestartProcess(); !errors.Is(err, robot.ErrCrashLoop) {
+		t.Fatalf("RestartProcess = %v, want %v", err, robot.ErrCrashLoop)
+	}
+
+	// 同一个进程的其他账号同样暂停重启
+	other := newTestRobot(t, d, freeAddr(t), `username: "u2"`)
+	if err := other.RestartProcess(); !errors.Is(err, robot.ErrCrashLoop) {
+		t.Errorf("RestartProcess of another account = %v, want %v", err, robot.ErrCrashLoop)
+	}
+}
+
+func TestPlannedKillSharedByAccounts(t *testing.T) {
+	d, fb := newTestFBSdk(FBSdkOptions{})
+	a := newTestRobot(t, d, freeAddr(t), `crash-limit: 2`)
+	b := newTestRobot(t, d, freeAddr(t), `username: "u2"
+		crash-limit: 2`)
+
+	// 两个账号轮流重启同一个 FBSdk，结束对方启动的进程不是意外退出
+	for i := 0; i < 3; i++ {
+		if err := b.RestartProcess(); err != nil {
+			t.Fatalf("restart %d by u2: %v", i, err)
+		}
+
+		if err := a.RestartProcess(); err != nil {
+			t.Fatalf("restart %d by u1: %v", i, err)
+		}
+	}
+
+	if err := b.RestartProcess(); err != nil {
+		t.Errorf("RestartProcess = %v after planned restarts by another account", err)
+	}
+
+	if fb.Main == nil {
+		t.Error("FBSdk is not running")
+	}
+}
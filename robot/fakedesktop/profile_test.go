@@ -0,0 +1,63 @@
+package fakedesktop
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/gogap/cmb_robot/robot"
+)
+
+func writeProfile(t *testing.T, text string) (dir string, profile robot.Profile) {
+	dir = t.TempDir()
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "v2.conf"), []byte(text), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	profiles, err := robot.LoadProfiles(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir, profiles[len(profiles)-1]
+}
+
+func TestProfileAutoDetect(t *testing.T) {
+	dir, v2 := writeProfile(t, `name: v2
+main-title: "招商银行企业银行直联 V2"`)
+
+	d, fb := newTestFBSdk(FBSdkOptions{Profile: &v2})
+	bot := newTestRobot(t, d, freeAddr(t), `ui-profiles-dir: "`+hoconEscape(dir)+`"`)
+
+	if name := bot.ProfileName(); name != "auto(default)" {
+		t.Errorf("ProfileName before detection = %q", name)
+	}
+
+	// Logs、Sessions 可能在其他 goroutine 中与登录同时调用，识别时切换 profile 不能有数据竞争
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			bot.Sessions()
+			bot.Logs()
+			bot.ProfileName()
+		}
+	}()
+
+	if _, err := bot.Login(); err != nil {
+		t.Fatal(err)
+	}
+
+	wg.Wait()
+
+	if name := bot.ProfileName(); name != "auto(v2)" {
+		t.Errorf("ProfileName = %q, want auto(v2)", name)
+	}
+
+	if !fb.IsLoggedIn(testUserName) {
+		t.Error("not logged in with the detected profile")
+	}
+}
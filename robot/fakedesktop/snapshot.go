@@ -0,0 +1,61 @@
+package fakedesktop
+
+import (
+	"io"
+
+	"github.com/gogap/cmb_robot/robot"
+)
+
+// LoadSnapshot 读取 robot.Snapshot 保存的窗口树并创建桌面，用于回放登录失败时的界面
+func LoadSnapshot(r io.Reader) (d *Desktop, err error) {
+	snap, err := robot.ReadSnapshot(r)
+	if err != nil {
+		return
+	}
+
+	d = New()
+	d.Restore(snap)
+
+	return
+}
+
+// Restore 按快照创建窗口和进程，窗口句柄与快照中的一致。
+// 快照中没有脚本，按钮点击和快捷键需要另外通过 OnClick、OnKeys 注册
+func (p *Desktop) Restore(snap *robot.Snapshot) {
+	if len(snap.Process) > 0 && snap.PID != 0 {
+		p.SetProcess(snap.Process, snap.PID)
+	}
+
+	for _, w := range snap.Windows {
+		p.restoreWindow(nil, w)
+	}
+}
+
+func (p *Desktop) restoreWindow(parent *Window, snap *robot.WindowSnapshot) {
+	w := p.AddWindow(parent, snap.Class, snap.Title)
+
+	p.mu.Lock()
+	if snap.HWND != 0 {
+		if _, exist := p.byHWND[snap.HWND]; !exist {
+			delete(p.byHWND, w.HWND)
+			w.HWND = snap.HWND
+			p.byHWND[w.HWND] = w
+		}
+		if snap.HWND > p.nextHWND {
+			p.nextHWND = snap.HWND
+		}
+	}
+
+	// 模拟的窗口只有一个文本，与标题不同时使用控件文本
+	if len(snap.Text) > 0 {
+		w.Text = snap.Text
+	}
+	w.Visible = snap.Visible
+	w.PID = snap.PID
+	w.Rows = snap.Rows
+	p.mu.Unlock()
+
+	for _, c := range snap.Children {
+		p.restoreWindow(w, c)
+	}
+}
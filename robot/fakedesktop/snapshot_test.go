@@ -0,0 +1,164 @@
+package fakedesktop
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogap/cmb_robot/robot"
+)
+
+func TestSnapshot(t *testing.T) {
+	d, fb := newTestFBSdk(FBSdkOptions{})
+	bot := newTestRobot(t, d, freeAddr(t), "")
+
+	fb.AddLog("信息", "启动成功")
+	fb.openLoginWindow()
+
+	for _, w := range fb.Login.Children() {
+		if strings.HasPrefix(w.Class, robot.DefaultProfile().PasswordClassPrefix) {
+			w.Text = "secret"
+		}
+	}
+
+	snap := bot.Snapshot()
+
+	if snap.PID != DefaultPID || snap.Process != DefaultProcessName || snap.UserName != testUserName || snap.Profile != robot.DefaultProfileName {
+		t.Errorf("snapshot = %+v", snap)
+	}
+
+	if len(snap.Windows) != 2 {
+		t.Fatalf("got %d top windows, want main and login", len(snap.Windows))
+	}
+
+	main, login := snap.Windows[0], snap.Windows[1]
+
+	if main.HWND != fb.Main.HWND || main.Title != fb.Main.Text || len(main.Children) != len(fb.Main.Children()) {
+		t.Errorf("main window = %+v", main)
+	}
+
+	var logs *robot.WindowSnapshot
+	for _, c := range main.Children {
+		if c.HWND == fb.Logs.HWND {
+			logs = c
+		}
+	}
+
+	if logs == nil || len(logs.Rows) != 1 || logs.Rows[0][2] != "启动成功" {
+		t.Errorf("logs list view = %+v", logs)
+	}
+
+	redacted := 0
+	for _, c := range login.Children {
+		if c.Redacted {
+			redacted++
+			if len(c.Text) > 0 || len(c.Title) > 0 {
+				t.Errorf("password box recorded %q/%q", c.Title, c.Text)
+			}
+		}
+	}
+
+	if redacted != 2 {
+		t.Errorf("%d redacted password boxes, want 2", redacted)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	d, fb := newTestFBSdk(FBSdkOptions{})
+	bot := newTestRobot(t, d, freeAddr(t), "")
+
+	fb.AddLog("信息", "启动成功")
+	fb.ShowMessageBox(MessageTitle, "HTTP服务已启动", nil)
+
+	snap := bot.Snapshot()
+	snap.Error = robot.ErrListenFailure.Error()
+
+	buf := &bytes.Buffer{}
+	n, err := snap.WriteTo(buf)
+	if err != nil || n != int64(buf.Len()) {
+		t.Fatalf("WriteTo = %d, %v, wrote %d bytes", n, err, buf.Len())
+	}
+
+	data := buf.Bytes()
+
+	read, err := robot.ReadSnapshot(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !read.Time.Equal(snap.Time) {
+		t.Errorf("time = %v, want %v", read.Time, snap.Time)
+	}
+	read.Time = snap.Time
+
+	if !reflect.DeepEqual(read, snap) {
+		t.Errorf("ReadSnapshot = %+v, want %+v", read, snap)
+	}
+
+	// 回放后的桌面再次快照，得到相同的窗口树
+	replay, err := LoadSnapshot(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again := newTestRobot(t, replay, freeAddr(t), "").Snapshot()
+
+	if again.PID != snap.PID || !reflect.DeepEqual(again.Windows, snap.Windows) {
+		t.Errorf("snapshot of the replayed desktop differs:\n%+v\n%+v", again.Windows, snap.Windows)
+	}
+
+	if _, err = robot.ReadSnapshot(strings.NewReader("{")); err == nil {
+		t.Error("ReadSnapshot accepted truncated JSON")
+	}
+}
+
+func TestSnapshotOnFailedRun(t *testing.T) {
+	dir := t.TempDir()
+
+	addr := freeAddr(t)
+	d, fb := newTestFBSdk(FBSdkOptions{LoginPassword: "00000000", ListenAddr: addr})
+	defer fb.Kill()
+
+	bot := newTestRobot(t, d, addr, `snapshot-dir: "`+hoconEscape(dir)+`"
+		snapshot-keep: 2`)
+
+	for i := 0; i < 3; i++ {
+		if err := bot.Run(robot.RunModeReLogin); err == nil {
+			t.Fatal("Run succeeded with a wrong password")
+		}
+		// 文件名精确到毫秒
+		time.Sleep(time.Millisecond * 2)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 2 {
+		t.Fatalf("kept %d snapshots, want 2", len(files))
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, files[1].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := robot.ReadSnapshot(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(snap.Error) == 0 || snap.UserName != testUserName || len(snap.Windows) == 0 {
+		t.Errorf("saved snapshot = %+v", snap)
+	}
+}
+
+// hoconEscape HOCON 字符串中的反斜杠需要转义
+func hoconEscape(dir string) string {
+	return strings.Replace(dir, `\`, `\\`, -1)
+}
@@ -1,105 +1,119 @@
 package robot
 
-import (
-	"github.com/AllenDang/w32"
-	"github.com/sirupsen/logrus"
-	"syscall"
-	"unsafe"
-)
-
+// 默认 profile 中日志列表和登录列表的位置
 var (
 	IDLV_LOGS  = 0
 	IDLV_LOGIN = 1
 )
 
-func listViews(hwnd w32.HWND) []w32.HWND {
-	var listViewHwnds []w32.HWND
-	fnOfEnumListView := func(childHwnd w32.HWND, LPARAM w32.LPARAM) w32.LRESULT {
-		className := w32.GetClassNameW(childHwnd)
-
-		if className == "TFBListView" {
-			listViewHwnds = append(listViewHwnds, childHwnd)
-		}
-		return 1
-	}
-
-	w32.EnumChildWindows(hwnd, fnOfEnumListView, 0)
+// FBSdk 日志列表中的级别
+const (
+	LogLevelInfo  = "信息"
+	LogLevelWarn  = "警告"
+	LogLevelError = "错误"
+)
 
-	return listViewHwnds
+// LogEntry FBSdk 日志列表中的一行
+type LogEntry struct {
+	Level   string
+	Time    string
+	Message string
+	Columns []string
 }
 
-func getLVItemRowCount(hwnd w32.HWND) int {
-	rowCount := w32.SendMessage(hwnd, w32.LVM_GETITEMCOUNT, 0, 0)
-	return int(rowCount)
+// Session 登录列表中的一行
+type Session struct {
+	UserName string
+	Status   string
+	Columns  []string
 }
 
-func getLVItem(hwnd w32.HWND, row, col int) string {
+func findListViews(desktop Desktop, ui *Profile, hwnd HWND) []HWND {
+	var listViewHwnds []HWND
 
-	rowCount := w32.SendMessage(hwnd, w32.LVM_GETITEMCOUNT, 0, 0)
-	if rowCount == 0 {
-		return ""
-	}
+	desktop.EnumChildWindows(hwnd, func(childHwnd HWND) bool {
+		className := desktop.ClassName(childHwnd)
 
-	if row-1 > int(rowCount) {
-		return ""
-	}
+		if className == ui.ListViewClass {
+			listViewHwnds = append(listViewHwnds, childHwnd)
+		}
+		return true
+	})
 
-	_, pid := w32.GetWindowThreadProcessId(hwnd)
+	return listViewHwnds
+}
 
-	hProcess := w32.OpenProcess(
-		w32.PROCESS_VM_READ|w32.PROCESS_VM_WRITE|w32.PROCESS_VM_OPERATION|w32.PROCESS_QUERY_INFORMATION,
-		false,
-		uint32(pid),
-	)
+// listView 返回主窗口中第 index 个 ListView，数量与 profile 不一致时返回0
+func listView(desktop Desktop, ui *Profile, mainHwnd HWND, index int) HWND {
+	lvs := findListViews(desktop, ui, mainHwnd)
+	if len(lvs) != ui.ListViewCount {
+		return 0
+	}
+	return lvs[index]
+}
 
-	if hProcess == 0 {
-		logrus.Errorln("开启远程hProcess失败")
-		return ""
+func readRows(desktop Desktop, lv HWND) (rows [][]string) {
+	if lv == 0 {
+		return
 	}
 
-	defer func() {
-		w32.CloseHandle(hProcess)
-	}()
+	rowCount := desktop.ListViewRowCount(lv)
+	colCount := desktop.ListViewColumnCount(lv)
 
-	lpLvItem := w32.VirtualAllocEx(hProcess, 0, unsafe.Sizeof(w32.LVITEM{}), w32.MEM_COMMIT, w32.PAGE_READWRITE)
-	if lpLvItem == 0 {
-		logrus.Errorln("申请远程内存空间失败")
-		return ""
+	for row := 0; row < rowCount; row++ {
+		rows = append(rows, readRow(desktop, lv, row, colCount))
 	}
 
-	defer func() {
-		w32.VirtualFreeEx(hProcess, lpLvItem, 0, w32.MEM_RELEASE)
-	}()
+	return
+}
 
-	lpStr := w32.VirtualAllocEx(hProcess, 0, 256, w32.MEM_COMMIT, w32.PAGE_READWRITE)
-	if lpStr == 0 {
-		logrus.Errorln("申请远程内存空间失败")
-		return ""
+func readRow(desktop Desktop, lv HWND, row, colCount int) []string {
+	cols := make([]string, colCount)
+	for col := range cols {
+		cols[col] = desktop.ListViewItem(lv, row, col)
 	}
+	return cols
+}
 
-	defer func() {
-		w32.VirtualFreeEx(hProcess, lpStr, 0, w32.MEM_RELEASE)
-	}()
-
-	item := &w32.LVITEM{
-		Mask:       w32.LVIF_TEXT,
-		IItem:      int32(row),
-		ISubItem:   int32(col),
-		PszText:    (*uint16)(unsafe.Pointer(lpStr)),
-		CchTextMax: 256,
+func column(cols []string, i int) string {
+	if i < len(cols) {
+		return cols[i]
 	}
+	return ""
+}
 
-	_, ok := w32.WriteProcessMemory(hProcess, lpLvItem, uintptr(unsafe.Pointer(item)), unsafe.Sizeof(w32.LVITEM{}))
-	if !ok {
-		return ""
+// readLogs 读取日志列表，第0行为最新的一行
+func readLogs(desktop Desktop, ui *Profile, lv HWND) (entries []LogEntry) {
+	for _, cols := range readRows(desktop, lv) {
+		entries = append(entries, LogEntry{
+			Level:   column(cols, ui.LogLevelColumn),
+			Time:    column(cols, ui.LogTimeColumn),
+			Message: column(cols, ui.LogMessageColumn),
+			Columns: cols,
+		})
 	}
+	return
+}
 
-	ret := w32.SendMessage(hwnd, w32.LVM_GETITEMTEXT, uintptr(row), lpLvItem)
-	if int(ret) > 0 {
-		redBuf, _, _ := w32.ReadProcessMemory(hProcess, lpStr, ret*2)
-		s := syscall.UTF16ToString(redBuf)
-		return s
+func readSessions(desktop Desktop, ui *Profile, lv HWND) (sessions []Session) {
+	for _, cols := range readRows(desktop, lv) {
+		sessions = append(sessions, Session{
+			UserName: column(cols, ui.SessionUserColumn),
+			Status:   column(cols, ui.SessionStatusColumn),
+			Columns:  cols,
+		})
 	}
+	return
+}
 
-	return ""
+// Logs 返回 FBSdk 日志列表的全部内容，第0行为最新的一行
+func (p *Robot) Logs() []LogEntry {
+	hwnd, ui := p.mainWindowProfile()
+	return readLogs(p.desktop, ui, listView(p.desktop, ui, hwnd, ui.LogsListView))
+}
+
+// Sessions 返回登录列表中的全部用户
+func (p *Robot) Sessions() []Session {
+	hwnd, ui := p.mainWindowProfile()
+	return readSessions(p.desktop, ui, listView(p.desktop, ui, hwnd, ui.LoginListView))
 }
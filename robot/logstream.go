@@ -0,0 +1,162 @@
+package robot
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultFBSdkLogInterval = time.Second * 5
+)
+
+// LogStream 把 FBSdk 日志列表中新增的日志写入 logrus。
+// 多个账号共用同一个 FBSdk 界面，每个进程只需要一个
+type LogStream struct {
+	desktop  Desktop
+	interval time.Duration
+
+	*uiProfiles
+
+	started  bool
+	mainHwnd HWND
+	logsHwnd HWND      // 日志列表，主窗口不变时不再重新查找
+	rows     int       // 上次读取时的行数
+	last     *LogEntry // 上次读取时最新的一行
+}
+
+func NewLogStream(config *configuration.Config) (stream *LogStream, err error) {
+	return NewLogStreamWithDesktop(config, DefaultDesktop())
+}
+
+// NewLogStreamWithDesktop 读取 fbsdk-log-interval 和界面 profile 配置
+func NewLogStreamWithDesktop(config *configuration.Config, desktop Desktop) (stream *LogStream, err error) {
+	if desktop == nil {
+		err = ErrNoDesktop
+		return
+	}
+
+	profiles, err := newUIProfiles(config)
+	if err != nil {
+		return
+	}
+
+	return &LogStream{
+		desktop:    desktop,
+		interval:   config.GetTimeDuration("fbsdk-log-interval", DefaultFBSdkLogInterval),
+		uiProfiles: profiles,
+	}, nil
+}
+
+// Run 每隔 fbsdk-log-interval 检查一次日志列表，直到 ctx 结束
+func (p *LogStream) Run(ctx context.Context) {
+	if p.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.Poll()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Poll 输出上次检查之后新增的日志，按时间先后返回。
+// 第一次检查时已有的日志不输出；FBSdk 重启后新窗口中的日志全部输出
+func (p *LogStream) Poll() (entries []LogEntry) {
+	first := !p.started
+	p.started = true
+
+	hwnd, ui := p.mainWindow(p.desktop, logrus.WithField("source", "fbsdk"))
+	if hwnd == 0 {
+		p.mainHwnd, p.logsHwnd, p.rows, p.last = 0, 0, 0, nil
+		return
+	}
+
+	restarted := hwnd != p.mainHwnd
+	if restarted || p.logsHwnd == 0 {
+		p.logsHwnd = listView(p.desktop, ui, hwnd, ui.LogsListView)
+	}
+
+	if restarted {
+		p.mainHwnd, p.rows, p.last = hwnd, 0, nil
+		if first {
+			all := readLogs(p.desktop, ui, p.logsHwnd)
+			p.rows, p.last = len(all), top(all)
+			return
+		}
+	}
+
+	if p.logsHwnd == 0 {
+		return
+	}
+
+	// 每个单元格都要跨进程读取，行数和最新的一行都没有变化时不读取整个列表
+	if p.last != nil && p.desktop.ListViewRowCount(p.logsHwnd) == p.rows &&
+		sameRow(readRow(p.desktop, p.logsHwnd, 0, p.desktop.ListViewColumnCount(p.logsHwnd)), p.last.Columns) {
+		return
+	}
+
+	all := readLogs(p.desktop, ui, p.logsHwnd)
+
+	// 新的日志在列表顶部，上次最新的一行之前的都是新增的
+	n := len(all)
+	if p.last != nil {
+		for i := range all {
+			if sameRow(all[i].Columns, p.last.Columns) {
+				n = i
+				break
+			}
+		}
+	}
+
+	p.rows, p.last = len(all), top(all)
+
+	for i := n - 1; i >= 0; i-- {
+		entries = append(entries, all[i])
+		emit(all[i])
+	}
+
+	return
+}
+
+func top(entries []LogEntry) *LogEntry {
+	if len(entries) == 0 {
+		return nil
+	}
+	return &entries[0]
+}
+
+func sameRow(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func emit(e LogEntry) {
+	entry := logrus.WithField("source", "fbsdk").WithField("fbsdk_level", e.Level).WithField("fbsdk_time", e.Time)
+
+	switch e.Level {
+	case LogLevelError:
+		entry.Errorln(e.Message)
+	case LogLevelWarn:
+		entry.Warnln(e.Message)
+	default:
+		entry.Infoln(e.Message)
+	}
+}
@@ -0,0 +1,244 @@
+package robot
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrNoProcessManager = errors.New("no process manager available on this platform")
+	ErrProcessNotReady  = errors.New("process started but main window did not appear")
+	ErrCrashLoop        = errors.New("process exited too often, restart is backing off")
+)
+
+const (
+	DefaultReadyTimeout = time.Minute
+	DefaultCrashLimit   = 3
+	DefaultCrashWindow  = time.Minute * 10
+	DefaultCrashBackoff = time.Minute * 30
+)
+
+// Process 一个正在运行的 FBSdkManager.exe
+type Process interface {
+	PID() int
+	Kill() error
+	// Exited 进程退出后关闭
+	Exited() <-chan struct{}
+}
+
+// ProcessManager 查找和启动 FBSdkManager.exe，Windows 下使用系统进程，
+// 其他平台可使用 fakedesktop 模拟
+type ProcessManager interface {
+	// Find 按文件名查找正在运行的进程，没有时返回 nil
+	Find(name string) Process
+	// Start 在 dir 中以 args 为参数启动 path，dir 为空时使用当前目录
+	Start(path string, args []string, dir string) (Process, error)
+}
+
+// DefaultProcessDir 返回 path 所在的目录，process-dir 为空时在该目录中启动 FBSdk。
+// 非Windows平台下 filepath 不识别反斜杠
+func DefaultProcessDir(path string) string {
+	return path[:strings.LastIndexAny(path, `\/`)+1]
+}
+
+// processWatch 监控机器人找到或启动的进程，记录不是由机器人结束的退出，
+// 在 crashWindow 内退出 crashLimit 次后暂停重启 crashBackoff
+type processWatch struct {
+	mu sync.Mutex
+
+	filename string
+
+	proc   Process
+	killed bool // 由机器人结束
+	noted  bool // 退出已经记录
+
+	crashLimit   int
+	crashWindow  time.Duration
+	crashBackoff time.Duration
+
+	crashes      []time.Time
+	backoffUntil time.Time
+}
+
+type watchKey struct {
+	processes ProcessManager
+	filename  string
+}
+
+// 多个账号共用同一个 FBSdk 进程，一个账号结束进程时其他账号不能把这次退出当作意外退出，
+// 所以同一个 ProcessManager 中的同一个进程只有一个 processWatch
+var (
+	watchesMu sync.Mutex
+	watches   = make(map[watchKey]*processWatch)
+)
+
+// sharedWatch 返回监控 filename 的 processWatch，退出次数限制使用最后创建的机器人的配置
+func sharedWatch(processes ProcessManager, filename string, crashLimit int, crashWindow, crashBackoff time.Duration) *processWatch {
+	watchesMu.Lock()
+	defer watchesMu.Unlock()
+
+	key := watchKey{processes: processes, filename: filename}
+
+	watch, exist := watches[key]
+	if !exist {
+		watch = &processWatch{filename: filename}
+		watches[key] = watch
+	}
+
+	watch.mu.Lock()
+	watch.crashLimit, watch.crashWindow, watch.crashBackoff = crashLimit, crashWindow, crashBackoff
+	watch.mu.Unlock()
+
+	return watch
+}
+
+// track 开始监控 proc，proc 与当前监控的进程相同时不做任何事。
+// ProcessManager 对同一个正在运行的进程返回同一个 Process，进程号可能被重复使用，不能用来比较
+func (p *processWatch) track(proc Process) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.proc == proc {
+		return
+	}
+
+	p.proc, p.killed, p.noted = proc, false, false
+
+	go func() {
+		<-proc.Exited()
+		p.noteExit(proc)
+	}()
+}
+
+// kill 结束当前进程，不计入退出次数
+func (p *processWatch) kill(proc Process) error {
+	p.mu.Lock()
+	if p.proc == proc {
+		p.killed = true
+	}
+	p.mu.Unlock()
+
+	return proc.Kill()
+}
+
+func (p *processWatch) noteExit(proc Process) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.proc != proc || p.noted {
+		return
+	}
+
+	p.noted = true
+
+	if p.killed {
+		return
+	}
+
+	p.crashes = append(p.crashes, time.Now())
+
+	logrus.WithField("process", p.filename).WithField("pid", proc.PID()).WithField("crashes", len(p.crashes)).Warnln("FBSdk进程意外退出")
+}
+
+// checkExit 确认当前进程是否已经退出，不依赖监控 goroutine 的调度
+func (p *processWatch) checkExit() {
+	p.mu.Lock()
+	proc := p.proc
+	p.mu.Unlock()
+
+	if proc == nil {
+		return
+	}
+
+	select {
+	case <-proc.Exited():
+		p.noteExit(proc)
+	default:
+	}
+}
+
+// allowRestart 暂停重启期间返回 ErrCrashLoop
+func (p *processWatch) allowRestart() (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+
+	if now.Before(p.backoffUntil) {
+		logrus.WithField("process", p.filename).WithField("until", p.backoffUntil).Debugln("FBSdk暂停重启中")
+		return ErrCrashLoop
+	}
+
+	var recent []time.Time
+	for _, t := range p.crashes {
+		if now.Sub(t) < p.crashWindow {
+			recent = append(recent, t)
+		}
+	}
+	p.crashes = recent
+
+	if p.crashLimit <= 0 || len(p.crashes) < p.crashLimit {
+		return
+	}
+
+	p.backoffUntil = now.Add(p.crashBackoff)
+	p.crashes = nil
+
+	logrus.WithField("process", p.filename).
+		WithField("crashes", p.crashLimit).
+		WithField("window", p.crashWindow).
+		WithField("backoff", p.crashBackoff).
+		Errorln("FBSdk频繁退出，暂停重启，请人工检查")
+
+	return ErrCrashLoop
+}
+
+// noteNotReady 启动后主窗口没有出现，计入退出次数
+func (p *processWatch) noteNotReady() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.crashes = append(p.crashes, time.Now())
+}
+
+// findProcess 返回正在运行的 FBSdk 进程并开始监控，没有时返回 nil
+func (p *Robot) findProcess() Process {
+	proc := p.processes.Find(p.filename)
+	if proc != nil {
+		p.watch.track(proc)
+	}
+	return proc
+}
+
+// waitReady 每秒检查一次新启动的进程是否创建了主窗口，最多等待 readyTimeout
+func (p *Robot) waitReady(ctx context.Context, proc Process) (err error) {
+	for i := 0; i <= int(p.readyTimeout/time.Second); i++ {
+		if p.mainWindow() != 0 {
+			return
+		}
+
+		select {
+		case <-proc.Exited():
+			logrus.WithField("username", p.userName).WithField("pid", proc.PID()).Errorln("FBSdk启动后立即退出")
+			return ErrProcessNotReady
+		default:
+		}
+
+		logrus.WithField("username", p.userName).WithField("pid", proc.PID()).Debugln("等待主窗口出现...")
+		if err = p.desktop.Sleep(ctx, time.Second); err != nil {
+			return
+		}
+	}
+
+	logrus.WithField("username", p.userName).WithField("pid", proc.PID()).WithField("timeout", p.readyTimeout).Errorln("FBSdk启动后没有出现主窗口")
+
+	p.watch.noteNotReady()
+	p.watch.kill(proc)
+
+	return ErrProcessNotReady
+}
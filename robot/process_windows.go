@@ -0,0 +1,93 @@
+package robot
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// osProcessManager 按进程号缓存找到的进程，每个进程只有一个等待退出的 goroutine
+type osProcessManager struct {
+	mu    sync.Mutex
+	procs map[int]*osProcess
+}
+
+var defaultProcessManager = &osProcessManager{procs: make(map[int]*osProcess)}
+
+func DefaultProcessManager() ProcessManager {
+	return defaultProcessManager
+}
+
+func (p *osProcessManager) Find(name string) Process {
+	pid := int(findProcess(name))
+	if pid == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if proc, exist := p.procs[pid]; exist {
+		return proc
+	}
+
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return nil
+	}
+
+	return p.add(proc)
+}
+
+func (p *osProcessManager) Start(path string, args []string, dir string) (Process, error) {
+	attr := &os.ProcAttr{
+		Dir:   dir,
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
+	}
+
+	proc, err := os.StartProcess(path, append([]string{filepath.Base(path)}, args...), attr)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.add(proc), nil
+}
+
+func (p *osProcessManager) add(proc *os.Process) *osProcess {
+	op := &osProcess{proc: proc, exited: make(chan struct{})}
+	p.procs[proc.Pid] = op
+
+	go func() {
+		proc.Wait()
+		close(op.exited)
+
+		p.mu.Lock()
+		if p.procs[proc.Pid] == op {
+			delete(p.procs, proc.Pid)
+		}
+		p.mu.Unlock()
+	}()
+
+	return op
+}
+
+// osProcess Windows 下 os.Process.Wait 也可以等待不是由本进程启动的进程
+type osProcess struct {
+	proc   *os.Process
+	exited chan struct{}
+}
+
+func (p *osProcess) PID() int {
+	return p.proc.Pid
+}
+
+func (p *osProcess) Kill() error {
+	return p.proc.Kill()
+}
+
+func (p *osProcess) Exited() <-chan struct{} {
+	return p.exited
+}
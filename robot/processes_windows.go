@@ -10,11 +10,21 @@ func findProcess(name string) uint32 {
 
 	var bytesReturned, cProcesses uint32 = 0, 0
 
-	if !w32.EnumProcesses(processIds, 1024, &bytesReturned) {
-		return 0
+	// cb 和 bytesReturned 都是字节数，缓冲区被填满时可能还有更多进程，扩大后重新获取
+	for {
+		cb := uint32(len(processIds) * 4)
+		if !w32.EnumProcesses(processIds, cb, &bytesReturned) {
+			return 0
+		}
+
+		if bytesReturned < cb {
+			break
+		}
+
+		processIds = make([]uint32, len(processIds)*2)
 	}
 
-	cProcesses = bytesReturned / 2
+	cProcesses = bytesReturned / 4
 
 	for i := 0; i < int(cProcesses); i++ {
 		if processIds[i] != 0 {
@@ -0,0 +1,412 @@
+package robot
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-akka/configuration"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrProfileNotFound = errors.New("ui profile not found")
+	ErrBadProfile      = errors.New("bad ui profile")
+	ErrBadHotkey       = errors.New("bad hotkey")
+)
+
+const (
+	// ProfileAuto 按主窗口的类名和标题自动识别
+	ProfileAuto = "auto"
+
+	DefaultProfileName = "default"
+)
+
+// Hotkey 组合键，依次按下、倒序松开
+type Hotkey []uint16
+
+// ParseHotkey 解析 ctrl+i、ctrl+shift+b 这样的组合键
+func ParseHotkey(s string) (key Hotkey, err error) {
+	for _, name := range strings.Split(strings.ToLower(s), "+") {
+		name = strings.TrimSpace(name)
+
+		switch {
+		case name == "ctrl":
+			key = append(key, VKControl)
+		case name == "shift":
+			key = append(key, VKShift)
+		case name == "alt":
+			key = append(key, VKAlt)
+		case len(name) == 1 && (name[0] >= 'a' && name[0] <= 'z' || name[0] >= '0' && name[0] <= '9'):
+			// 虚拟键码与大写字母的ASCII码相同
+			key = append(key, uint16(strings.ToUpper(name)[0]))
+		default:
+			err = fmt.Errorf("%w: %q", ErrBadHotkey, s)
+			return
+		}
+	}
+
+	return
+}
+
+func (p Hotkey) String() string {
+	var names []string
+	for _, k := range p {
+		switch k {
+		case VKControl:
+			names = append(names, "ctrl")
+		case VKShift:
+			names = append(names, "shift")
+		case VKAlt:
+			names = append(names, "alt")
+		default:
+			names = append(names, strings.ToLower(string(rune(k))))
+		}
+	}
+	return strings.Join(names, "+")
+}
+
+// Profile 一个 FBSdk 版本的界面特征，新版本的客户端只需要增加一个 profile 文件
+type Profile struct {
+	Name string
+
+	MainClass string // 主窗口类名
+	MainTitle string // 主窗口标题，自动识别时精确匹配
+
+	LoginClass string // 联机登录窗口
+	LoginTitle string
+
+	LoginButtonClass string // 登录窗口的登录按钮
+	LoginButtonText  string
+
+	UserNameClass       string // 登录窗口中显示登录名的控件
+	PasswordClassPrefix string // 登录窗口中密码框的类名前缀
+
+	ListViewClass string // 主窗口中的 ListView
+	ListViewCount int    // 主窗口中 ListView 的数量
+	LogsListView  int    // 日志列表是第几个 ListView
+	LoginListView int    // 已登录用户列表是第几个 ListView
+
+	LogLevelColumn      int // 日志列表中级别、时间、内容所在的列
+	LogTimeColumn       int
+	LogMessageColumn    int
+	SessionUserColumn   int // 登录列表中登录名、状态所在的列
+	SessionStatusColumn int
+
+	LoginKey      Hotkey // 打开联机登录窗口
+	LogoutKey     Hotkey // 签退
+	ListenKey     Hotkey // 启动HTTP服务
+	StopListenKey Hotkey // 停止HTTP服务
+}
+
+// DefaultProfile 目前使用的 FBSdk 版本
+func DefaultProfile() Profile {
+	return Profile{
+		Name: DefaultProfileName,
+
+		MainClass: "TMainFrm",
+		MainTitle: "招商银行企业银行直联",
+
+		LoginClass: "TOnlineLoginFrm",
+		LoginTitle: "联机登录 (110100)",
+
+		LoginButtonClass: "TFBSpeedButton",
+		LoginButtonText:  "登录[&L]",
+
+		UserNameClass:       "Edit",
+		PasswordClassPrefix: "ATL:",
+
+		ListViewClass: "TFBListView",
+		ListViewCount: 2,
+		LogsListView:  IDLV_LOGS,
+		LoginListView: IDLV_LOGIN,
+
+		LogLevelColumn:      0,
+		LogTimeColumn:       1,
+		LogMessageColumn:    2,
+		SessionUserColumn:   0,
+		SessionStatusColumn: 1,
+
+		LoginKey:      Hotkey{VKControl, 'I'},
+		LogoutKey:     Hotkey{VKControl, 'O'},
+		ListenKey:     Hotkey{VKControl, 'B'},
+		StopListenKey: Hotkey{VKControl, 'E'},
+	}
+}
+
+func (p *Profile) validate() (err error) {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w: %s: %s", ErrBadProfile, p.Name, reason)
+	}
+
+	switch {
+	case len(p.Name) == 0:
+		return fmt.Errorf("%w: name is required", ErrBadProfile)
+	case p.Name == ProfileAuto:
+		return invalid("name auto is reserved")
+	case len(p.MainClass) == 0 || len(p.MainTitle) == 0:
+		return invalid("main-class and main-title are required")
+	case p.ListViewCount <= p.LogsListView || p.ListViewCount <= p.LoginListView || p.LogsListView < 0 || p.LoginListView < 0:
+		return invalid("listview index out of range")
+	case p.LogsListView == p.LoginListView:
+		return invalid("logs-listview and login-listview must be different")
+	case p.LogLevelColumn < 0 || p.LogTimeColumn < 0 || p.LogMessageColumn < 0 || p.SessionUserColumn < 0 || p.SessionStatusColumn < 0:
+		return invalid("column index must not be negative")
+	}
+
+	return
+}
+
+// ParseProfile 读取 profile，未配置的项使用 base 中的值
+//
+//	{
+//		name: "fbsdk-7.2"
+//		main-title: "招商银行企业银行直联7.2.0.0"
+//		login-title: "联机登录 (120100)"
+//		hotkeys { login: "ctrl+l" }
+//	}
+func ParseProfile(conf *configuration.Config, base Profile) (profile Profile, err error) {
+	profile = base
+
+	str := func(key string, field *string) {
+		*field = conf.GetString(key, *field)
+	}
+
+	num := func(key string, field *int) {
+		*field = int(conf.GetInt32(key, int32(*field)))
+	}
+
+	key := func(name string, field *Hotkey) {
+		if err != nil || !conf.HasPath("hotkeys."+name) {
+			return
+		}
+		*field, err = ParseHotkey(conf.GetString("hotkeys." + name))
+	}
+
+	str("name", &profile.Name)
+	str("main-class", &profile.MainClass)
+	str("main-title", &profile.MainTitle)
+	str("login-class", &profile.LoginClass)
+	str("login-title", &profile.LoginTitle)
+	str("login-button-class", &profile.LoginButtonClass)
+	str("login-button-text", &profile.LoginButtonText)
+	str("username-class", &profile.UserNameClass)
+	str("password-class-prefix", &profile.PasswordClassPrefix)
+	str("listview-class", &profile.ListViewClass)
+	num("listview-count", &profile.ListViewCount)
+	num("logs-listview", &profile.LogsListView)
+	num("login-listview", &profile.LoginListView)
+	num("log-level-column", &profile.LogLevelColumn)
+	num("log-time-column", &profile.LogTimeColumn)
+	num("log-message-column", &profile.LogMessageColumn)
+	num("session-user-column", &profile.SessionUserColumn)
+	num("session-status-column", &profile.SessionStatusColumn)
+
+	key("login", &profile.LoginKey)
+	key("logout", &profile.LogoutKey)
+	key("listen", &profile.ListenKey)
+	key("stop-listen", &profile.StopListenKey)
+
+	if err != nil {
+		err = fmt.Errorf("%w: %s: %v", ErrBadProfile, profile.Name, err)
+		return
+	}
+
+	err = profile.validate()
+
+	return
+}
+
+// LoadProfiles 返回内置 profile 和 dir 下所有 *.conf 中的 profile。
+// cmbVersion 不为空时，内置 profile 的主窗口标题追加版本号，与旧的 cmb-version 配置兼容
+func LoadProfiles(dir, cmbVersion string) (profiles []Profile, err error) {
+	def := DefaultProfile()
+	def.MainTitle += cmbVersion
+
+	profiles = []Profile{def}
+
+	if len(dir) == 0 {
+		return
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.conf"))
+	if err != nil {
+		return
+	}
+
+	sort.Strings(files)
+
+	for _, file := range files {
+		var text []byte
+		if text, err = ioutil.ReadFile(file); err != nil {
+			return
+		}
+
+		var conf *configuration.Config
+		if conf, err = parseProfileFile(text); err != nil {
+			err = fmt.Errorf("%s: %w", filepath.Base(file), err)
+			return
+		}
+
+		var profile Profile
+		profile, err = ParseProfile(conf, DefaultProfile())
+		if err != nil {
+			err = fmt.Errorf("%s: %w", filepath.Base(file), err)
+			return
+		}
+
+		for _, exist := range profiles {
+			if exist.Name == profile.Name {
+				err = fmt.Errorf("%s: %w: duplicate name %s", filepath.Base(file), ErrBadProfile, profile.Name)
+				return
+			}
+		}
+
+		profiles = append(profiles, profile)
+	}
+
+	return
+}
+
+// parseProfileFile configuration.ParseString 遇到格式错误时会 panic，转换为 ErrBadProfile
+func parseProfileFile(text []byte) (conf *configuration.Config, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			conf = nil
+			err = fmt.Errorf("%w: %v", ErrBadProfile, r)
+		}
+	}()
+
+	conf = configuration.ParseString(string(text))
+
+	return
+}
+
+// FindProfile 按名称查找，name 为 auto 或空时返回 nil
+func FindProfile(profiles []Profile, name string) (profile *Profile, err error) {
+	if len(name) == 0 || name == ProfileAuto {
+		return
+	}
+
+	for i := range profiles {
+		if profiles[i].Name == name {
+			return &profiles[i], nil
+		}
+	}
+
+	err = fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+
+	return
+}
+
+// uiProfiles 当前使用的界面 profile，auto 为true时按主窗口标题切换。
+// Robot 和 LogStream 各有一份，Logs、Sessions 等可能与 Run 同时调用，current 需要加锁
+type uiProfiles struct {
+	profiles []Profile
+	auto     bool
+
+	mu      sync.Mutex
+	current *Profile
+}
+
+// newUIProfiles 读取 ui-profile、ui-profiles-dir 和 cmb-version
+func newUIProfiles(config *configuration.Config) (p *uiProfiles, err error) {
+	profiles, err := LoadProfiles(config.GetString("ui-profiles-dir"), config.GetString("cmb-version", ""))
+	if err != nil {
+		return
+	}
+
+	ui, err := FindProfile(profiles, config.GetString("ui-profile", ProfileAuto))
+	if err != nil {
+		return
+	}
+
+	p = &uiProfiles{current: ui, profiles: profiles, auto: ui == nil}
+	if p.auto {
+		p.current = &p.profiles[0]
+	}
+
+	return
+}
+
+// ui 返回当前使用的界面 profile，profiles 不会修改，返回的指针可以一直使用
+func (p *uiProfiles) ui() *Profile {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.current
+}
+
+// name 返回当前使用的界面 profile，自动识别时为 auto(名称)
+func (p *uiProfiles) name() string {
+	if p.auto {
+		return ProfileAuto + "(" + p.ui().Name + ")"
+	}
+	return p.ui().Name
+}
+
+// ProfileName 返回当前使用的界面 profile，自动识别时为 auto(名称)
+func (p *Robot) ProfileName() string {
+	return p.uiProfiles.name()
+}
+
+// detect 在顶层窗口中查找与某个 profile 的主窗口类名和标题一致的窗口，没有找到时返回 nil
+func (p *uiProfiles) detect(desktop Desktop) *Profile {
+	var found *Profile
+
+	desktop.EnumChildWindows(0, func(hwnd HWND) bool {
+		className := desktop.ClassName(hwnd)
+		title := desktop.WindowText(hwnd)
+
+		for i := range p.profiles {
+			if p.profiles[i].MainClass == className && p.profiles[i].MainTitle == title {
+				found = &p.profiles[i]
+				return false
+			}
+		}
+		return true
+	})
+
+	return found
+}
+
+// mainWindow 返回主窗口和与之对应的 profile，自动识别时当前 profile 找不到主窗口会重新识别
+func (p *uiProfiles) mainWindow(desktop Desktop, entry *logrus.Entry) (hwnd HWND, ui *Profile) {
+	ui = p.ui()
+
+	hwnd = desktop.FindWindow(ui.MainClass, ui.MainTitle)
+	if hwnd != 0 || !p.auto {
+		return
+	}
+
+	profile := p.detect(desktop)
+	if profile == nil {
+		return
+	}
+
+	if profile.Name != ui.Name {
+		entry.WithField("profile", profile.Name).WithField("title", profile.MainTitle).Infoln("识别到FBSdk版本")
+
+		p.mu.Lock()
+		p.current = profile
+		p.mu.Unlock()
+	}
+
+	ui = profile
+	hwnd = desktop.FindWindow(ui.MainClass, ui.MainTitle)
+
+	return
+}
+
+func (p *Robot) mainWindow() HWND {
+	hwnd, _ := p.mainWindowProfile()
+	return hwnd
+}
+
+func (p *Robot) mainWindowProfile() (HWND, *Profile) {
+	return p.uiProfiles.mainWindow(p.desktop, logrus.WithField("username", p.userName))
+}
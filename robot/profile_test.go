@@ -0,0 +1,72 @@
+package robot
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadProfiles(t *testing.T) {
+	dir := t.TempDir()
+
+	text := `name: v2
+main-title: "招商银行企业银行直联 V2"
+hotkeys.login: "ctrl+l"`
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "v2.conf"), []byte(text), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	profiles, err := LoadProfiles(dir, " 7.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(profiles) != 2 || profiles[0].Name != DefaultProfileName || profiles[1].Name != "v2" {
+		t.Fatalf("profiles = %+v", profiles)
+	}
+
+	if profiles[0].MainTitle != DefaultProfile().MainTitle+" 7.0" {
+		t.Errorf("built-in main title = %q, want the cmb-version suffix", profiles[0].MainTitle)
+	}
+
+	// 没有配置的项使用内置 profile 的值
+	v2 := profiles[1]
+	if v2.MainTitle != "招商银行企业银行直联 V2" || v2.LoginClass != DefaultProfile().LoginClass {
+		t.Errorf("v2 = %+v", v2)
+	}
+}
+
+func TestLoadProfilesErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"unknown token", `name: v2, main-title: ${`},
+		{"bad escape", `name: "v\2"`},
+		{"unresolved substitution", `name: ${version}`},
+		{"duplicate", `name: default`},
+		{"bad hotkey", `name: v2, hotkeys.login: "F3"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			if err := ioutil.WriteFile(filepath.Join(dir, "broken.conf"), []byte(tt.text), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := LoadProfiles(dir, "")
+			if !errors.Is(err, ErrBadProfile) {
+				t.Fatalf("LoadProfiles = %v, want %v", err, ErrBadProfile)
+			}
+
+			if !strings.Contains(err.Error(), "broken.conf") {
+				t.Errorf("error %q does not name the file", err)
+			}
+		})
+	}
+}
@@ -1,16 +1,12 @@
 package robot
 
 import (
+	"context"
 	"errors"
 	"net"
-	"os"
-	"path/filepath"
 	"strings"
-	"syscall"
 	"time"
-	"unsafe"
 
-	"github.com/AllenDang/w32"
 	"github.com/go-akka/configuration"
 	"github.com/sirupsen/logrus"
 )
@@ -35,6 +31,14 @@ var (
 	ErrLoginFailure            = errors.New("login failure")
 	ErrNetworkError            = errors.New("network error")
 	ErrCrashWindow             = errors.New("crash window found")
+	ErrRunTimeout              = errors.New("robot run exceeded its time budget")
+)
+
+const (
+	DefaultPath       = "C:\\Program Files\\CMB\\FbSdk\\Bin\\FBSdkManager.exe"
+	DefaultListenAddr = "127.0.0.1:8080"
+
+	DefaultRunTimeout = time.Minute * 10
 )
 
 type RunMode int
@@ -45,10 +49,9 @@ const (
 	RunModeReLogin  RunMode = 4
 )
 
-var (
-	mainFormTitle = syscall.StringToUTF16Ptr("招商银行企业银行直联")
-	mainFormClass = syscall.StringToUTF16Ptr("TMainFrm")
-)
+// 多个账号共用同一个FBSdk界面，同一时间只允许一个机器人操作桌面。
+// 使用channel而不是Mutex，等待锁时可以被取消
+var desktopLock = make(chan struct{}, 1)
 
 type Robot struct {
 	userName       string
@@ -57,26 +60,78 @@ type Robot struct {
 	path           string
 	listenAddr     string
 	filename       string
+	runTimeout     time.Duration
+	dialogRules    []DialogRule
+
+	*uiProfiles
+
+	// Run 失败时保存窗口快照的目录和保留数量，snapshotKeep 为0时不保存
+	snapshotDir  string
+	snapshotKeep int
+
+	// 启动 FBSdk 的参数和工作目录，启动后等待主窗口出现的时间
+	args         []string
+	dir          string
+	readyTimeout time.Duration
+	watch        *processWatch
+
+	desktop   Desktop
+	processes ProcessManager
 }
 
 func NewRobot(config *configuration.Config) (robot *Robot, err error) {
+	return NewRobotWithDesktop(config, DefaultDesktop())
+}
+
+// NewRobotWithDesktop desktop 同时实现了 ProcessManager 时（如 fakedesktop）由它管理进程，否则使用系统进程
+func NewRobotWithDesktop(config *configuration.Config, desktop Desktop) (robot *Robot, err error) {
+	processes, ok := desktop.(ProcessManager)
+	if !ok {
+		processes = DefaultProcessManager()
+	}
+
+	return NewRobotWithProcesses(config, desktop, processes)
+}
+
+func NewRobotWithProcesses(config *configuration.Config, desktop Desktop, processes ProcessManager) (robot *Robot, err error) {
+	if desktop == nil {
+		err = ErrNoDesktop
+		return
+	}
+
+	if processes == nil {
+		err = ErrNoProcessManager
+		return
+	}
+
 	userName := config.GetString("username")
 	loginPassword := config.GetString("login-password")
 	usbKeyPassword := config.GetString("usbkey-password")
-	path := config.GetString("path", "C:\\Program Files\\CMB\\FbSdk\\Bin\\FBSdkManager.exe")
-	listenAddr := config.GetString("listen-addr", "127.0.0.1:8080")
-	filename := filepath.Base(path)
-	cmbVersion := config.GetString("cmb-version", "")
-
-	if len(cmbVersion) > 0 {
-		mainFormTitle = syscall.StringToUTF16Ptr("招商银行企业银行直联" + cmbVersion)
-	}
+	path := config.GetString("path", DefaultPath)
+	listenAddr := config.GetString("listen-addr", DefaultListenAddr)
+	filename := path[strings.LastIndexAny(path, `\/`)+1:] // 非Windows平台下 filepath 不识别反斜杠
+	runTimeout := config.GetTimeDuration("run-timeout", DefaultRunTimeout)
+	snapshotDir := config.GetString("snapshot-dir", DefaultSnapshotDir)
+	snapshotKeep := int(config.GetInt32("snapshot-keep", DefaultSnapshotKeep))
+	args := config.GetStringList("process-args")
+	dir := config.GetString("process-dir", DefaultProcessDir(path))
+	readyTimeout := config.GetTimeDuration("ready-timeout", DefaultReadyTimeout)
 
 	if len(userName) == 0 {
 		err = ErrEmptyUserName
 		return
 	}
 
+	dialogRules, err := LoadDialogRules(config)
+	if err != nil {
+		return
+	}
+
+	profiles, err := newUIProfiles(config)
+	if err != nil {
+		return
+	}
+
 	if len(loginPassword) != 8 {
 		err = ErrBadLoginPasswordLength
 		return
@@ -94,186 +149,305 @@ func NewRobot(config *configuration.Config) (robot *Robot, err error) {
 		path:           path,
 		listenAddr:     listenAddr,
 		filename:       filename,
+		runTimeout:     runTimeout,
+		dialogRules:    dialogRules,
+		uiProfiles:     profiles,
+		snapshotDir:    snapshotDir,
+		snapshotKeep:   snapshotKeep,
+		args:           args,
+		dir:            dir,
+		readyTimeout:   readyTimeout,
+		desktop:        desktop,
+		processes:      processes,
+
+		watch: sharedWatch(processes, filename,
+			int(config.GetInt32("crash-limit", DefaultCrashLimit)),
+			config.GetTimeDuration("crash-window", DefaultCrashWindow),
+			config.GetTimeDuration("crash-backoff", DefaultCrashBackoff),
+		),
 	}, nil
 }
 
-func (p *Robot) Logout() (err error) {
+func (p *Robot) Logout() error {
+	return p.LogoutContext(context.Background())
+}
+
+func (p *Robot) LogoutContext(ctx context.Context) (err error) {
 	pid := p.getMainProcessPID()
 	if pid == 0 {
 		err = ErrProcessNotAlive
 		return
 	}
 
-	hwnd := w32.FindWindowW(mainFormClass, mainFormTitle)
+	hwnd := p.mainWindow()
+
+	p.desktop.ShowWindow(hwnd)
+	p.desktop.SetForeground(hwnd)
 
-	w32.ShowWindow(hwnd, w32.SW_NORMAL)
-	w32.SetForegroundWindow(hwnd)
+	if err = p.desktop.Sleep(ctx, time.Second*2); err != nil {
+		return
+	}
+
+	p.desktop.TapKey(p.ui().LogoutKey...)
 
-	time.Sleep(time.Second * 2)
+	for {
+		action, e := p.checkDialogs(hwnd, PhaseLogout)
+		if e != nil {
+			err = e
+			return
+		}
 
-	// o+control
-	TapKey(w32.VK_CONTROL, 'O')
+		if len(action) == 0 {
+			break
+		}
 
-	for p.closeMessageBox(hwnd, "#32770", "招商银行企业银行直联系统", "确定", "确定要签退用户") {
-		logrus.WithField("username", p.userName).Debugln("捕获签退用户的确认提示框, 准备模拟点击确定")
-		time.Sleep(time.Second * 2)
+		if err = p.desktop.Sleep(ctx, time.Second*2); err != nil {
+			return
+		}
 	}
 
 	return
 }
 
 func (p *Robot) IsLoggedIn() bool {
-	hwnd := w32.FindWindowW(mainFormClass, mainFormTitle)
+	hwnd, ui := p.mainWindowProfile()
 
-	lvs := listViews(hwnd)
+	lvs := findListViews(p.desktop, ui, hwnd)
 
-	if len(lvs) != 2 {
-		logrus.WithField("username", p.userName).Errorln("ListView数量不等于2")
+	if len(lvs) != ui.ListViewCount {
+		logrus.WithField("username", p.userName).WithField("profile", ui.Name).WithField("count", len(lvs)).Errorf("ListView数量不等于%d", ui.ListViewCount)
 		return false
 	}
 
-	loginName := getLVItem(lvs[IDLV_LOGIN], 0, 0)
-	if loginName == p.userName {
-		return true
+	for _, s := range readSessions(p.desktop, ui, lvs[ui.LoginListView]) {
+		if s.UserName == p.userName {
+			return true
+		}
 	}
 	return false
 }
 
 func (p *Robot) Login() (alreadyLoggedin bool, err error) {
+	return p.LoginContext(context.Background())
+}
+
+func (p *Robot) LoginContext(ctx context.Context) (alreadyLoggedin bool, err error) {
 	pid := p.getMainProcessPID()
 	if pid == 0 {
 		err = ErrProcessNotAlive
 		return
 	}
 
-	hwnd := w32.FindWindowW(mainFormClass, mainFormTitle)
+	hwnd := p.mainWindow()
 
-	w32.ShowWindow(hwnd, w32.SW_NORMAL)
-	w32.SetForegroundWindow(hwnd)
+	p.desktop.ShowWindow(hwnd)
+	p.desktop.SetForeground(hwnd)
 
-	time.Sleep(time.Second * 3)
+	if err = p.desktop.Sleep(ctx, time.Second*3); err != nil {
+		return
+	}
 
-	alreadyLoggedin, err = p.login(hwnd)
+	alreadyLoggedin, err = p.login(ctx, hwnd)
 
 	return
 }
 
 func (p *Robot) Listen() bool {
-	if p.IsListening() {
+	return p.ListenContext(context.Background())
+}
+
+// ListenContext ctx 结束时返回false
+func (p *Robot) ListenContext(ctx context.Context) bool {
+	if p.IsListeningContext(ctx) {
 		return true
 	}
 
-	hwnd := w32.FindWindowW(mainFormClass, mainFormTitle)
+	hwnd := p.mainWindow()
 
-	w32.ShowWindow(hwnd, w32.SW_NORMAL)
-	w32.SetForegroundWindow(hwnd)
+	p.desktop.ShowWindow(hwnd)
+	p.desktop.SetForeground(hwnd)
 
-	time.Sleep(time.Second * 2)
+	if p.desktop.Sleep(ctx, time.Second*2) != nil {
+		return false
+	}
 
-	// control+b
-	TapKey(w32.VK_CONTROL, 'B')
+	p.desktop.TapKey(p.ui().ListenKey...)
 
 	for i := 0; i < 5; i++ { // 多次尝试关闭。。。。
-		p.closeMessageBox(hwnd, "#32770", "招商银行企业银行直联系统", "确定", "HTTP服务已启动")
-		time.Sleep(time.Second)
+		if _, e := p.checkDialogs(hwnd, PhaseListen); e != nil {
+			return false
+		}
+		if p.desktop.Sleep(ctx, time.Second) != nil {
+			return false
+		}
 	}
 
-	return p.IsListening()
+	return p.IsListeningContext(ctx)
 }
 
 func (p *Robot) StopListen() bool {
-	if !p.IsListening() {
+	return p.StopListenContext(context.Background())
+}
+
+// StopListenContext ctx 结束时返回false
+func (p *Robot) StopListenContext(ctx context.Context) bool {
+	if !p.IsListeningContext(ctx) {
 		return true
 	}
 
-	hwnd := w32.FindWindowW(mainFormClass, mainFormTitle)
+	hwnd := p.mainWindow()
 
-	w32.ShowWindow(hwnd, w32.SW_NORMAL)
-	w32.SetForegroundWindow(hwnd)
+	p.desktop.ShowWindow(hwnd)
+	p.desktop.SetForeground(hwnd)
 
-	time.Sleep(time.Second * 2)
+	if p.desktop.Sleep(ctx, time.Second*2) != nil {
+		return false
+	}
 
-	// control+e
-	TapKey(w32.VK_CONTROL, 'E')
+	p.desktop.TapKey(p.ui().StopListenKey...)
 
 	for i := 0; i < 5; i++ { // 多次尝试关闭弹窗。。。。
-		p.closeMessageBox(hwnd, "#32770", "招商银行企业银行直联系统", "确定", "停止HTTP")
-		time.Sleep(time.Second)
+		if _, e := p.checkDialogs(hwnd, PhaseStopListen); e != nil {
+			return false
+		}
+		if p.desktop.Sleep(ctx, time.Second) != nil {
+			return false
+		}
 	}
 
-	return !p.IsListening()
+	return ctx.Err() == nil && !p.IsListeningContext(ctx)
 }
 
-func (p *Robot) RestartProcess() (err error) {
+func (p *Robot) RestartProcess() error {
+	return p.RestartProcessContext(context.Background())
+}
 
-	oldPid := p.getMainProcessPID()
-	if oldPid != 0 {
-		var proc *os.Process
-		proc, err = os.FindProcess(oldPid)
-		if err != nil {
-			return
-		}
+// RestartProcessContext 结束旧的进程并启动新的进程，等待主窗口出现。
+// FBSdk 频繁意外退出时暂停重启，返回 ErrCrashLoop
+func (p *Robot) RestartProcessContext(ctx context.Context) (err error) {
+
+	p.watch.checkExit()
+
+	if err = p.watch.allowRestart(); err != nil {
+		return
+	}
+
+	if old := p.findProcess(); old != nil {
+		oldPid := old.PID()
 
 		logrus.WithField("username", p.userName).WithField("old_pid", oldPid).Debugln("发现旧的程序")
 
-		if err = proc.Kill(); err != nil {
+		if err = p.watch.kill(old); err != nil {
 			return
 		}
 
 		for i := 0; i < 30; i++ {
 			logrus.WithField("username", p.userName).WithField("old_pid", oldPid).Debugln("等待窗口释放...")
-			h := w32.FindWindowW(mainFormClass, mainFormTitle)
+			h := p.mainWindow()
 			if h == 0 {
 				break
 			}
-			time.Sleep(time.Second)
+			if err = p.desktop.Sleep(ctx, time.Second); err != nil {
+				return
+			}
 		}
 
 		logrus.WithField("username", p.userName).WithField("old_pid", oldPid).Debugln("已经关闭旧的程序")
 	}
 
-	time.Sleep(time.Second * 3)
-
-	attr := &os.ProcAttr{
-		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
+	if err = p.desktop.Sleep(ctx, time.Second*3); err != nil {
+		return
 	}
 
-	newProc, err := os.StartProcess(p.path, nil, attr)
+	newProc, err := p.processes.Start(p.path, p.args, p.dir)
 	if err != nil {
 		return
 	}
 
-	time.Sleep(time.Second)
-	logrus.WithField("username", p.userName).WithField("proc_pid", newProc.Pid).Debugln("新的程序已经启动")
+	p.watch.track(newProc)
+
+	if err = p.desktop.Sleep(ctx, time.Second); err != nil {
+		return
+	}
+	logrus.WithField("username", p.userName).WithField("proc_pid", newProc.PID()).Debugln("新的程序已经启动")
+
+	if err = p.waitReady(ctx, newProc); err != nil {
+		return
+	}
+
+	logrus.WithField("username", p.userName).WithField("proc_pid", newProc.PID()).Debugln("主窗口已出现")
 
 	return
 }
 
-func (p *Robot) Run(mode RunMode) (err error) {
+func (p *Robot) Run(mode RunMode) error {
+	return p.RunContext(context.Background(), mode)
+}
+
+// RunContext 执行恢复，整个过程（包括等待桌面操作锁）不超过 run-timeout，
+// 超时返回 ErrRunTimeout，ctx 被取消时返回 ctx.Err()
+func (p *Robot) RunContext(ctx context.Context, mode RunMode) (err error) {
+
+	if p.runTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.runTimeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if err != nil && ctx.Err() == context.DeadlineExceeded {
+			logrus.WithField("username", p.userName).WithError(err).Errorln("机器人执行超时")
+			err = ErrRunTimeout
+		}
+	}()
+
+	logrus.WithField("username", p.userName).Debugln("等待获取桌面操作锁")
+
+	select {
+	case desktopLock <- struct{}{}:
+	case <-ctx.Done():
+		err = ctx.Err()
+		return
+	}
+	defer func() { <-desktopLock }()
+
+	// 在释放桌面操作锁之前记录失败时的界面
+	defer func() {
+		if err != nil {
+			p.saveSnapshot(ctx, err)
+		}
+	}()
 
 reRun:
 
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
 	if p.getMainProcessPID() == 0 {
 		mode = mode | RunModeRestart // 追加启动进程
 	}
 
-	if !p.IsListening() {
+	if !p.IsListeningContext(ctx) {
 		mode = mode | RunModeReListen // 如果没有监听，追加监听
 	}
 
 	if mode&RunModeRestart == RunModeRestart {
-		err = p.RestartProcess()
+		err = p.RestartProcessContext(ctx)
 		if err != nil {
 			return
 		}
 	}
 
 	if mode&RunModeReListen == RunModeReListen {
-		if p.IsListening() {
-			p.StopListen()
+		if p.IsListeningContext(ctx) {
+			p.StopListenContext(ctx)
 		}
 
-		if !p.Listen() {
+		if !p.ListenContext(ctx) {
+			if err = ctx.Err(); err != nil {
+				return
+			}
 			logrus.WithField("username", p.userName).Errorln("进行监听失败")
 			err = ErrListenFailure
 			return
@@ -282,7 +456,7 @@ reRun:
 
 	if mode&RunModeReLogin == RunModeReLogin {
 		if p.IsLoggedIn() {
-			err = p.Logout()
+			err = p.LogoutContext(ctx)
 		}
 
 		if err == ErrProcessNotAlive {
@@ -294,7 +468,7 @@ reRun:
 			return
 		}
 
-		_, err = p.Login()
+		_, err = p.LoginContext(ctx)
 		if err == ErrProcessNotAlive {
 			err = nil
 			goto reRun
@@ -306,38 +480,38 @@ reRun:
 	return
 }
 
-func (p *Robot) closeMessageBox(hwnd w32.HWND, windowClassName, windowTitleName, buttonName string, msgContent string) (ret bool) {
-	_, pid := w32.GetWindowThreadProcessId(hwnd)
+func (p *Robot) closeMessageBox(hwnd HWND, windowClassName, windowTitleName, buttonName string, msgContent string) (ret bool) {
+	pid := p.desktop.WindowProcessID(hwnd)
 	if pid == 0 {
 		return false
 	}
 
-	var dlgBoxHwnd []w32.HWND
+	var dlgBoxHwnd []HWND
 
-	fnOfEnumDlg := func(childHwnd w32.HWND, LPARAM w32.LPARAM) w32.LRESULT { //HWND hwnd, LPARAM lParam
-		className := w32.GetClassNameW(childHwnd)
-		title := w32.GetWindowText(childHwnd)
+	fnOfEnumDlg := func(childHwnd HWND) bool {
+		className := p.desktop.ClassName(childHwnd)
+		title := p.desktop.WindowText(childHwnd)
 
 		if windowClassName == className && windowTitleName == title {
-			_, pidDlg := w32.GetWindowThreadProcessId(childHwnd)
+			pidDlg := p.desktop.WindowProcessID(childHwnd)
 			if pidDlg != pid {
-				return 1
+				return true
 			}
 
 			logrus.WithField("username", p.userName).WithField("HWND", childHwnd).WithField("title", windowTitleName).WithField("class", windowClassName).Debugln("找到消息框")
 			dlgBoxHwnd = append(dlgBoxHwnd, childHwnd)
 		}
-		return 1
+		return true
 	}
 
-	w32.EnumChildWindows(0, fnOfEnumDlg, 0)
+	p.desktop.EnumChildWindows(0, fnOfEnumDlg)
 
 	for i := 0; i < len(dlgBoxHwnd); i++ {
-		var btnHwnds []w32.HWND
+		var btnHwnds []HWND
 		messageContentFound := false
 
-		fnOfEnumChild := func(childHwnd w32.HWND, LPARAM w32.LPARAM) w32.LRESULT {
-			windowName := w32.GetWindowText(childHwnd)
+		fnOfEnumChild := func(childHwnd HWND) bool {
+			windowName := p.desktop.WindowText(childHwnd)
 			if windowName == buttonName {
 				logrus.WithField("username", p.userName).WithField("button", windowName).Debugln("找到消息框按钮")
 				btnHwnds = append(btnHwnds, childHwnd)
@@ -350,18 +524,18 @@ func (p *Robot) closeMessageBox(hwnd w32.HWND, windowClassName, windowTitleName,
 				}
 			}
 
-			return 1
+			return true
 		}
 
-		w32.EnumChildWindows(dlgBoxHwnd[i], fnOfEnumChild, 0)
+		p.desktop.EnumChildWindows(dlgBoxHwnd[i], fnOfEnumChild)
 
-		w32.SetForegroundWindow(dlgBoxHwnd[i])
+		p.desktop.SetForeground(dlgBoxHwnd[i])
 
 		if messageContentFound == true || len(msgContent) == 0 {
 			logrus.WithField("username", p.userName).Debugln("向按钮发送点击事件")
 			for _, btnHwnd := range btnHwnds {
 				logrus.WithField("username", p.userName).WithField("parent_hwnd", dlgBoxHwnd[i]).WithField("HWND", btnHwnd).WithField("button", buttonName).Debugln("向消息框按钮发送点击事件")
-				w32.SendMessage(btnHwnd, w32.BM_CLICK, 0, 0)
+				p.desktop.Click(btnHwnd)
 				ret = true
 			}
 		}
@@ -371,28 +545,24 @@ func (p *Robot) closeMessageBox(hwnd w32.HWND, windowClassName, windowTitleName,
 
 }
 
-func (p *Robot) checkIsLoginWindowUsingUSBKey(hwnd w32.HWND) bool {
+func (p *Robot) checkIsLoginWindowUsingUSBKey(hwnd HWND) bool {
 
 	userNameFound := false
 
-	fnOfEnumLoginChild := func(childHwnd w32.HWND, LPARAM w32.LPARAM) w32.LRESULT {
-		className := w32.GetClassNameW(childHwnd)
-
-		txtUserName := make([]uint16, 255)
+	fnOfEnumLoginChild := func(childHwnd HWND) bool {
+		className := p.desktop.ClassName(childHwnd)
 
-		w32.SendMessage(childHwnd, w32.WM_GETTEXT, 255, uintptr(unsafe.Pointer(&txtUserName[0])))
+		strUserName := p.desktop.ControlText(childHwnd)
 
-		strUserName := syscall.UTF16ToString(txtUserName)
-
-		if "Edit" == className && p.userName == strUserName {
+		if p.ui().UserNameClass == className && p.userName == strUserName {
 			logrus.WithField("username", p.userName).WithField("HWND", childHwnd).Debugln("用户名已成功在列表中加载")
 			userNameFound = true
-			return 0
+			return false
 		}
-		return 1
+		return true
 	}
 
-	w32.EnumChildWindows(hwnd, fnOfEnumLoginChild, 0)
+	p.desktop.EnumChildWindows(hwnd, fnOfEnumLoginChild)
 
 	if !userNameFound {
 		logrus.WithField("username", p.userName).WithField("HWND", hwnd).Debugln("用户名未加载")
@@ -402,18 +572,18 @@ func (p *Robot) checkIsLoginWindowUsingUSBKey(hwnd w32.HWND) bool {
 	totalAltItems := 0
 	VisibleAltItems := 0
 
-	fnOfEnumAltTxt := func(childHwnd w32.HWND, LPARAM w32.LPARAM) w32.LRESULT {
-		className := w32.GetClassNameW(childHwnd)
-		if strings.HasPrefix(className, "ATL:") {
+	fnOfEnumAltTxt := func(childHwnd HWND) bool {
+		className := p.desktop.ClassName(childHwnd)
+		if strings.HasPrefix(className, p.ui().PasswordClassPrefix) {
 			totalAltItems++
-			if w32.IsWindowVisible(childHwnd) {
+			if p.desktop.IsWindowVisible(childHwnd) {
 				VisibleAltItems++
 			}
 		}
-		return 1
+		return true
 	}
 
-	w32.EnumChildWindows(hwnd, fnOfEnumAltTxt, 0)
+	p.desktop.EnumChildWindows(hwnd, fnOfEnumAltTxt)
 
 	if totalAltItems != VisibleAltItems {
 		logrus.WithField("username", p.userName).WithField("HWND", hwnd).WithField("total", totalAltItems).WithField("visible", VisibleAltItems).Debugln("密码框数量不匹配")
@@ -423,49 +593,56 @@ func (p *Robot) checkIsLoginWindowUsingUSBKey(hwnd w32.HWND) bool {
 	return true
 }
 
-func (p *Robot) login(mainHwnd w32.HWND) (alreadyLogin bool, err error) {
+func (p *Robot) login(ctx context.Context, mainHwnd HWND) (alreadyLogin bool, err error) {
 
 	// 1. start login window
 	logrus.WithField("username", p.userName).Infoln("开始登录")
 
-	classOfLogin := syscall.StringToUTF16Ptr("TOnlineLoginFrm")
-	titleOfLogin := syscall.StringToUTF16Ptr("联机登录 (110100)")
+	classOfLogin := p.ui().LoginClass
+	titleOfLogin := p.ui().LoginTitle
 
 relogin:
 	// close all old login window
 	for {
-		oldhwndLogin := w32.FindWindowW(classOfLogin, titleOfLogin)
+		oldhwndLogin := p.desktop.FindWindow(classOfLogin, titleOfLogin)
 		if oldhwndLogin != 0 {
 			logrus.WithField("username", p.userName).WithField("HWND", oldhwndLogin).Debugln("找到了已经开启的登陆窗口，已将其关闭")
-			w32.PostMessage(oldhwndLogin, w32.WM_SYSKEYDOWN, 'X', 1<<29)
-			time.Sleep(time.Second * 2)
+			p.desktop.CloseWindow(oldhwndLogin)
+			if err = p.desktop.Sleep(ctx, time.Second*2); err != nil {
+				return
+			}
 			continue
 		}
 		break
 	}
 
-	w32.SetForegroundWindow(mainHwnd)
-	// control+i
-	TapKey(w32.VK_CONTROL, 'I')
+	p.desktop.SetForeground(mainHwnd)
+	p.desktop.TapKey(p.ui().LoginKey...)
 
-	var hwndLogin w32.HWND
+	var hwndLogin HWND
 
 	for i := 0; i < 30; i++ {
 
 		logrus.WithField("username", p.userName).Debugln("查找登陆窗口中")
 
-		hwndLogin = w32.FindWindowW(classOfLogin, titleOfLogin)
+		hwndLogin = p.desktop.FindWindow(classOfLogin, titleOfLogin)
 
 		if hwndLogin != 0 {
 			logrus.WithField("username", p.userName).WithField("HWND", hwndLogin).Debugln("找到登录窗口")
 			break
 		}
 
-		time.Sleep(time.Second)
+		if err = p.desktop.Sleep(ctx, time.Second); err != nil {
+			return
+		}
 	}
 
-	if p.closeMessageBox(mainHwnd, "#32770", "招商银行企业银行直联系统", "确定", "HTTP") {
-		time.Sleep(time.Second * 2)
+	if action, e := p.checkDialogs(mainHwnd, PhaseOpenLogin); e != nil || action == ActionAlreadyLoggedIn {
+		return action == ActionAlreadyLoggedIn, e
+	} else if action == ActionRetry {
+		if err = p.desktop.Sleep(ctx, time.Second*2); err != nil {
+			return
+		}
 		goto relogin
 	}
 
@@ -474,7 +651,9 @@ relogin:
 		return
 	}
 
-	time.Sleep(time.Second * 2)
+	if err = p.desktop.Sleep(ctx, time.Second*2); err != nil {
+		return
+	}
 
 	// 2. validate window status
 	loginFrmCorrect := false
@@ -485,20 +664,19 @@ relogin:
 			break
 		}
 
-		if p.closeMessageBox(mainHwnd, "#32770", "Microsoft Visual C++ Runtime Library", "确定", "") {
-			logrus.WithField("username", p.userName).Errorln("发现VC++崩溃窗口")
-			err = ErrCrashWindow
-			return
+		if action, e := p.checkDialogs(mainHwnd, PhaseCheckLogin); e != nil || action == ActionAlreadyLoggedIn {
+			return action == ActionAlreadyLoggedIn, e
+		} else if action == ActionRetry {
+			if err = p.desktop.Sleep(ctx, time.Second*2); err != nil {
+				return
+			}
+			goto relogin
 		}
 
-		if p.closeMessageBox(mainHwnd, "#32770", "Abnormal program termination", "确定", "") {
-			logrus.WithField("username", p.userName).Errorln("发现异常退出窗口")
-			err = ErrCrashWindow
+		logrus.WithField("username", p.userName).Debugf("第%d次尝试失败，请确认USBkey已经生效.", i+1)
+		if err = p.desktop.Sleep(ctx, time.Second); err != nil {
 			return
 		}
-
-		logrus.WithField("username", p.userName).Debugf("第%d次尝试失败，请确认USBkey已经生效.", i+1)
-		time.Sleep(time.Second)
 	}
 
 	if !loginFrmCorrect {
@@ -508,19 +686,19 @@ relogin:
 
 	// 3. send password
 	logrus.WithField("username", p.userName).Debugln("准备输入密码")
-	var txtHwnds []w32.HWND
+	var txtHwnds []HWND
 
-	fn := func(childHwnd w32.HWND, LPARAM w32.LPARAM) w32.LRESULT { //HWND hwnd, LPARAM lParam
-		className := w32.GetClassNameW(childHwnd)
+	fn := func(childHwnd HWND) bool {
+		className := p.desktop.ClassName(childHwnd)
 
-		if strings.HasPrefix(className, "ATL:") {
+		if strings.HasPrefix(className, p.ui().PasswordClassPrefix) {
 			txtHwnds = append(txtHwnds, childHwnd)
 		}
 
-		return 1
+		return true
 	}
 
-	w32.EnumChildWindows(hwndLogin, fn, 0)
+	p.desktop.EnumChildWindows(hwndLogin, fn)
 
 	if len(txtHwnds) != 2 {
 		err = ErrBadPasswordBoxCount
@@ -531,21 +709,25 @@ relogin:
 
 	for i := 0; i < len(txtHwnds); i++ {
 
-		w32.SendMessage(txtHwnds[i], w32.WM_SETFOCUS, 0, 0)
+		p.desktop.Focus(txtHwnds[i])
 		pwd := passwords[i]
 
 		for _, c := range pwd {
-			w32.SetForegroundWindow(hwndLogin)
-			TapKey(uint16(c))
+			p.desktop.SetForeground(hwndLogin)
+			p.desktop.TapKey(uint16(c))
 		}
 
-		time.Sleep(time.Second * 2)
+		if err = p.desktop.Sleep(ctx, time.Second*2); err != nil {
+			return
+		}
 	}
 
-	time.Sleep(time.Second * 2)
+	if err = p.desktop.Sleep(ctx, time.Second*2); err != nil {
+		return
+	}
 
-	lvHwnds := listViews(mainHwnd)
-	logsCount := getLVItemRowCount(lvHwnds[IDLV_LOGS])
+	logsHwnd := listView(p.desktop, p.ui(), mainHwnd, p.ui().LogsListView)
+	logsCount := p.desktop.ListViewRowCount(logsHwnd)
 
 	logrus.WithField("username", p.userName).Debugln("已开始登录")
 	// 4. focus on editbox
@@ -558,44 +740,25 @@ relogin:
 	loginFrmDismissed := false
 	for i := 0; i < 30; i++ {
 
-		if p.closeMessageBox(mainHwnd, "#32770", "", "确定", "打开移动证书失败") {
-			err = ErrOpenUSBKeyFailure
-			return
-		}
-
-		if p.closeMessageBox(mainHwnd, "#32770", "", "确定", "证书密码错") {
-			err = ErrWrongUSBKeyPassword
-			return
-		}
-
-		if p.closeMessageBox(mainHwnd, "#32770", "", "确定", "登录密码错") {
-			err = ErrWrongLoginPassword
-			return
-		}
-
-		if p.closeMessageBox(mainHwnd, "#32770", "", "确定", "用户登录名不能为空") {
-			err = ErrEmptyUserNameWhileLogin
-			return
-		}
-
-		if p.closeMessageBox(mainHwnd, "#32770", "", "确定", "通讯故障") {
-			err = ErrNetworkError
-			return
-		}
-
-		if p.closeMessageBox(mainHwnd, "#32770", "", "确定", "取字段定义表文件失败") {
-			err = ErrNetworkError
-			return
+		if action, e := p.checkDialogs(mainHwnd, PhaseLoggingIn); e != nil || action == ActionAlreadyLoggedIn {
+			return action == ActionAlreadyLoggedIn, e
+		} else if action == ActionRetry {
+			if err = p.desktop.Sleep(ctx, time.Second*2); err != nil {
+				return
+			}
+			goto relogin
 		}
 
-		oldhwndLogin := w32.FindWindowW(classOfLogin, titleOfLogin)
+		oldhwndLogin := p.desktop.FindWindow(classOfLogin, titleOfLogin)
 		if oldhwndLogin == 0 {
 			loginFrmDismissed = true
 			break
 		}
 
 		logrus.WithField("username", p.userName).WithField("HWND", oldhwndLogin).Debugln("登录中......")
-		time.Sleep(time.Second)
+		if err = p.desktop.Sleep(ctx, time.Second); err != nil {
+			return
+		}
 	}
 
 	if !loginFrmDismissed {
@@ -603,29 +766,30 @@ relogin:
 		return
 	}
 
-	time.Sleep(time.Second * 2)
-
-	if p.closeMessageBox(mainHwnd, "#32770", "招商银行企业银行直联系统", "确定", "已经登录") {
-		logrus.WithField("username", p.userName).Debugln("用户已经登录")
-		alreadyLogin = true
+	if err = p.desktop.Sleep(ctx, time.Second*2); err != nil {
 		return
 	}
 
+	if action, e := p.checkDialogs(mainHwnd, PhaseLoggedIn); e != nil || action == ActionAlreadyLoggedIn {
+		return action == ActionAlreadyLoggedIn, e
+	} else if action == ActionRetry {
+		if err = p.desktop.Sleep(ctx, time.Second*2); err != nil {
+			return
+		}
+		goto relogin
+	}
+
 	for i := 0; i < 120; i++ {
-		logsCountAfter := getLVItemRowCount(lvHwnds[IDLV_LOGS])
-		if logsCountAfter > logsCount {
-			title := getLVItem(lvHwnds[IDLV_LOGS], 0, 0)
-			if title == "错误" {
-				message := getLVItem(lvHwnds[IDLV_LOGS], 0, 2)
-				time := getLVItem(lvHwnds[IDLV_LOGS], 0, 1)
-				logrus.WithField("username", p.userName).WithField("title", title).WithField("time", time).Debugln(message)
-				err = ErrLoginFailure
-				return
-			} else if title == "信息" {
-				message := getLVItem(lvHwnds[IDLV_LOGS], 0, 2)
-				time := getLVItem(lvHwnds[IDLV_LOGS], 0, 1)
-				logrus.WithField("username", p.userName).WithField("title", title).WithField("time", time).Debugln(message)
+		// 新的日志在列表顶部，逐条检查登录后新增的日志
+		if entries := readLogs(p.desktop, p.ui(), logsHwnd); len(entries) > logsCount {
+			for _, e := range entries[:len(entries)-logsCount] {
+				logrus.WithField("username", p.userName).WithField("title", e.Level).WithField("time", e.Time).Debugln(e.Message)
+				if e.Level == LogLevelError {
+					err = ErrLoginFailure
+					return
+				}
 			}
+			logsCount = len(entries)
 		}
 
 		if p.IsLoggedIn() {
@@ -633,7 +797,9 @@ relogin:
 		}
 
 		logrus.WithField("username", p.userName).Debugln("等待登录列表中显示登录信息......")
-		time.Sleep(time.Second)
+		if err = p.desktop.Sleep(ctx, time.Second); err != nil {
+			return
+		}
 	}
 
 	err = ErrLoginTimeout
@@ -641,32 +807,41 @@ relogin:
 	return
 }
 
-func (p *Robot) confirmOnLoginWindow(hwnd w32.HWND) bool {
+func (p *Robot) confirmOnLoginWindow(hwnd HWND) bool {
 	confirmd := false
-	fnOfEnumLoginChild := func(childHwnd w32.HWND, LPARAM w32.LPARAM) w32.LRESULT {
-		className := w32.GetClassNameW(childHwnd)
-		title := w32.GetWindowText(childHwnd)
+	fnOfEnumLoginChild := func(childHwnd HWND) bool {
+		className := p.desktop.ClassName(childHwnd)
+		title := p.desktop.WindowText(childHwnd)
 
-		if "TFBSpeedButton" == className && title == "登录[&L]" {
+		if p.ui().LoginButtonClass == className && title == p.ui().LoginButtonText {
 			confirmd = true
-			w32.PostMessage(childHwnd, w32.BM_CLICK, 0, 0)
-			return 0
+			p.desktop.PostClick(childHwnd)
+			return false
 		}
-		return 1
+		return true
 	}
 
-	w32.SetForegroundWindow(hwnd)
-	w32.EnumChildWindows(hwnd, fnOfEnumLoginChild, 0)
+	p.desktop.SetForeground(hwnd)
+	p.desktop.EnumChildWindows(hwnd, fnOfEnumLoginChild)
 
 	return confirmd
 }
 
 func (p *Robot) getMainProcessPID() int {
-	return int(findProcess(p.filename))
+	if proc := p.findProcess(); proc != nil {
+		return proc.PID()
+	}
+	return 0
 }
 
 func (p *Robot) IsListening() bool {
-	conn, err := net.Dial("tcp", p.listenAddr)
+	return p.IsListeningContext(context.Background())
+}
+
+func (p *Robot) IsListeningContext(ctx context.Context) bool {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", p.listenAddr)
 	if err != nil {
 		return false
 	}
@@ -0,0 +1,243 @@
+package robot
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultSnapshotDir  = "snapshots"
+	DefaultSnapshotKeep = 20
+)
+
+// Snapshot FBSdk 进程的窗口树，用于排查登录失败时界面的实际状态，
+// 可以通过 fakedesktop.LoadSnapshot 回放
+type Snapshot struct {
+	Time     time.Time         `json:"time"`
+	UserName string            `json:"username"`
+	Profile  string            `json:"profile"`
+	Process  string            `json:"process"`
+	PID      int               `json:"pid"`
+	Error    string            `json:"error,omitempty"`
+	Windows  []*WindowSnapshot `json:"windows"`
+}
+
+// WindowSnapshot 一个窗口或控件，Rows 只有 ListView 才有
+type WindowSnapshot struct {
+	HWND     HWND              `json:"hwnd"`
+	Class    string            `json:"class"`
+	Title    string            `json:"title"`
+	Text     string            `json:"text,omitempty"`
+	Visible  bool              `json:"visible"`
+	PID      int               `json:"pid"`
+	Redacted bool              `json:"redacted,omitempty"` // 密码框不记录内容
+	Rows     [][]string        `json:"rows,omitempty"`
+	Children []*WindowSnapshot `json:"children,omitempty"`
+}
+
+// ReadSnapshot 读取 JSON 格式的窗口树
+func ReadSnapshot(r io.Reader) (snap *Snapshot, err error) {
+	snap = &Snapshot{}
+	if err = json.NewDecoder(r).Decode(snap); err != nil {
+		snap = nil
+	}
+	return
+}
+
+func (p *Snapshot) WriteTo(w io.Writer) (n int64, err error) {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return
+	}
+
+	data = append(data, '\n')
+
+	written, err := w.Write(data)
+
+	return int64(written), err
+}
+
+// Snapshot 记录 FBSdk 进程的全部顶层窗口（主窗口、登录窗口、弹窗）及其子窗口
+func (p *Robot) Snapshot() *Snapshot {
+	snap := &Snapshot{
+		Time:     time.Now(),
+		UserName: p.userName,
+		Profile:  p.ui().Name,
+		Process:  p.filename,
+	}
+
+	if hwnd, ui := p.mainWindowProfile(); hwnd != 0 {
+		snap.PID = p.desktop.WindowProcessID(hwnd)
+		snap.Profile = ui.Name
+	}
+
+	if snap.PID == 0 {
+		snap.PID = p.getMainProcessPID()
+	}
+
+	if snap.PID == 0 {
+		return snap
+	}
+
+	var tops []HWND
+	p.desktop.EnumChildWindows(0, func(hwnd HWND) bool {
+		if p.desktop.WindowProcessID(hwnd) == snap.PID {
+			tops = append(tops, hwnd)
+		}
+		return true
+	})
+
+	tree := &windowTree{desktop: p.desktop, descendants: map[HWND][]HWND{}}
+
+	for _, hwnd := range tops {
+		snap.Windows = append(snap.Windows, p.snapshotWindow(tree, hwnd))
+	}
+
+	return snap
+}
+
+// windowTree 桌面接口只能遍历全部后代窗口，记录每个窗口的后代后，去掉孙窗口得到直接子窗口
+type windowTree struct {
+	desktop     Desktop
+	descendants map[HWND][]HWND
+}
+
+func (p *windowTree) all(hwnd HWND) []HWND {
+	if hwnds, exist := p.descendants[hwnd]; exist {
+		return hwnds
+	}
+
+	var hwnds []HWND
+	p.desktop.EnumChildWindows(hwnd, func(child HWND) bool {
+		hwnds = append(hwnds, child)
+		return true
+	})
+
+	p.descendants[hwnd] = hwnds
+
+	return hwnds
+}
+
+func (p *windowTree) children(hwnd HWND) (children []HWND) {
+	all := p.all(hwnd)
+
+	nested := map[HWND]bool{}
+	for _, child := range all {
+		if nested[child] {
+			continue
+		}
+		for _, grandchild := range p.all(child) {
+			nested[grandchild] = true
+		}
+	}
+
+	for _, child := range all {
+		if !nested[child] {
+			children = append(children, child)
+		}
+	}
+
+	return
+}
+
+func (p *Robot) snapshotWindow(tree *windowTree, hwnd HWND) *WindowSnapshot {
+	w := &WindowSnapshot{
+		HWND:    hwnd,
+		Class:   p.desktop.ClassName(hwnd),
+		Title:   p.desktop.WindowText(hwnd),
+		Visible: p.desktop.IsWindowVisible(hwnd),
+		PID:     p.desktop.WindowProcessID(hwnd),
+	}
+
+	if len(p.ui().PasswordClassPrefix) > 0 && strings.HasPrefix(w.Class, p.ui().PasswordClassPrefix) {
+		w.Title = ""
+		w.Redacted = true
+	} else if text := p.desktop.ControlText(hwnd); text != w.Title {
+		w.Text = text
+	}
+
+	if w.Class == p.ui().ListViewClass {
+		w.Rows = readRows(p.desktop, hwnd)
+	}
+
+	for _, child := range tree.children(hwnd) {
+		w.Children = append(w.Children, p.snapshotWindow(tree, child))
+	}
+
+	return w
+}
+
+// saveSnapshot 在 Run 失败后保存窗口树，每个登录名只保留最新的 snapshotKeep 个文件
+func (p *Robot) saveSnapshot(ctx context.Context, runErr error) {
+	if p.snapshotKeep <= 0 || len(p.snapshotDir) == 0 {
+		return
+	}
+
+	snap := p.Snapshot()
+
+	snap.Error = runErr.Error()
+	if ctx.Err() == context.DeadlineExceeded {
+		snap.Error = ErrRunTimeout.Error()
+	}
+
+	entry := logrus.WithField("username", p.userName).WithField("dir", p.snapshotDir)
+
+	if err := os.MkdirAll(p.snapshotDir, 0700); err != nil {
+		entry.WithError(err).Errorln("保存窗口快照失败")
+		return
+	}
+
+	filename := filepath.Join(p.snapshotDir, p.userName+"-"+snap.Time.Format("20060102T150405.000")+".json")
+
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		entry.WithError(err).Errorln("保存窗口快照失败")
+		return
+	}
+
+	if _, err = snap.WriteTo(f); err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+
+	if err != nil {
+		entry.WithError(err).Errorln("保存窗口快照失败")
+		return
+	}
+
+	entry.WithField("file", filename).WithField("windows", len(snap.Windows)).Infoln("已保存窗口快照")
+
+	p.pruneSnapshots()
+}
+
+func (p *Robot) pruneSnapshots() {
+	files, err := ioutil.ReadDir(p.snapshotDir)
+	if err != nil {
+		return
+	}
+
+	var names []string
+	for _, fi := range files {
+		name := fi.Name()
+		if !fi.IsDir() && strings.HasPrefix(name, p.userName+"-") && len(name) == len(p.userName)+len("-20060102T150405.000.json") {
+			names = append(names, name)
+		}
+	}
+
+	// 文件名中的时间可以按字符串排序
+	sort.Strings(names)
+
+	for i := 0; i < len(names)-p.snapshotKeep; i++ {
+		os.Remove(filepath.Join(p.snapshotDir, names[i]))
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/gogap/cmb_robot/supervisor"
+	"github.com/sirupsen/logrus"
+)
+
+// 进程退出码
+const (
+	exitOK        = 0
+	exitError     = 1 // 启动失败，如配置文件错误
+	exitLockedOut = 2 // 有账号因密码错误等致命错误停止了监控
+	exitAborted   = 3 // 退出时正在进行的恢复未能在超时内结束，已被中止
+)
+
+const (
+	defaultShutdownTimeout = 30 * time.Second
+
+	// 中止恢复后等待机器人退出的时间，机器人在下一次等待界面时就会返回
+	abortTimeout = 10 * time.Second
+)
+
+// wait 等待退出信号，返回退出码。账号因致命错误全部停止监控时不退出，
+// 修改配置并重新加载后重新开始监控。
+// 收到信号后不再开始新的检查，正在进行的登录可以在 timeout 内完成，
+// 超时或再次收到信号时中止
+func (p *accountManager) wait(sig <-chan os.Signal, timeout time.Duration) int {
+	s := <-sig
+	logrus.WithField("signal", s).Infoln("收到退出信号，不再开始新的检查")
+
+	// 先停止重新加载，之后只有当前 goroutine 访问 workers，也不会再启动机器人
+	close(p.quit)
+	<-p.watchDone
+
+	if p.stopLogStream != nil {
+		p.stopLogStream()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	for _, w := range p.workers {
+		w.sup.Stop()
+
+		if w.sup.State() == supervisor.StateRecovering {
+			logrus.WithField("username", w.userName).WithField("timeout", timeout).Warnln("机器人正在执行恢复，等待其结束")
+		}
+	}
+
+	select {
+	case <-done:
+		return p.exitCode()
+	case <-time.After(timeout):
+		logrus.WithField("timeout", timeout).Warnln("等待超时，中止正在进行的恢复")
+	case s := <-sig:
+		logrus.WithField("signal", s).Warnln("再次收到退出信号，中止正在进行的恢复")
+	}
+
+	for _, w := range p.workers {
+		w.cancel()
+	}
+
+	select {
+	case <-done:
+	case <-time.After(abortTimeout):
+		logrus.Errorln("机器人未能中止，强制退出")
+	}
+
+	return exitAborted
+}
+
+func (p *accountManager) exitCode() int {
+	for _, w := range p.workers {
+		if w.lockedOut {
+			return exitLockedOut
+		}
+	}
+	return exitOK
+}
+
+// exit 执行通过 logrus.RegisterExitHandler 注册的退出处理，同步日志文件后退出
+func exit(code int) {
+	logrus.RegisterExitHandler(flushLogs)
+
+	logrus.Exit(code)
+}
+
+// flushLogs 同步日志输出，并同步、关闭 log.conf 中配置的写文件等 hook。
+// 同一个 hook 注册在多个级别下，只处理一次
+func flushLogs() {
+	logger := logrus.StandardLogger()
+
+	if f, ok := logger.Out.(interface{ Sync() error }); ok {
+		f.Sync()
+	}
+
+	done := map[logrus.Hook]bool{}
+
+	for _, hooks := range logger.Hooks {
+		for _, hook := range hooks {
+			if reflect.TypeOf(hook).Comparable() {
+				if done[hook] {
+					continue
+				}
+				done[hook] = true
+			}
+
+			if h, ok := hook.(interface{ Sync() error }); ok {
+				h.Sync()
+			}
+
+			if h, ok := hook.(io.Closer); ok {
+				h.Close()
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package supervisor
+
+import (
+	"time"
+)
+
+type State int
+
+const (
+	StateHealthy    State = iota // 探测正常
+	StateFlapping                // 探测失败，但未达到阈值
+	StateRecovering              // 正在执行重新监听/重新登录
+	StateRestarting              // 上次恢复失败，下次恢复将重启进程
+	StateLockedOut               // 密码错误等致命错误，停止恢复
+	StateWaiting                 // 招行后台等外部故障，只告警，等待对方恢复
+)
+
+func (p State) String() string {
+	switch p {
+	case StateHealthy:
+		return "Healthy"
+	case StateFlapping:
+		return "Flapping"
+	case StateRecovering:
+		return "Recovering"
+	case StateRestarting:
+		return "Restarting"
+	case StateLockedOut:
+		return "LockedOut"
+	case StateWaiting:
+		return "Waiting"
+	}
+	return "Unknown"
+}
+
+// Mode 恢复动作，取值与 robot.RunMode 一致
+type Mode int
+
+const (
+	ModeNone     Mode = 0 // 不执行恢复
+	ModeRestart  Mode = 1
+	ModeReListen Mode = 2
+	ModeReLogin  Mode = 4
+
+	ModeFull = ModeRestart | ModeReListen | ModeReLogin
+)
+
+type Event struct {
+	From     State
+	To       State
+	Mode     Mode  // 进入 Recovering 时的恢复动作
+	Failures int   // 连续探测失败次数
+	Err      error // 导致状态变化的错误
+	Time     time.Time
+}
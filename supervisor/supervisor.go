@@ -0,0 +1,282 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrStopped   = errors.New("supervisor stopped")
+	ErrLockedOut = errors.New("supervisor locked out")
+)
+
+// Probe 检查业务是否正常，如 monitor.CMBMonitor
+type Probe interface {
+	PingContext(ctx context.Context) error
+}
+
+// Remediator 执行恢复动作，如 robot.Robot，ctx 被取消时应尽快返回
+type Remediator interface {
+	Remediate(ctx context.Context, mode Mode) error
+}
+
+type RemediatorFunc func(ctx context.Context, mode Mode) error
+
+func (p RemediatorFunc) Remediate(ctx context.Context, mode Mode) error {
+	return p(ctx, mode)
+}
+
+type Options struct {
+	MaxPingFailures  int           // 连续失败多少次后开始恢复
+	HealthyInterval  time.Duration // 探测正常时的间隔
+	FailureBackoff   time.Duration // 探测失败后的等待
+	FlappingInterval time.Duration // 抖动期间的探测间隔
+	RecoveryCooldown time.Duration // 每次恢复后的冷却时间
+
+	// IsFatal 判断恢复错误是否需要停止恢复，如密码错误
+	IsFatal func(err error) bool
+
+	// Classify 根据探测错误选择恢复动作，返回 ModeNone 表示只告警、等待对方恢复。
+	// 为空时总是重新监听并重新登录
+	Classify func(err error) Mode
+
+	Clock    Clock
+	Listener func(Event)
+}
+
+func DefaultOptions() Options {
+	return Options{
+		MaxPingFailures:  3,
+		HealthyInterval:  time.Second,
+		FailureBackoff:   time.Second * 10,
+		FlappingInterval: time.Second,
+		RecoveryCooldown: time.Second * 30,
+		Clock:            RealClock,
+	}
+}
+
+type Supervisor struct {
+	opts Options
+
+	probe      Probe
+	remediator Remediator
+
+	mu           sync.Mutex
+	pendingProbe Probe
+	pendingRem   Remediator
+
+	state    State
+	failures int
+	mode     Mode
+	escalate bool // 上次恢复失败，下次恢复时重启进程
+
+	stopping chan struct{}
+	stopOnce sync.Once
+}
+
+func New(probe Probe, remediator Remediator, opts Options) *Supervisor {
+	def := DefaultOptions()
+
+	if opts.MaxPingFailures <= 0 {
+		opts.MaxPingFailures = def.MaxPingFailures
+	}
+
+	if opts.Clock == nil {
+		opts.Clock = def.Clock
+	}
+
+	return &Supervisor{
+		opts:       opts,
+		probe:      probe,
+		remediator: remediator,
+		state:      StateHealthy,
+		stopping:   make(chan struct{}),
+	}
+}
+
+func (p *Supervisor) State() State {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state
+}
+
+// Swap 替换探测与恢复的实现，在下一次检查开始前生效
+func (p *Supervisor) Swap(probe Probe, remediator Remediator) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pendingProbe = probe
+	p.pendingRem = remediator
+}
+
+// Run 循环检查直到 stop 被关闭或进入 LockedOut 状态，stop 被关闭时会中断正在进行的探测和恢复
+func (p *Supervisor) Run(stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return p.RunContext(ctx)
+}
+
+// RunContext 循环检查直到 ctx 结束、调用了 Stop 或进入 LockedOut 状态
+func (p *Supervisor) RunContext(ctx context.Context) error {
+	for {
+		select {
+		case <-p.stopping:
+			return ErrStopped
+		default:
+		}
+
+		p.applyPending()
+
+		wait, _ := p.Step(ctx)
+
+		if p.State() == StateLockedOut {
+			return ErrLockedOut
+		}
+
+		select {
+		case <-ctx.Done():
+			return ErrStopped
+		case <-p.stopping:
+			return ErrStopped
+		case <-p.opts.Clock.After(wait):
+		}
+	}
+}
+
+// Stop 不再开始新的检查，正在进行的检查和恢复不会被打断，结束后 RunContext 返回 ErrStopped。
+// 需要中断正在进行的恢复时取消传给 RunContext 的 ctx
+func (p *Supervisor) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.stopping)
+	})
+}
+
+// Step 执行一次检查，必要时执行恢复，返回下一次检查前需要等待的时间。
+// ctx 被取消导致的失败不计入失败次数，也不改变状态
+func (p *Supervisor) Step(ctx context.Context) (wait time.Duration, err error) {
+	if p.State() == StateLockedOut {
+		err = ErrLockedOut
+		return
+	}
+
+	if err = p.probe.PingContext(ctx); err == nil {
+		if p.State() != StateHealthy {
+			p.transition(StateHealthy, nil)
+		}
+		p.failures = 0
+		wait = p.opts.HealthyInterval
+		return
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	mode := p.classify(err)
+
+	if mode == ModeNone {
+		if p.State() != StateWaiting {
+			p.transition(StateWaiting, err)
+		}
+		p.failures = 0
+		wait = p.opts.FailureBackoff
+		return
+	}
+
+	p.failures++
+
+	if p.failures < p.opts.MaxPingFailures {
+		if p.failures == 1 {
+			p.transition(StateFlapping, err)
+		}
+		wait = p.opts.FailureBackoff + p.opts.FlappingInterval
+		return
+	}
+
+	if p.escalate {
+		mode = ModeFull
+	}
+
+	p.mode = mode
+	p.transition(StateRecovering, err)
+
+	err = p.remediator.Remediate(ctx, mode)
+
+	p.failures = 0
+	wait = p.opts.RecoveryCooldown
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err != nil {
+		if p.opts.IsFatal != nil && p.opts.IsFatal(err) {
+			p.transition(StateLockedOut, err)
+			return
+		}
+
+		// 恢复失败，下次恢复时重启进程
+		p.escalate = true
+		p.mode = ModeFull
+		p.transition(StateRestarting, err)
+		return
+	}
+
+	p.escalate = false
+	p.transition(StateHealthy, nil)
+
+	return
+}
+
+func (p *Supervisor) classify(err error) Mode {
+	if p.opts.Classify == nil {
+		return ModeReListen | ModeReLogin
+	}
+	return p.opts.Classify(err)
+}
+
+func (p *Supervisor) applyPending() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pendingProbe != nil {
+		p.probe = p.pendingProbe
+		p.pendingProbe = nil
+	}
+
+	if p.pendingRem != nil {
+		p.remediator = p.pendingRem
+		p.pendingRem = nil
+	}
+}
+
+func (p *Supervisor) transition(to State, err error) {
+	p.mu.Lock()
+	from := p.state
+	p.state = to
+	p.mu.Unlock()
+
+	if p.opts.Listener == nil {
+		return
+	}
+
+	p.opts.Listener(Event{
+		From:     from,
+		To:       to,
+		Mode:     p.mode,
+		Failures: p.failures,
+		Err:      err,
+		Time:     p.opts.Clock.Now(),
+	})
+}
@@ -0,0 +1,350 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var (
+	errPing  = errors.New("ping failed")
+	errBank  = errors.New("bank is down")
+	errFix   = errors.New("remediation failed")
+	errFatal = errors.New("wrong password")
+)
+
+// fakeClock 每次 After 立即把时间推进 d，并记录等待的时长
+type fakeClock struct {
+	now   time.Time
+	waits []time.Duration
+}
+
+func (p *fakeClock) Now() time.Time {
+	return p.now
+}
+
+func (p *fakeClock) After(d time.Duration) <-chan time.Time {
+	p.now = p.now.Add(d)
+	p.waits = append(p.waits, d)
+
+	ch := make(chan time.Time, 1)
+	ch <- p.now
+	return ch
+}
+
+// script 依次返回 errs 中的错误，用完后返回 nil
+type script struct {
+	errs  []error
+	calls int
+	modes []Mode
+}
+
+func (p *script) next() (err error) {
+	if p.calls < len(p.errs) {
+		err = p.errs[p.calls]
+	}
+	p.calls++
+	return
+}
+
+func (p *script) PingContext(ctx context.Context) error {
+	return p.next()
+}
+
+func (p *script) Remediate(ctx context.Context, mode Mode) error {
+	p.modes = append(p.modes, mode)
+	return p.next()
+}
+
+type transition struct {
+	From, To State
+	Mode     Mode
+}
+
+func newTestSupervisor(pings, fixes []error) (sup *Supervisor, probe, rem *script, clock *fakeClock, events *[]Event) {
+	probe = &script{errs: pings}
+	rem = &script{errs: fixes}
+	clock = &fakeClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	events = &[]Event{}
+
+	opts := DefaultOptions()
+	opts.Clock = clock
+	opts.IsFatal = func(err error) bool { return err == errFatal }
+	opts.Classify = func(err error) Mode {
+		if err == errBank {
+			return ModeNone
+		}
+		return ModeReListen | ModeReLogin
+	}
+	opts.Listener = func(e Event) { *events = append(*events, e) }
+
+	sup = New(probe, rem, opts)
+	return
+}
+
+func TestStep(t *testing.T) {
+	opts := DefaultOptions()
+
+	tests := []struct {
+		name  string
+		pings []error
+		fixes []error
+		steps int
+
+		want      []transition
+		wantModes []Mode
+		wantState State
+		wantWait  time.Duration
+	}{
+		{
+			name:      "healthy",
+			steps:     3,
+			wantState: StateHealthy,
+			wantWait:  opts.HealthyInterval,
+		},
+		{
+			name:  "flapping then healthy",
+			pings: []error{errPing, errPing},
+			steps: 3,
+			want: []transition{
+				{StateHealthy, StateFlapping, ModeNone},
+				{StateFlapping, StateHealthy, ModeNone},
+			},
+			wantState: StateHealthy,
+			wantWait:  opts.HealthyInterval,
+		},
+		{
+			name:  "recovered",
+			pings: []error{errPing, errPing, errPing},
+			steps: 3,
+			want: []transition{
+				{StateHealthy, StateFlapping, ModeNone},
+				{StateFlapping, StateRecovering, ModeReListen | ModeReLogin},
+				{StateRecovering, StateHealthy, ModeReListen | ModeReLogin},
+			},
+			wantModes: []Mode{ModeReListen | ModeReLogin},
+			wantState: StateHealthy,
+			wantWait:  opts.RecoveryCooldown,
+		},
+		{
+			name:  "failed recovery escalates to restart",
+			pings: []error{errPing, errPing, errPing, errPing, errPing, errPing},
+			fixes: []error{errFix},
+			steps: 6,
+			want: []transition{
+				{StateHealthy, StateFlapping, ModeNone},
+				{StateFlapping, StateRecovering, ModeReListen | ModeReLogin},
+				{StateRecovering, StateRestarting, ModeFull},
+				{StateRestarting, StateFlapping, ModeFull},
+				{StateFlapping, StateRecovering, ModeFull},
+				{StateRecovering, StateHealthy, ModeFull},
+			},
+			wantModes: []Mode{ModeReListen | ModeReLogin, ModeFull},
+			wantState: StateHealthy,
+			wantWait:  opts.RecoveryCooldown,
+		},
+		{
+			name:  "escalation is cleared after a successful recovery",
+			pings: []error{errPing, errPing, errPing, errPing, errPing, errPing, nil, errPing, errPing, errPing},
+			fixes: []error{errFix},
+			steps: 10,
+			want: []transition{
+				{StateHealthy, StateFlapping, ModeNone},
+				{StateFlapping, StateRecovering, ModeReListen | ModeReLogin},
+				{StateRecovering, StateRestarting, ModeFull},
+				{StateRestarting, StateFlapping, ModeFull},
+				{StateFlapping, StateRecovering, ModeFull},
+				{StateRecovering, StateHealthy, ModeFull},
+				{StateHealthy, StateFlapping, ModeFull},
+				{StateFlapping, StateRecovering, ModeReListen | ModeReLogin},
+				{StateRecovering, StateHealthy, ModeReListen | ModeReLogin},
+			},
+			wantModes: []Mode{ModeReListen | ModeReLogin, ModeFull, ModeReListen | ModeReLogin},
+			wantState: StateHealthy,
+			wantWait:  opts.RecoveryCooldown,
+		},
+		{
+			name:  "fatal error locks out",
+			pings: []error{errPing, errPing, errPing},
+			fixes: []error{errFatal},
+			steps: 4,
+			want: []transition{
+				{StateHealthy, StateFlapping, ModeNone},
+				{StateFlapping, StateRecovering, ModeReListen | ModeReLogin},
+				{StateRecovering, StateLockedOut, ModeReListen | ModeReLogin},
+			},
+			wantModes: []Mode{ModeReListen | ModeReLogin},
+			wantState: StateLockedOut,
+		},
+		{
+			name:  "external failure waits without recovery",
+			pings: []error{errBank, errBank, errBank, errBank},
+			steps: 5,
+			want: []transition{
+				{StateHealthy, StateWaiting, ModeNone},
+				{StateWaiting, StateHealthy, ModeNone},
+			},
+			wantState: StateHealthy,
+			wantWait:  opts.HealthyInterval,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sup, _, rem, _, events := newTestSupervisor(tt.pings, tt.fixes)
+
+			var wait time.Duration
+			for i := 0; i < tt.steps; i++ {
+				wait, _ = sup.Step(context.Background())
+			}
+
+			var got []transition
+			for _, e := range *events {
+				got = append(got, transition{e.From, e.To, e.Mode})
+			}
+
+			if !equalTransitions(got, tt.want) {
+				t.Errorf("transitions = %v, want %v", got, tt.want)
+			}
+
+			if !equalModes(rem.modes, tt.wantModes) {
+				t.Errorf("remediation modes = %v, want %v", rem.modes, tt.wantModes)
+			}
+
+			if s := sup.State(); s != tt.wantState {
+				t.Errorf("state = %v, want %v", s, tt.wantState)
+			}
+
+			if wait != tt.wantWait {
+				t.Errorf("wait = %v, want %v", wait, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestStepEventDetails(t *testing.T) {
+	sup, _, _, clock, events := newTestSupervisor([]error{errPing, errPing, errPing}, []error{errFix})
+
+	for i := 0; i < 3; i++ {
+		sup.Step(context.Background())
+	}
+
+	if len(*events) != 3 {
+		t.Fatalf("got %d events, want 3", len(*events))
+	}
+
+	flapping, recovering, restarting := (*events)[0], (*events)[1], (*events)[2]
+
+	if flapping.Failures != 1 || flapping.Err != errPing {
+		t.Errorf("flapping event = %+v", flapping)
+	}
+
+	if recovering.Failures != 3 || recovering.Err != errPing {
+		t.Errorf("recovering event = %+v", recovering)
+	}
+
+	if restarting.Err != errFix || restarting.Mode != ModeFull {
+		t.Errorf("restarting event = %+v", restarting)
+	}
+
+	for _, e := range *events {
+		if !e.Time.Equal(clock.now) {
+			t.Errorf("event time = %v, want %v", e.Time, clock.now)
+		}
+	}
+}
+
+func TestStepCanceled(t *testing.T) {
+	sup, _, rem, _, events := newTestSupervisor([]error{errPing, errPing, errPing, errPing}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for i := 0; i < 4; i++ {
+		sup.Step(ctx)
+	}
+
+	if len(*events) != 0 || len(rem.modes) != 0 {
+		t.Errorf("canceled steps changed state: events %v, remediations %v", *events, rem.modes)
+	}
+}
+
+func TestRunCooldown(t *testing.T) {
+	sup, _, _, clock, _ := newTestSupervisor([]error{errPing, errPing, errPing}, []error{errFatal})
+
+	if err := sup.RunContext(context.Background()); err != ErrLockedOut {
+		t.Fatalf("RunContext = %v, want %v", err, ErrLockedOut)
+	}
+
+	opts := DefaultOptions()
+	want := []time.Duration{
+		opts.FailureBackoff + opts.FlappingInterval,
+		opts.FailureBackoff + opts.FlappingInterval,
+	}
+
+	if len(clock.waits) != len(want) {
+		t.Fatalf("waits = %v, want %v", clock.waits, want)
+	}
+	for i := range want {
+		if clock.waits[i] != want[i] {
+			t.Errorf("waits = %v, want %v", clock.waits, want)
+		}
+	}
+}
+
+func TestRunCooldownAfterRecovery(t *testing.T) {
+	sup, _, _, clock, events := newTestSupervisor([]error{errPing, errPing, errPing}, nil)
+
+	sup.opts.Listener = func(e Event) {
+		*events = append(*events, e)
+		if e.To == StateHealthy {
+			sup.Stop()
+		}
+	}
+
+	if err := sup.RunContext(context.Background()); err != ErrStopped {
+		t.Fatalf("RunContext = %v, want %v", err, ErrStopped)
+	}
+
+	if n := len(clock.waits); n == 0 || clock.waits[n-1] != DefaultOptions().RecoveryCooldown {
+		t.Errorf("waits = %v, want cooldown %v last", clock.waits, DefaultOptions().RecoveryCooldown)
+	}
+}
+
+func TestSwap(t *testing.T) {
+	sup, _, _, _, _ := newTestSupervisor(nil, nil)
+
+	next := &script{errs: []error{errPing}}
+	sup.Swap(next, nil)
+	sup.applyPending()
+	sup.Step(context.Background())
+
+	if next.calls != 1 {
+		t.Errorf("swapped probe called %d times, want 1", next.calls)
+	}
+}
+
+func equalTransitions(a, b []transition) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalModes(a, b []Mode) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/go-akka/configuration"
+	"github.com/gogap/cmb_robot/config"
+	"github.com/gogap/cmb_robot/robot"
+)
+
+func runEncrypt(args []string) (err error) {
+	fs := newFlagSet("encrypt")
+	in := fs.String("in", "", "plaintext config file")
+	out := fs.String("out", "", "encrypted config file")
+	force := fs.Bool("force", false, "overwrite output file")
+
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	if len(*in) == 0 {
+		return ErrMissingInput
+	}
+
+	if len(*out) == 0 {
+		return ErrMissingOutput
+	}
+
+	if sameFile(*in, *out) {
+		return ErrSameInputAndOutput
+	}
+
+	data, err := ioutil.ReadFile(*in)
+	if err != nil {
+		return
+	}
+
+	defer wipe(data)
+
+	if _, err = config.Parse(data); err != nil {
+		return
+	}
+
+	password, err := readNewPassword()
+	if err != nil {
+		return
+	}
+
+	defer wipe(password)
+
+	encrypted, err := config.Encrypt(password, data)
+	if err != nil {
+		return
+	}
+
+	if err = writeFile(*out, encrypted, *force); err != nil {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "已加密到 %s，请删除明文文件 %s\n", *out, *in)
+
+	return
+}
+
+func runDecrypt(args []string) (err error) {
+	fs := newFlagSet("decrypt")
+	in := fs.String("in", "", "encrypted config file")
+	out := fs.String("out", "", "plaintext config file")
+	force := fs.Bool("force", false, "overwrite output file")
+
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	if len(*in) == 0 {
+		return ErrMissingInput
+	}
+
+	if len(*out) == 0 {
+		return ErrMissingOutput
+	}
+
+	if sameFile(*in, *out) {
+		return ErrSameInputAndOutput
+	}
+
+	plaintext, _, err := decryptFile(*in)
+	if err != nil {
+		return
+	}
+
+	defer wipe(plaintext)
+
+	if err = writeFile(*out, plaintext, *force); err != nil {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "已解密到 %s，该文件包含明文密码，使用后请立即删除\n", *out)
+
+	return
+}
+
+func runRotatePassword(args []string) (err error) {
+	fs := newFlagSet("rotate-password")
+	in := fs.String("in", "", "encrypted config file")
+	out := fs.String("out", "", "new encrypted config file, defaults to -in")
+
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	if len(*in) == 0 {
+		return ErrMissingInput
+	}
+
+	if len(*out) == 0 {
+		*out = *in
+	}
+
+	plaintext, _, err := decryptFile(*in)
+	if err != nil {
+		return
+	}
+
+	defer wipe(plaintext)
+
+	password, err := readNewPassword()
+	if err != nil {
+		return
+	}
+
+	defer wipe(password)
+
+	encrypted, err := config.Encrypt(password, plaintext)
+	if err != nil {
+		return
+	}
+
+	if err = writeFile(*out, encrypted, true); err != nil {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "已使用新密码重新加密到 %s\n", *out)
+
+	return
+}
+
+func runValidate(args []string) (err error) {
+	fs := newFlagSet("validate")
+	in := fs.String("in", "", "encrypted config file")
+
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	if len(*in) == 0 {
+		return ErrMissingInput
+	}
+
+	plaintext, format, err := decryptFile(*in)
+	if err != nil {
+		return
+	}
+
+	defer wipe(plaintext)
+
+	conf, err := config.Parse(plaintext)
+	if err != nil {
+		return
+	}
+
+	if e := config.New(conf).Validate(); e != nil {
+		errs, ok := e.(config.Errors)
+		if !ok {
+			errs = config.Errors{e}
+		}
+
+		for _, fe := range errs {
+			fmt.Fprintf(os.Stdout, "%s: %s\n", *in, fe)
+		}
+
+		return fmt.Errorf("found %d config problem(s)", len(errs))
+	}
+
+	fmt.Fprintf(os.Stdout, "%s: OK (%s)\n", *in, format)
+
+	return
+}
+
+func decryptFile(filename string) (plaintext []byte, format config.Format, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+
+	password, err := readPassword("请输入配置文件密码:")
+	if err != nil {
+		return
+	}
+
+	defer wipe(password)
+
+	plaintext, format, err = config.Decrypt(password, data)
+	if err != nil {
+		return
+	}
+
+	if format == config.FormatLegacyRC4 {
+		// 旧格式没有完整性校验，只能通过能否解析来判断密码是否正确
+		if _, e := config.Parse(plaintext); e != nil {
+			wipe(plaintext)
+			plaintext = nil
+			err = config.ErrWrongPassword
+			return
+		}
+
+		fmt.Fprintln(os.Stderr, "警告: 配置文件为旧的RC4加密格式，请使用 cmbctl rotate-password 迁移")
+	}
+
+	return
+}
+
+// runSnapshot 在运行 FBSdk 的机器上输出当前窗口树，与机器人恢复失败时保存的快照格式相同
+func runSnapshot(args []string) (err error) {
+	fs := newFlagSet("snapshot")
+	in := fs.String("in", "", "encrypted config file")
+	userName := fs.String("username", "", "account to use, defaults to the first account")
+	out := fs.String("out", "", "output file, defaults to stdout")
+	force := fs.Bool("force", false, "overwrite output file")
+
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	if len(*in) == 0 {
+		return ErrMissingInput
+	}
+
+	plaintext, _, err := decryptFile(*in)
+	if err != nil {
+		return
+	}
+
+	defer wipe(plaintext)
+
+	conf, err := config.Parse(plaintext)
+	if err != nil {
+		return
+	}
+
+	accConfs, err := config.AccountConfigs(conf)
+	if err != nil {
+		return
+	}
+
+	var accConf *configuration.Config
+	for _, c := range accConfs {
+		if len(*userName) == 0 || c.GetString("username") == *userName {
+			accConf = c
+			break
+		}
+	}
+
+	if accConf == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownAccount, *userName)
+	}
+
+	bot, err := robot.NewRobot(accConf)
+	if err != nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	if _, err = bot.Snapshot().WriteTo(&buf); err != nil {
+		return
+	}
+
+	if len(*out) == 0 {
+		_, err = os.Stdout.Write(buf.Bytes())
+		return
+	}
+
+	return writeFile(*out, buf.Bytes(), *force)
+}
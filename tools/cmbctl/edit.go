@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/gogap/cmb_robot/config"
+)
+
+var (
+	ErrConfigLocked = errors.New("config file is being edited by another process")
+)
+
+func runEdit(args []string) (err error) {
+	fs := newFlagSet("edit")
+	in := fs.String("in", "", "encrypted config file")
+
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+
+	if len(*in) == 0 {
+		return ErrMissingInput
+	}
+
+	unlock, err := lockFile(*in)
+	if err != nil {
+		return
+	}
+
+	defer unlock()
+
+	data, err := ioutil.ReadFile(*in)
+	if err != nil {
+		return
+	}
+
+	password, err := readPassword("请输入配置文件密码:")
+	if err != nil {
+		return
+	}
+
+	defer wipe(password)
+
+	plaintext, format, err := config.Decrypt(password, data)
+	if err != nil {
+		return
+	}
+
+	defer wipe(plaintext)
+
+	if format == config.FormatLegacyRC4 {
+		if _, err = config.Parse(plaintext); err != nil {
+			return config.ErrWrongPassword
+		}
+	}
+
+	// TempDir 创建的目录权限为0700，TempFile 创建的文件权限为0600
+	dir, err := ioutil.TempDir("", "cmbctl")
+	if err != nil {
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	tmpName := filepath.Join(dir, "cmb-robot.conf")
+
+	if err = ioutil.WriteFile(tmpName, plaintext, 0600); err != nil {
+		return
+	}
+
+	defer wipeFile(tmpName)
+
+	if err = launchEditor(tmpName); err != nil {
+		return
+	}
+
+	edited, err := ioutil.ReadFile(tmpName)
+	if err != nil {
+		return
+	}
+
+	defer wipe(edited)
+
+	if bytes.Equal(edited, plaintext) && format == config.FormatEnvelope {
+		fmt.Fprintln(os.Stderr, "配置文件未修改")
+		return
+	}
+
+	if _, err = config.Parse(edited); err != nil {
+		fmt.Fprintln(os.Stderr, "修改后的配置文件无法解析，原文件保持不变")
+		return
+	}
+
+	encrypted, err := config.Encrypt(password, edited)
+	if err != nil {
+		return
+	}
+
+	if err = writeFile(*in, encrypted, true); err != nil {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "已保存到 %s\n", *in)
+
+	return
+}
+
+func launchEditor(filename string) error {
+	editor := os.Getenv("EDITOR")
+	if len(editor) == 0 {
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		} else {
+			editor = "vi"
+		}
+	}
+
+	fields := strings.Fields(editor)
+
+	cmd := exec.Command(fields[0], append(fields[1:], filename)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// lockFile 在配置文件旁创建 .lock 文件，防止同时编辑
+func lockFile(filename string) (unlock func(), err error) {
+	lockName := filename + ".lock"
+
+	f, err := os.OpenFile(lockName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		if os.IsExist(err) {
+			err = ErrConfigLocked
+		}
+		return
+	}
+
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+	f.Close()
+
+	unlock = func() {
+		os.Remove(lockName)
+	}
+
+	return
+}
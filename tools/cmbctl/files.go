@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+func readPassword(prompt string) (password []byte, err error) {
+	fmt.Fprint(os.Stderr, prompt)
+
+	password, err = terminal.ReadPassword(int(syscall.Stdin))
+
+	fmt.Fprintln(os.Stderr)
+
+	return
+}
+
+func readNewPassword() (password []byte, err error) {
+	password, err = readPassword("请输入新的配置文件密码:")
+	if err != nil {
+		return
+	}
+
+	confirm, err := readPassword("请再次输入新的配置文件密码:")
+	if err != nil {
+		return
+	}
+
+	defer wipe(confirm)
+
+	if string(password) != string(confirm) {
+		wipe(password)
+		password = nil
+		err = ErrPasswordMismatch
+		return
+	}
+
+	return
+}
+
+// writeFile 先写入同目录下的临时文件再改名，TempFile 创建的文件权限为0600
+func writeFile(filename string, data []byte, force bool) (err error) {
+	if !force {
+		if _, e := os.Stat(filename); e == nil {
+			err = ErrOutputExists
+			return
+		}
+	}
+
+	dir := filepath.Dir(filename)
+
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(filename)+".")
+	if err != nil {
+		return
+	}
+
+	tmpName := tmp.Name()
+
+	defer func() {
+		if err != nil {
+			os.Remove(tmpName)
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return
+	}
+
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return
+	}
+
+	if err = tmp.Close(); err != nil {
+		return
+	}
+
+	return os.Rename(tmpName, filename)
+}
+
+// wipeFile 用0覆盖文件内容后删除
+func wipeFile(filename string) error {
+	if fi, err := os.Stat(filename); err == nil {
+		if f, err := os.OpenFile(filename, os.O_WRONLY, 0); err == nil {
+			f.Write(make([]byte, fi.Size()))
+			f.Sync()
+			f.Close()
+		}
+	}
+
+	return os.Remove(filename)
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+func sameFile(a, b string) bool {
+	fa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+
+	fb, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(fa, fb)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrMissingInput       = errors.New("input file is required (-in)")
+	ErrMissingOutput      = errors.New("output file is required (-out)")
+	ErrPasswordMismatch   = errors.New("passwords do not match")
+	ErrOutputExists       = errors.New("output file already exists, use -force to overwrite")
+	ErrSameInputAndOutput = errors.New("input and output must be different files")
+	ErrUnknownAccount     = errors.New("no account with this username")
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"encrypt":         {"encrypt -in plain.conf -out cmb-robot.conf", runEncrypt},
+	"decrypt":         {"decrypt -in cmb-robot.conf -out plain.conf", runDecrypt},
+	"edit":            {"edit -in cmb-robot.conf", runEdit},
+	"rotate-password": {"rotate-password -in cmb-robot.conf [-out new.conf]", runRotatePassword},
+	"validate":        {"validate -in cmb-robot.conf", runValidate},
+	"snapshot":        {"snapshot -in cmb-robot.conf [-username name] [-out snapshot.json]", runSnapshot},
+}
+
+func main() {
+	var err error
+	defer func() {
+		if err != nil {
+			logrus.Errorln(err)
+			os.Exit(1)
+		}
+	}()
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, exist := commands[os.Args[1]]
+	if !exist {
+		usage()
+		os.Exit(2)
+	}
+
+	err = cmd.run(os.Args[2:])
+}
+
+func usage() {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage: cmbctl <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "  cmbctl", commands[name].usage)
+	}
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("cmbctl "+name, flag.ContinueOnError)
+	return fs
+}
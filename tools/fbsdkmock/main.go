@@ -0,0 +1,186 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-akka/configuration"
+	"github.com/go-akka/configuration/hocon"
+	"github.com/gogap/cmb_robot/config"
+	"github.com/gogap/cmb_robot/fbsdkmock"
+	"github.com/gogap/cmb_robot/monitor/models"
+	"github.com/sirupsen/logrus"
+)
+
+// 数据文件示例:
+//
+//	{
+//		payments = [
+//			{ yurref: "SN0001", reqnbr: "0012345678", date: "20170424", amount: 0.01, reqsts: "FIN", rtnflg: "S" }
+//		]
+//		balances = [
+//			{ bbknbr: 75, accnbr: "755900000000001", available: 1000.00, online: 1000.00, frozen: 0, yesterday: 1000.00 }
+//		]
+//		transactions = [
+//			{ bbknbr: 75, accnbr: "755900000000001", date: "20170424", time: "103000", cdr: "C", amount: "100.00", balance: "1000.00", refnbr: "K0001", nartxt: "货款" }
+//		]
+//	}
+func main() {
+	var err error
+	defer func() {
+		if err != nil {
+			logrus.Errorln(err)
+		}
+	}()
+
+	listen := flag.String("listen", "127.0.0.1:8080", "listen address")
+	data := flag.String("data", "", "HOCON file with payments, balances and transactions")
+	pageSize := flag.Int("page-size", 0, "max GetTransInfo records per response, 0 for no paging")
+	scenarios := flag.String("scenario", "", "comma separated: not-logged-in, signature-error, timeout, drop, wrong-count")
+	delay := flag.Duration("delay", 0, "response delay, used by the timeout scenario (default 60s)")
+
+	flag.Parse()
+
+	srv := fbsdkmock.New()
+	srv.SetPageSize(*pageSize)
+
+	if len(*data) > 0 {
+		if err = loadData(srv, *data); err != nil {
+			return
+		}
+	}
+
+	scenario := fbsdkmock.Scenario{Delay: *delay}
+
+	for _, name := range strings.Split(*scenarios, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "not-logged-in":
+			scenario.NotLoggedIn = true
+		case "signature-error":
+			scenario.SignatureError = true
+		case "timeout":
+			if scenario.Delay == 0 {
+				scenario.Delay = time.Minute
+			}
+		case "drop":
+			scenario.Drop = true
+		case "wrong-count":
+			scenario.ExtraRecords = 1
+		default:
+			err = fmt.Errorf("unknown scenario: %s", name)
+			return
+		}
+	}
+
+	srv.SetScenario(scenario)
+
+	logrus.WithField("listen", *listen).WithField("scenario", *scenarios).Infoln("FBSdk模拟服务已启动")
+
+	err = http.ListenAndServe(*listen, srv)
+}
+
+func loadData(srv *fbsdkmock.Server, filename string) (err error) {
+	text, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+
+	conf, err := config.Parse(text)
+	if err != nil {
+		return
+	}
+
+	for _, v := range arrayOf(conf, "payments") {
+		var amount models.Amount
+		if amount, err = amountOf(v, "amount"); err != nil {
+			return
+		}
+
+		srv.AddPayment(models.RespGetPaymentInfoListItem{
+			YURREF: v.GetString("yurref"),
+			REQNBR: v.GetString("reqnbr"),
+			OPRDAT: v.GetString("date"),
+			TRSAMT: amount,
+			REQSTS: v.GetString("reqsts", "FIN"),
+			RTNFLG: v.GetString("rtnflg", "S"),
+			RTNNAR: v.GetString("rtnnar"),
+			CRTACC: v.GetString("crtacc"),
+			CRTNAM: v.GetString("crtnam"),
+		})
+	}
+
+	for _, v := range arrayOf(conf, "balances") {
+		b := fbsdkmock.Balance{
+			BBKNBR: int(v.GetInt32("bbknbr")),
+			ACCNBR: v.GetString("accnbr"),
+		}
+
+		for key, field := range map[string]*models.Amount{
+			"available": &b.AVLBLV,
+			"online":    &b.ONLBLV,
+			"frozen":    &b.HLDBLV,
+			"yesterday": &b.ACCBLV,
+		} {
+			if *field, err = amountOf(v, key); err != nil {
+				return
+			}
+		}
+
+		srv.SetBalance(b)
+	}
+
+	for _, v := range arrayOf(conf, "transactions") {
+		item := models.RespGetTransInfoItem{
+			ETYDAT: v.GetString("date"),
+			ETYTIM: v.GetString("time"),
+			VLTDAT: v.GetString("date"),
+			AMTCDR: v.GetString("cdr", "C"),
+			REFNBR: v.GetString("refnbr"),
+			NARTXT: v.GetString("nartxt"),
+			YURREF: v.GetString("yurref"),
+			RPYACC: v.GetString("rpyacc"),
+			RPYNAM: v.GetString("rpynam"),
+		}
+
+		if item.TRSAMT, err = amountOf(v, "amount"); err != nil {
+			return
+		}
+
+		if item.TRSBLV, err = amountOf(v, "balance"); err != nil {
+			return
+		}
+
+		srv.AddTransaction(int(v.GetInt32("bbknbr")), v.GetString("accnbr"), item)
+	}
+
+	return
+}
+
+// amountOf 按字符串读取金额，避免经过浮点数
+func amountOf(conf *configuration.Config, key string) (amount models.Amount, err error) {
+	amount, err = models.ParseAmount(conf.GetString(key))
+	if err != nil {
+		err = fmt.Errorf("%s: %w", key, err)
+	}
+
+	return
+}
+
+func arrayOf(conf *configuration.Config, path string) (items []*configuration.Config) {
+	if !conf.IsArray(path) {
+		return
+	}
+
+	for _, v := range conf.GetValue(path).GetArray() {
+		if v.IsObject() {
+			items = append(items, configuration.NewConfigFromRoot(hocon.NewHoconRoot(v)))
+		}
+	}
+
+	return
+}
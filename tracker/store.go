@@ -0,0 +1,105 @@
+package tracker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store 保存正在跟踪的支付，进程重启后继续跟踪
+type Store interface {
+	Load() (entries []*Entry, err error)
+	Save(entries []*Entry) (err error)
+}
+
+// FileStore 以JSON保存到本地文件
+type FileStore struct {
+	filename string
+}
+
+func NewFileStore(filename string) *FileStore {
+	return &FileStore{filename: filename}
+}
+
+func (p *FileStore) Load() (entries []*Entry, err error) {
+	data, err := ioutil.ReadFile(p.filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(data, &entries)
+
+	return
+}
+
+func (p *FileStore) Save(entries []*Entry) (err error) {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return
+	}
+
+	return writeFile(p.filename, data)
+}
+
+// writeFile 先写入同目录下的临时文件再改名，避免写到一半时进程退出导致文件损坏
+func writeFile(filename string, data []byte) (err error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".")
+	if err != nil {
+		return
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return
+	}
+
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return
+	}
+
+	if err = tmp.Close(); err != nil {
+		return
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+// MemoryStore 不持久化，用于测试
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries []*Entry
+}
+
+func (p *MemoryStore) Load() (entries []*Entry, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, e := range p.entries {
+		copied := *e
+		entries = append(entries, &copied)
+	}
+
+	return
+}
+
+func (p *MemoryStore) Save(entries []*Entry) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.entries = nil
+	for _, e := range entries {
+		copied := *e
+		p.entries = append(p.entries, &copied)
+	}
+
+	return
+}
@@ -0,0 +1,433 @@
+// Package tracker 跟踪已提交的支付，批量查询 GetPaymentInfo 直到银行处理完毕，
+// 并将状态变化通知订阅者
+package tracker
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gogap/cmb_robot/cmbclient"
+	"github.com/gogap/cmb_robot/monitor/models"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrYURREFIsEmpty = errors.New("yurref is empty")
+)
+
+const dateLayout = "20060102"
+
+// Status 银行返回的支付状态
+type Status struct {
+	REQSTS string `json:"reqsts"`
+	RTNFLG string `json:"rtnflg"`
+	RTNNAR string `json:"rtnnar,omitempty"` // 失败原因/退票原因
+}
+
+// Final 银行已处理完毕。成功的支付之后仍可能退票
+func (p Status) Final() bool {
+	return p.REQSTS == "FIN"
+}
+
+// Succeeded 银行已处理完毕且成功
+func (p Status) Succeeded() bool {
+	return p.Final() && p.RTNFLG == "S"
+}
+
+// Entry 一笔正在跟踪的支付
+type Entry struct {
+	YURREF   string        `json:"yurref"`
+	Date     string        `json:"date"` // 提交日期 YYYYMMDD
+	Status   Status        `json:"status"`
+	Interval time.Duration `json:"interval"`
+	NextPoll time.Time     `json:"next_poll"`
+	Finished time.Time     `json:"finished"` // 支付成功的时间，之后继续跟踪 RefundWindow 检查退票
+}
+
+// Event 支付状态变化
+type Event struct {
+	YURREF  string    `json:"yurref"`
+	From    Status    `json:"from"`
+	To      Status    `json:"to"`
+	Final   bool      `json:"final"`
+	Refund  bool      `json:"refund,omitempty"`  // 成功后退票
+	Expired bool      `json:"expired,omitempty"` // 超过 MaxAge 仍未查询到最终状态，停止跟踪
+	Time    time.Time `json:"time"`
+}
+
+// Subscriber 接收状态变化，Publish 不能阻塞
+type Subscriber interface {
+	Publish(event Event)
+}
+
+type Options struct {
+	BatchDays    int           // 单次查询的最大日期跨度
+	MinInterval  time.Duration // 状态变化后的查询间隔
+	MaxInterval  time.Duration // 状态不变时间隔逐次翻倍，直到该值
+	PollInterval time.Duration // Run 检查是否有需要查询的支付的间隔
+	MaxAge       time.Duration // 提交后超过该时间仍未完成则停止跟踪
+	RefundWindow time.Duration // 支付成功后继续跟踪的时间，期间退票会通知订阅者
+
+	Clock Clock
+}
+
+func DefaultOptions() Options {
+	return Options{
+		BatchDays:    7,
+		MinInterval:  time.Second * 10,
+		MaxInterval:  time.Minute * 10,
+		PollInterval: time.Second * 5,
+		MaxAge:       time.Hour * 24 * 30,
+		RefundWindow: time.Hour * 24 * 7,
+		Clock:        RealClock,
+	}
+}
+
+type Tracker struct {
+	caller cmbclient.Caller
+	store  Store
+	opts   Options
+
+	mu          sync.Mutex
+	entries     map[string]*Entry
+	subscribers []Subscriber
+}
+
+// New 从 store 中恢复上次未完成的跟踪
+func New(caller cmbclient.Caller, store Store, opts Options) (tracker *Tracker, err error) {
+	def := DefaultOptions()
+
+	if opts.BatchDays <= 0 {
+		opts.BatchDays = def.BatchDays
+	}
+
+	if opts.MinInterval <= 0 {
+		opts.MinInterval = def.MinInterval
+	}
+
+	if opts.MaxInterval < opts.MinInterval {
+		opts.MaxInterval = opts.MinInterval
+	}
+
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = def.PollInterval
+	}
+
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = def.MaxAge
+	}
+
+	if opts.RefundWindow <= 0 {
+		opts.RefundWindow = def.RefundWindow
+	}
+
+	if opts.Clock == nil {
+		opts.Clock = def.Clock
+	}
+
+	if store == nil {
+		store = &MemoryStore{}
+	}
+
+	entries, err := store.Load()
+	if err != nil {
+		return
+	}
+
+	tracker = &Tracker{
+		caller:  caller,
+		store:   store,
+		opts:    opts,
+		entries: make(map[string]*Entry, len(entries)),
+	}
+
+	for _, e := range entries {
+		tracker.entries[e.YURREF] = e
+	}
+
+	return
+}
+
+// Track 开始跟踪一笔支付，date 为提交日期，重复调用不会重置已有的状态
+func (p *Tracker) Track(yurref string, date time.Time) (err error) {
+	if len(yurref) == 0 {
+		err = ErrYURREFIsEmpty
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, exist := p.entries[yurref]; exist {
+		return
+	}
+
+	p.entries[yurref] = &Entry{
+		YURREF:   yurref,
+		Date:     date.Format(dateLayout),
+		Interval: p.opts.MinInterval,
+		NextPoll: p.opts.Clock.Now(),
+	}
+
+	return p.saveLocked()
+}
+
+// Tracking 返回正在跟踪的支付数量
+func (p *Tracker) Tracking() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.entries)
+}
+
+func (p *Tracker) AddSubscriber(s Subscriber) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.subscribers = append(p.subscribers, s)
+}
+
+// Subscribe 返回接收状态变化的channel，channel 满时丢弃事件
+func (p *Tracker) Subscribe(size int) <-chan Event {
+	ch := make(chan Event, size)
+
+	p.AddSubscriber(chanSubscriber(ch))
+
+	return ch
+}
+
+type chanSubscriber chan Event
+
+func (p chanSubscriber) Publish(event Event) {
+	select {
+	case p <- event:
+	default:
+		logrus.WithField("yurref", event.YURREF).Warnln("支付状态订阅者处理太慢，丢弃事件")
+	}
+}
+
+// Run 定时查询，直到 ctx 结束，ctx 结束时会中断正在进行的查询
+func (p *Tracker) Run(ctx context.Context) error {
+	for {
+		if err := p.Poll(ctx); err != nil && ctx.Err() == nil {
+			logrus.WithError(err).Warnln("查询支付状态失败")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-p.opts.Clock.After(p.opts.PollInterval):
+		}
+	}
+}
+
+// Poll 对到期的支付按日期分批查询一次。先通知订阅者再保存，进程在两者之间退出时，
+// 重启后会再次通知同一个变化；Webhook 在 Publish 返回前已将通知写入 outbox，不会丢失
+func (p *Tracker) Poll(ctx context.Context) (err error) {
+	now := p.opts.Clock.Now()
+
+	due := p.due(now)
+	if len(due) == 0 {
+		return
+	}
+
+	var events []Event
+
+	for _, batch := range p.batches(due) {
+		found, e := p.query(ctx, batch[0].Date, batch[len(batch)-1].Date, now)
+		if e != nil && err == nil {
+			err = e
+		}
+
+		events = append(events, p.update(batch, found, e != nil, now)...)
+	}
+
+	p.mu.Lock()
+	subscribers := append([]Subscriber(nil), p.subscribers...)
+	p.mu.Unlock()
+
+	for _, event := range events {
+		entry := logrus.WithField("yurref", event.YURREF).
+			WithField("reqsts", event.To.REQSTS).
+			WithField("rtnflg", event.To.RTNFLG).
+			WithField("rtnnar", event.To.RTNNAR)
+
+		switch {
+		case event.Expired:
+			entry.Warnln("超过最长跟踪时间仍未完成，停止跟踪")
+		case event.Refund:
+			entry.Warnln("支付成功后退票")
+		default:
+			entry.Infoln("支付状态变化")
+		}
+
+		for _, s := range subscribers {
+			s.Publish(event)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e := p.saveLocked(); e != nil && err == nil {
+		err = e
+	}
+
+	return
+}
+
+// due 返回到期需要查询的支付，按提交日期排序
+func (p *Tracker) due(now time.Time) (due []Entry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, e := range p.entries {
+		if !e.NextPoll.After(now) {
+			due = append(due, *e)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].Date < due[j].Date
+	})
+
+	return
+}
+
+// batches 按提交日期分组，每组的日期跨度不超过 BatchDays
+func (p *Tracker) batches(due []Entry) (batches [][]Entry) {
+	var batch []Entry
+	var end string
+
+	for _, e := range due {
+		if len(batch) > 0 && e.Date > end {
+			batches = append(batches, batch)
+			batch = nil
+		}
+
+		if len(batch) == 0 {
+			begin, err := time.Parse(dateLayout, e.Date)
+			if err != nil {
+				end = e.Date
+			} else {
+				end = begin.AddDate(0, 0, p.opts.BatchDays-1).Format(dateLayout)
+			}
+		}
+
+		batch = append(batch, e)
+	}
+
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	return
+}
+
+func (p *Tracker) query(ctx context.Context, begin, end string, now time.Time) (found map[string]Status, err error) {
+	// 不能查询今天以后的日期
+	if today := now.Format(dateLayout); end > today {
+		end = today
+	}
+
+	req := &models.ReqGetPaymentInfo{
+		BUSCOD: cmbclient.BUSCODPayment,
+		BGNDAT: begin,
+		ENDDAT: end,
+	}
+
+	resp := models.RespGetPaymentInfo{}
+	if err = p.caller.Call(ctx, req, &resp); err != nil {
+		return
+	}
+
+	found = make(map[string]Status, len(resp.NTQPAYQYZ))
+	for _, item := range resp.NTQPAYQYZ {
+		found[item.YURREF] = Status{REQSTS: item.REQSTS, RTNFLG: item.RTNFLG, RTNNAR: item.RTNNAR}
+	}
+
+	return
+}
+
+// update 更新一组支付的状态和下次查询时间，返回发生的变化
+func (p *Tracker) update(batch []Entry, found map[string]Status, failed bool, now time.Time) (events []Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, due := range batch {
+		e, exist := p.entries[due.YURREF]
+		if !exist {
+			continue
+		}
+
+		status, ok := found[e.YURREF]
+
+		if !failed && ok && status != e.Status {
+			events = append(events, Event{
+				YURREF: e.YURREF,
+				From:   e.Status,
+				To:     status,
+				Final:  status.Final(),
+				Refund: e.Status.Succeeded() && status.RTNFLG == "B",
+				Time:   now,
+			})
+
+			e.Status = status
+			e.Interval = p.opts.MinInterval
+
+			if status.Succeeded() && e.Finished.IsZero() {
+				e.Finished = now
+			}
+		} else {
+			e.Interval *= 2
+			if e.Interval > p.opts.MaxInterval {
+				e.Interval = p.opts.MaxInterval
+			}
+		}
+
+		e.NextPoll = now.Add(e.Interval)
+
+		// 成功的支付在 RefundWindow 内继续跟踪，其他最终状态不会再变化
+		if e.Status.Succeeded() {
+			if now.Sub(e.Finished) > p.opts.RefundWindow {
+				delete(p.entries, e.YURREF)
+			}
+			continue
+		}
+
+		if e.Status.Final() {
+			delete(p.entries, e.YURREF)
+			continue
+		}
+
+		if date, err := time.ParseInLocation(dateLayout, e.Date, now.Location()); err == nil && now.Sub(date) > p.opts.MaxAge {
+			events = append(events, Event{
+				YURREF:  e.YURREF,
+				From:    e.Status,
+				To:      e.Status,
+				Expired: true,
+				Time:    now,
+			})
+
+			delete(p.entries, e.YURREF)
+		}
+	}
+
+	return
+}
+
+func (p *Tracker) saveLocked() error {
+	entries := make([]*Entry, 0, len(p.entries))
+	for _, e := range p.entries {
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].YURREF < entries[j].YURREF
+	})
+
+	return p.store.Save(entries)
+}
@@ -0,0 +1,379 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogap/cmb_robot/monitor/models"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (p *fakeClock) Now() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.now
+}
+
+func (p *fakeClock) Add(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.now = p.now.Add(d)
+}
+
+func (p *fakeClock) After(d time.Duration) <-chan time.Time {
+	p.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- p.Now()
+	return ch
+}
+
+// bank 模拟 GetPaymentInfo，返回 payments 中在查询日期范围内的支付
+type bank struct {
+	mu       sync.Mutex
+	payments map[string]models.RespGetPaymentInfoListItem
+	queries  [][2]string
+	err      error
+}
+
+func newBank() *bank {
+	return &bank{payments: make(map[string]models.RespGetPaymentInfoListItem)}
+}
+
+func (p *bank) set(yurref, date, reqsts, rtnflg, rtnnar string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.payments[yurref] = models.RespGetPaymentInfoListItem{YURREF: yurref, OPRDAT: date, REQSTS: reqsts, RTNFLG: rtnflg, RTNNAR: rtnnar}
+}
+
+func (p *bank) Call(ctx context.Context, req models.Request, resp models.Response) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if p.err != nil {
+		return p.err
+	}
+
+	r := req.(*models.ReqGetPaymentInfo)
+	p.queries = append(p.queries, [2]string{r.BGNDAT, r.ENDDAT})
+
+	out := resp.(*models.RespGetPaymentInfo)
+	for _, item := range p.payments {
+		if item.OPRDAT >= r.BGNDAT && item.OPRDAT <= r.ENDDAT {
+			out.NTQPAYQYZ = append(out.NTQPAYQYZ, item)
+		}
+	}
+
+	return nil
+}
+
+type recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (p *recorder) Publish(event Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, event)
+}
+
+func (p *recorder) take() (events []Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	events, p.events = p.events, nil
+	return
+}
+
+var day = time.Date(2024, 3, 10, 9, 0, 0, 0, time.Local)
+
+func newTestTracker(t *testing.T, store Store) (*Tracker, *bank, *fakeClock, *recorder) {
+	b := newBank()
+	clock := &fakeClock{now: day}
+
+	opts := DefaultOptions()
+	opts.Clock = clock
+
+	tr, err := New(b, store, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &recorder{}
+	tr.AddSubscriber(rec)
+
+	return tr, b, clock, rec
+}
+
+func TestTrackUntilFinal(t *testing.T) {
+	tr, b, clock, rec := newTestTracker(t, nil)
+	ctx := context.Background()
+
+	if err := tr.Track("", day); err != ErrYURREFIsEmpty {
+		t.Errorf("Track(\"\") = %v, want %v", err, ErrYURREFIsEmpty)
+	}
+
+	tr.Track("R1", day)
+	b.set("R1", "20240310", "BNK", "", "")
+
+	if err := tr.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	events := rec.take()
+	if len(events) != 1 || events[0].To.REQSTS != "BNK" || events[0].Final {
+		t.Fatalf("events = %+v", events)
+	}
+
+	b.set("R1", "20240310", "FIN", "F", "户名不符")
+	clock.Add(DefaultOptions().MinInterval)
+	tr.Poll(ctx)
+
+	events = rec.take()
+	if len(events) != 1 || !events[0].Final || events[0].To.RTNNAR != "户名不符" || events[0].From.REQSTS != "BNK" {
+		t.Fatalf("events = %+v", events)
+	}
+
+	if tr.Tracking() != 0 {
+		t.Errorf("still tracking %d payments after a failed payment finished", tr.Tracking())
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tr, b, clock, _ := newTestTracker(t, nil)
+	opts := DefaultOptions()
+	ctx := context.Background()
+
+	tr.Track("R1", day)
+	b.set("R1", "20240310", "BNK", "", "")
+	tr.Poll(ctx)
+
+	// 状态不变时间隔翻倍，未到期时不查询
+	for _, interval := range []time.Duration{opts.MinInterval, opts.MinInterval * 2, opts.MinInterval * 4} {
+		before := len(b.queries)
+
+		clock.Add(interval - time.Second)
+		tr.Poll(ctx)
+		if len(b.queries) != before {
+			t.Fatalf("polled %v before the %v interval", interval-time.Second, interval)
+		}
+
+		clock.Add(time.Second)
+		tr.Poll(ctx)
+		if len(b.queries) != before+1 {
+			t.Fatalf("did not poll after the %v interval", interval)
+		}
+	}
+
+	for i := 0; i < 20; i++ {
+		clock.Add(opts.MaxInterval)
+		tr.Poll(ctx)
+	}
+
+	e := tr.entries["R1"]
+	if e.Interval != opts.MaxInterval {
+		t.Errorf("interval = %v, want capped at %v", e.Interval, opts.MaxInterval)
+	}
+}
+
+func TestBatches(t *testing.T) {
+	tr, b, _, _ := newTestTracker(t, nil)
+
+	for _, d := range []int{-20, -19, -13, -12, 0} {
+		tr.Track(fmt.Sprintf("R%d", d), day.AddDate(0, 0, d))
+	}
+
+	tr.Poll(context.Background())
+
+	want := [][2]string{
+		{"20240219", "20240220"},
+		{"20240226", "20240227"},
+		{"20240310", "20240310"},
+	}
+
+	if len(b.queries) != len(want) {
+		t.Fatalf("queries = %v, want %v", b.queries, want)
+	}
+	for i := range want {
+		if b.queries[i] != want[i] {
+			t.Errorf("queries = %v, want %v", b.queries, want)
+		}
+	}
+}
+
+func TestRefundWindow(t *testing.T) {
+	tr, b, clock, rec := newTestTracker(t, nil)
+	opts := DefaultOptions()
+	ctx := context.Background()
+
+	tr.Track("R1", day)
+	b.set("R1", "20240310", "FIN", "S", "")
+	tr.Poll(ctx)
+
+	if events := rec.take(); len(events) != 1 || !events[0].Final || events[0].Refund {
+		t.Fatalf("events = %+v", events)
+	}
+
+	if tr.Tracking() != 1 {
+		t.Fatal("succeeded payment is not kept for the refund window")
+	}
+
+	clock.Add(time.Hour * 24)
+	b.set("R1", "20240310", "FIN", "B", "收款账号已销户")
+	tr.Poll(ctx)
+
+	events := rec.take()
+	if len(events) != 1 || !events[0].Refund || events[0].From.RTNFLG != "S" || events[0].To.RTNNAR != "收款账号已销户" {
+		t.Fatalf("events = %+v, want a refund", events)
+	}
+
+	if tr.Tracking() != 0 {
+		t.Error("still tracking after the refund")
+	}
+
+	// 没有退票时，超过 RefundWindow 后停止跟踪
+	tr.Track("R2", clock.Now())
+	b.set("R2", "20240311", "FIN", "S", "")
+	tr.Poll(ctx)
+	rec.take()
+
+	for i := 0; i < int(opts.RefundWindow/opts.MaxInterval)+2; i++ {
+		clock.Add(opts.MaxInterval)
+		tr.Poll(ctx)
+	}
+
+	if tr.Tracking() != 0 {
+		t.Error("still tracking after the refund window")
+	}
+
+	if events := rec.take(); len(events) != 0 {
+		t.Errorf("events = %+v, want none", events)
+	}
+}
+
+func TestExpired(t *testing.T) {
+	tr, _, clock, rec := newTestTracker(t, nil)
+
+	tr.Track("R1", day)
+	clock.Add(DefaultOptions().MaxAge + time.Hour*24)
+	tr.Poll(context.Background())
+
+	events := rec.take()
+	if len(events) != 1 || !events[0].Expired {
+		t.Fatalf("events = %+v, want expired", events)
+	}
+
+	if tr.Tracking() != 0 {
+		t.Error("still tracking an expired payment")
+	}
+}
+
+func TestQueryFailure(t *testing.T) {
+	tr, b, clock, rec := newTestTracker(t, nil)
+
+	tr.Track("R1", day)
+	b.set("R1", "20240310", "FIN", "S", "")
+	b.err = errors.New("timeout")
+
+	if err := tr.Poll(context.Background()); err != b.err {
+		t.Errorf("Poll = %v, want %v", err, b.err)
+	}
+
+	if events := rec.take(); len(events) != 0 {
+		t.Errorf("events = %+v after a failed query", events)
+	}
+
+	b.err = nil
+	clock.Add(DefaultOptions().MinInterval * 2)
+	tr.Poll(context.Background())
+
+	if events := rec.take(); len(events) != 1 {
+		t.Errorf("events = %+v after recovery", events)
+	}
+}
+
+func TestFileStoreResume(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "tracker.json"))
+
+	tr, b, clock, _ := newTestTracker(t, store)
+	tr.Track("R1", day)
+	tr.Track("R2", day)
+	b.set("R1", "20240310", "BNK", "", "")
+	tr.Poll(context.Background())
+
+	entries, err := store.Load()
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("Load = %+v, %v", entries, err)
+	}
+
+	// 重启后恢复状态和下次查询时间，只通知新的变化
+	tr2, err := New(b, store, Options{Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &recorder{}
+	tr2.AddSubscriber(rec)
+
+	if tr2.Tracking() != 2 || tr2.entries["R1"].Status.REQSTS != "BNK" || !tr2.entries["R1"].NextPoll.Equal(tr.entries["R1"].NextPoll) {
+		t.Fatalf("resumed entries = %+v", tr2.entries)
+	}
+
+	b.set("R1", "20240310", "FIN", "R", "")
+	clock.Add(DefaultOptions().MaxInterval)
+	tr2.Poll(context.Background())
+
+	events := rec.take()
+	if len(events) != 1 || events[0].YURREF != "R1" || events[0].From.REQSTS != "BNK" {
+		t.Errorf("events = %+v", events)
+	}
+
+	entries, _ = store.Load()
+	if len(entries) != 1 || entries[0].YURREF != "R2" {
+		t.Errorf("saved entries = %+v, want only R2", entries)
+	}
+}
+
+func TestFileStoreMissing(t *testing.T) {
+	entries, err := NewFileStore(filepath.Join(t.TempDir(), "none.json")).Load()
+	if err != nil || entries != nil {
+		t.Errorf("Load = %v, %v, want empty", entries, err)
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	tr, b, _, _ := newTestTracker(t, nil)
+	tr.Track("R1", day)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan error)
+	go func() { done <- tr.Run(ctx) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after ctx was canceled")
+	}
+
+	if len(b.queries) != 0 {
+		t.Errorf("queried %d times with a canceled ctx", len(b.queries))
+	}
+}
@@ -0,0 +1,210 @@
+package tracker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrWebhookStatus = errors.New("webhook returned non-2xx status")
+)
+
+const (
+	// 连续失败 webhookRetries 次后输出错误日志，之后继续重试
+	webhookRetries = 5
+
+	webhookMaxBackoff = 5 * time.Minute
+)
+
+// 第一次重试前的等待时间，之后逐次翻倍
+var webhookBackoff = time.Second
+
+// Webhook 将状态变化以JSON POST 到指定地址。通知按顺序发送，失败时一直重试，
+// 未送达的通知保存在 outbox 文件中，进程重启后继续发送
+type Webhook struct {
+	url    string
+	client *http.Client
+	outbox string // 为空时未送达的通知只保存在内存中
+
+	mu      sync.Mutex
+	pending []Event
+
+	wake chan struct{}
+	quit chan struct{}
+	done chan struct{}
+}
+
+func NewWebhook(url string, client *http.Client) *Webhook {
+	hook, _ := NewWebhookWithOutbox(url, client, "")
+	return hook
+}
+
+// NewWebhookWithOutbox 读取 outbox 中上次未送达的通知并继续发送
+func NewWebhookWithOutbox(url string, client *http.Client, outbox string) (hook *Webhook, err error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	hook = &Webhook{
+		url:    url,
+		client: client,
+		outbox: outbox,
+		wake:   make(chan struct{}, 1),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	if len(outbox) > 0 {
+		data, e := ioutil.ReadFile(outbox)
+		switch {
+		case os.IsNotExist(e):
+		case e != nil:
+			return nil, e
+		default:
+			if err = json.Unmarshal(data, &hook.pending); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	go hook.loop()
+
+	return
+}
+
+// Publish 将通知加入 outbox，返回时已经保存
+func (p *Webhook) Publish(event Event) {
+	p.mu.Lock()
+	p.pending = append(p.pending, event)
+	err := p.saveLocked()
+	p.mu.Unlock()
+
+	if err != nil {
+		logrus.WithField("yurref", event.YURREF).WithField("outbox", p.outbox).WithError(err).Errorln("保存 Webhook 通知失败")
+	}
+
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Pending 返回尚未送达的通知数量
+func (p *Webhook) Pending() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.pending)
+}
+
+// Close 在当前的发送结束后停止，未送达的通知保留在 outbox 中
+func (p *Webhook) Close() {
+	close(p.quit)
+	<-p.done
+}
+
+func (p *Webhook) loop() {
+	defer close(p.done)
+
+	backoff := webhookBackoff
+	failures := 0
+
+	for {
+		p.mu.Lock()
+		var event Event
+		ok := len(p.pending) > 0
+		if ok {
+			event = p.pending[0]
+		}
+		p.mu.Unlock()
+
+		if !ok {
+			select {
+			case <-p.wake:
+				continue
+			case <-p.quit:
+				return
+			}
+		}
+
+		err := p.post(event)
+		if err == nil {
+			p.delivered()
+			backoff, failures = webhookBackoff, 0
+			continue
+		}
+
+		failures++
+
+		entry := logrus.WithField("yurref", event.YURREF).WithField("url", p.url).WithField("failures", failures).WithError(err)
+		if failures == webhookRetries {
+			entry.Errorln("Webhook 多次通知失败，继续重试")
+		} else {
+			entry.Warnln("Webhook 通知失败，稍后重试")
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-p.quit:
+			return
+		}
+
+		backoff *= 2
+		if backoff > webhookMaxBackoff {
+			backoff = webhookMaxBackoff
+		}
+	}
+}
+
+// delivered 从 outbox 中移除已送达的第一条通知
+func (p *Webhook) delivered() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pending = p.pending[1:]
+
+	if err := p.saveLocked(); err != nil {
+		logrus.WithField("outbox", p.outbox).WithError(err).Errorln("保存 Webhook 通知失败")
+	}
+}
+
+func (p *Webhook) saveLocked() (err error) {
+	if len(p.outbox) == 0 {
+		return
+	}
+
+	data, err := json.MarshalIndent(p.pending, "", "  ")
+	if err != nil {
+		return
+	}
+
+	return writeFile(p.outbox, data)
+}
+
+func (p *Webhook) post(event Event) (err error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	resp, err := p.client.Post(p.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err = ErrWebhookStatus
+		return
+	}
+
+	return
+}
@@ -0,0 +1,132 @@
+package tracker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hookServer 前 fail 次请求返回500，之后记录收到的通知
+type hookServer struct {
+	mu       sync.Mutex
+	fail     int
+	received []Event
+}
+
+func (p *hookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.fail > 0 {
+		p.fail--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var e Event
+	json.NewDecoder(r.Body).Decode(&e)
+	p.received = append(p.received, e)
+}
+
+func (p *hookServer) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.received)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+func TestWebhookRetriesUntilDelivered(t *testing.T) {
+	defer func(d time.Duration) { webhookBackoff = d }(webhookBackoff)
+	webhookBackoff = time.Millisecond
+
+	srv := &hookServer{fail: webhookRetries + 2}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	outbox := filepath.Join(t.TempDir(), "outbox.json")
+
+	hook, err := NewWebhookWithOutbox(ts.URL, nil, outbox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hook.Close()
+
+	hook.Publish(Event{YURREF: "R1"})
+	hook.Publish(Event{YURREF: "R2"})
+
+	waitFor(t, func() bool { return srv.count() == 2 })
+	waitFor(t, func() bool { return hook.Pending() == 0 })
+
+	if srv.received[0].YURREF != "R1" || srv.received[1].YURREF != "R2" {
+		t.Errorf("received %+v, want R1 then R2", srv.received)
+	}
+}
+
+func TestWebhookOutboxSurvivesRestart(t *testing.T) {
+	defer func(d time.Duration) { webhookBackoff = d }(webhookBackoff)
+	webhookBackoff = time.Hour
+
+	srv := &hookServer{fail: 1}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	outbox := filepath.Join(t.TempDir(), "outbox.json")
+
+	hook, err := NewWebhookWithOutbox(ts.URL, nil, outbox)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hook.Publish(Event{YURREF: "R1", To: Status{REQSTS: "FIN", RTNFLG: "B"}, Refund: true})
+
+	// 第一次发送失败后等待重试时关闭，通知保留在 outbox 中
+	waitFor(t, func() bool {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		return srv.fail == 0
+	})
+	hook.Close()
+
+	if hook.Pending() != 1 {
+		t.Fatalf("pending = %d after close, want 1", hook.Pending())
+	}
+
+	webhookBackoff = time.Millisecond
+
+	hook, err = NewWebhookWithOutbox(ts.URL, nil, outbox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hook.Close()
+
+	waitFor(t, func() bool { return srv.count() == 1 })
+
+	if e := srv.received[0]; e.YURREF != "R1" || !e.Refund {
+		t.Errorf("received %+v", e)
+	}
+
+	waitFor(t, func() bool { return hook.Pending() == 0 })
+
+	reloaded, err := NewWebhookWithOutbox(ts.URL, nil, outbox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+
+	if reloaded.Pending() != 0 {
+		t.Errorf("outbox still has %d events after delivery", reloaded.Pending())
+	}
+}